@@ -0,0 +1,325 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidAPIKey is returned when an API key is not known to the store.
+var ErrInvalidAPIKey = errors.New("req: invalid API key")
+
+// APIKeyPrincipal is the identity an API key belongs to.
+type APIKeyPrincipal struct {
+	ID     string
+	Scopes []string
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p APIKeyPrincipal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// APIKeyStore looks up principals by the SHA-256 hash of their API key, so
+// stores never hold plaintext keys. Implementations must compare hashes in
+// constant time and be safe for concurrent use.
+type APIKeyStore interface {
+	// LookupAPIKey returns the principal of a key hash, or ErrInvalidAPIKey.
+	LookupAPIKey(ctx context.Context, hash []byte) (APIKeyPrincipal, error)
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of an API key, as stored
+// in API key files and accepted by MemoryAPIKeyStore.AddHash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyEntry is a stored key hash and its principal.
+type apiKeyEntry struct {
+	hash      []byte
+	principal APIKeyPrincipal
+}
+
+// lookupAPIKeyEntry compares hash with every entry in constant time, so the
+// lookup time does not reveal how close a guess came to a stored key.
+func lookupAPIKeyEntry(entries []apiKeyEntry, hash []byte) (APIKeyPrincipal, error) {
+	found := -1
+	for i, e := range entries {
+		if subtle.ConstantTimeCompare(e.hash, hash) == 1 {
+			found = i
+		}
+	}
+	if found == -1 {
+		return APIKeyPrincipal{}, ErrInvalidAPIKey
+	}
+	return entries[found].principal, nil
+}
+
+// MemoryAPIKeyStore is an in-memory APIKeyStore for tests and small
+// deployments.
+type MemoryAPIKeyStore struct {
+	mu      sync.RWMutex
+	entries []apiKeyEntry
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory store.
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{}
+}
+
+// Add stores the hash of a plaintext key.
+func (s *MemoryAPIKeyStore) Add(key string, principal APIKeyPrincipal) {
+	sum := sha256.Sum256([]byte(key))
+	s.add(sum[:], principal)
+}
+
+// AddHash stores a hex encoded key hash as returned by HashAPIKey.
+func (s *MemoryAPIKeyStore) AddHash(hash string, principal APIKeyPrincipal) error {
+	decoded, err := decodeAPIKeyHash(hash)
+	if err != nil {
+		return err
+	}
+	s.add(decoded, principal)
+	return nil
+}
+
+// Remove deletes every key of a principal ID.
+func (s *MemoryAPIKeyStore) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = slices.DeleteFunc(s.entries, func(e apiKeyEntry) bool {
+		return e.principal.ID == id
+	})
+}
+
+// LookupAPIKey implements APIKeyStore.
+func (s *MemoryAPIKeyStore) LookupAPIKey(_ context.Context, hash []byte) (APIKeyPrincipal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return lookupAPIKeyEntry(s.entries, hash)
+}
+
+// add stores a raw hash.
+func (s *MemoryAPIKeyStore) add(hash []byte, principal APIKeyPrincipal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, apiKeyEntry{hash: hash, principal: principal})
+}
+
+// FileAPIKeyStore is an APIKeyStore read from a file with one key per line:
+//
+//	# sha256(key)                                                   id       scopes
+//	9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 billing  invoices:read,invoices:write
+//
+// Empty lines and text after '#' are ignored. The file is reloaded when it
+// changes, without interrupting concurrent lookups.
+type FileAPIKeyStore struct {
+	fileReloader[[]apiKeyEntry]
+}
+
+// OpenAPIKeyFile reads an API key file. If reloadInterval is positive, the
+// file is checked for changes at that interval until Close is called.
+func OpenAPIKeyFile(path string, reloadInterval time.Duration) (*FileAPIKeyStore, error) {
+	s := &FileAPIKeyStore{}
+	if err := s.open(path, reloadInterval, parseAPIKeyFile); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LookupAPIKey implements APIKeyStore.
+func (s *FileAPIKeyStore) LookupAPIKey(_ context.Context, hash []byte) (APIKeyPrincipal, error) {
+	return lookupAPIKeyEntry(s.current(), hash)
+}
+
+// parseAPIKeyFile parses "hash id [scopes]" lines, rejecting invalid entries.
+func parseAPIKeyFile(data []byte) ([]apiKeyEntry, error) {
+	var entries []apiKeyEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		entry := scanner.Text()
+		if i := strings.Index(entry, "#"); i != -1 {
+			entry = entry[:i]
+		}
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("req: invalid entry on line %d", line)
+		}
+		hash, err := decodeAPIKeyHash(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w on line %d", err, line)
+		}
+		principal := APIKeyPrincipal{ID: fields[1]}
+		if len(fields) == 3 {
+			principal.Scopes = strings.Split(fields[2], ",")
+		}
+		entries = append(entries, apiKeyEntry{hash: hash, principal: principal})
+	}
+	return entries, scanner.Err()
+}
+
+// decodeAPIKeyHash decodes a hex encoded SHA-256 hash.
+func decodeAPIKeyHash(hash string) ([]byte, error) {
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("req: invalid API key hash %q", hash)
+	}
+	return decoded, nil
+}
+
+// APIKeyOptions configures GetAPIKey and NewAPIKeyAuthenticator.
+type APIKeyOptions struct {
+	// Header holds the key; empty means "X-API-Key", "-" disables it.
+	Header string
+	// QueryParam is the GET or POST parameter checked when the header is
+	// missing, e.g. "api_key". Empty disables the fallback.
+	QueryParam string
+	// Cookie is checked when the header and parameter are missing. Empty
+	// disables the fallback.
+	Cookie string
+	// Store looks up the principals.
+	Store APIKeyStore
+	// Logger receives store errors, in which case the middleware responds
+	// with 500 Internal Server Error; nil means slog.Default().
+	Logger *slog.Logger
+	// DeniedHandler responds to requests without a valid key; nil means
+	// 401 Unauthorized.
+	DeniedHandler http.Handler
+}
+
+// GetAPIKey extracts an API key from the request.
+//
+// Business logic:
+// - the configured header (default X-API-Key) is used first
+// - then the configured parameter (via GetString), then the configured cookie
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - opts (APIKeyOptions): The key sources
+//
+// Returns:
+//   - string: the key
+//   - error: ErrNoCredentials if no key was found
+func GetAPIKey(r *http.Request, opts APIKeyOptions) (string, error) {
+	if r == nil {
+		return "", ErrNoCredentials
+	}
+	if header := optionName(opts.Header, "X-API-Key"); header != "" {
+		if key := strings.TrimSpace(r.Header.Get(header)); key != "" {
+			return key, nil
+		}
+	}
+	if key := requestParam(r, opts.QueryParam); key != "" {
+		return key, nil
+	}
+	if key := requestCookie(r, opts.Cookie); key != "" {
+		return key, nil
+	}
+	return "", ErrNoCredentials
+}
+
+// APIKeyAuthenticator authenticates requests by API key.
+type APIKeyAuthenticator struct {
+	opts APIKeyOptions
+}
+
+// NewAPIKeyAuthenticator creates an API key authenticator.
+//
+// Example:
+//
+//	keys, err := req.OpenAPIKeyFile("/etc/app/api-keys.txt", time.Minute)
+//	auth := req.NewAPIKeyAuthenticator(req.APIKeyOptions{Store: keys, QueryParam: "api_key"})
+//	http.ListenAndServe(":8080", auth.Middleware(handler))
+func NewAPIKeyAuthenticator(opts APIKeyOptions) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{opts: opts}
+}
+
+// APIKeyMiddleware returns middleware that rejects requests without a valid
+// API key and stores the principal in the context, see GetAPIKeyPrincipal.
+func APIKeyMiddleware(opts APIKeyOptions) func(http.Handler) http.Handler {
+	return NewAPIKeyAuthenticator(opts).Middleware
+}
+
+// Authenticate extracts the key of a request and looks up its principal.
+//
+// Returns:
+//   - APIKeyPrincipal: the principal of the key
+//   - error: ErrNoCredentials, ErrInvalidAPIKey or a store error
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (APIKeyPrincipal, error) {
+	key, err := GetAPIKey(r, a.opts)
+	if err != nil {
+		return APIKeyPrincipal{}, err
+	}
+	if a.opts.Store == nil {
+		return APIKeyPrincipal{}, ErrInvalidAPIKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	return a.opts.Store.LookupAPIKey(r.Context(), sum[:])
+}
+
+// Middleware wraps next with the authenticator.
+func (a *APIKeyAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r.WithContext(WithAPIKeyPrincipal(r.Context(), principal)))
+		case errors.Is(err, ErrNoCredentials), errors.Is(err, ErrInvalidAPIKey):
+			if a.opts.DeniedHandler != nil {
+				a.opts.DeniedHandler.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		default:
+			a.logger().Error("req: API key lookup failed", "error", err, "path", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+}
+
+// logger returns the configured logger.
+func (a *APIKeyAuthenticator) logger() *slog.Logger {
+	if a.opts.Logger != nil {
+		return a.opts.Logger
+	}
+	return slog.Default()
+}
+
+// apiKeyContextKey is the context key of the authenticated principal.
+type apiKeyContextKey struct{}
+
+// WithAPIKeyPrincipal returns a copy of ctx carrying principal.
+func WithAPIKeyPrincipal(ctx context.Context, principal APIKeyPrincipal) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, principal)
+}
+
+// APIKeyPrincipalFromContext returns the principal stored by the API key
+// middleware.
+func APIKeyPrincipalFromContext(ctx context.Context) (APIKeyPrincipal, bool) {
+	principal, ok := ctx.Value(apiKeyContextKey{}).(APIKeyPrincipal)
+	return principal, ok
+}
+
+// GetAPIKeyPrincipal returns the principal stored in the request context by
+// the API key middleware, and whether there is one.
+func GetAPIKeyPrincipal(r *http.Request) (APIKeyPrincipal, bool) {
+	if r == nil {
+		return APIKeyPrincipal{}, false
+	}
+	return APIKeyPrincipalFromContext(r.Context())
+}
@@ -0,0 +1,192 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    APIKeyOptions
+		setup   func(r *http.Request)
+		target  string
+		want    string
+		wantErr error
+	}{
+		{"default header", APIKeyOptions{}, func(r *http.Request) { r.Header.Set("X-API-Key", "k1") }, "/", "k1", nil},
+		{"custom header", APIKeyOptions{Header: "X-Key"}, func(r *http.Request) { r.Header.Set("X-Key", "k2") }, "/", "k2", nil},
+		{"query param", APIKeyOptions{QueryParam: "api_key"}, func(*http.Request) {}, "/?api_key=k3", "k3", nil},
+		{"query param disabled", APIKeyOptions{}, func(*http.Request) {}, "/?api_key=k3", "", ErrNoCredentials},
+		{"cookie", APIKeyOptions{Cookie: "key"}, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "key", Value: "k4"}) }, "/", "k4", nil},
+		{"header disabled", APIKeyOptions{Header: "-"}, func(r *http.Request) { r.Header.Set("X-API-Key", "k1") }, "/", "", ErrNoCredentials},
+		{"header wins", APIKeyOptions{QueryParam: "api_key"}, func(r *http.Request) { r.Header.Set("X-API-Key", "k1") }, "/?api_key=k3", "k1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			tt.setup(r)
+			got, err := GetAPIKey(r, tt.opts)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetAPIKey() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryAPIKeyStore(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	store.Add("secret-1", APIKeyPrincipal{ID: "svc-1", Scopes: []string{"read"}})
+	if err := store.AddHash(HashAPIKey("secret-2"), APIKeyPrincipal{ID: "svc-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddHash("not-hex", APIKeyPrincipal{ID: "bad"}); err == nil {
+		t.Error("AddHash(not-hex) error = nil")
+	}
+
+	auth := NewAPIKeyAuthenticator(APIKeyOptions{Store: store})
+	lookup := func(key string) (APIKeyPrincipal, error) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-API-Key", key)
+		return auth.Authenticate(r)
+	}
+
+	if p, err := lookup("secret-1"); err != nil || p.ID != "svc-1" || !p.HasScope("read") {
+		t.Errorf("Authenticate(secret-1) = %+v, %v", p, err)
+	}
+	if p, err := lookup("secret-2"); err != nil || p.ID != "svc-2" {
+		t.Errorf("Authenticate(secret-2) = %+v, %v", p, err)
+	}
+	if _, err := lookup("secret-3"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate(secret-3) error = %v, want ErrInvalidAPIKey", err)
+	}
+
+	store.Remove("svc-1")
+	if _, err := lookup("secret-1"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate(removed) error = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestFileAPIKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	writeFile(t, path, "# service keys\n"+HashAPIKey("alpha")+" billing invoices:read,invoices:write\n\n")
+
+	store, err := OpenAPIKeyFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	hash := func(key string) []byte {
+		b, _ := decodeAPIKeyHash(HashAPIKey(key))
+		return b
+	}
+
+	p, err := store.LookupAPIKey(ctx, hash("alpha"))
+	if err != nil || p.ID != "billing" || !p.HasScope("invoices:write") {
+		t.Errorf("LookupAPIKey(alpha) = %+v, %v", p, err)
+	}
+
+	writeFile(t, path, HashAPIKey("beta")+" reports\n")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.LookupAPIKey(ctx, hash("alpha")); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("LookupAPIKey(alpha) after reload error = %v, want ErrInvalidAPIKey", err)
+	}
+	if p, err := store.LookupAPIKey(ctx, hash("beta")); err != nil || p.ID != "reports" {
+		t.Errorf("LookupAPIKey(beta) = %+v, %v", p, err)
+	}
+
+	writeFile(t, path, "short-hash reports\n")
+	if err := store.Reload(); err == nil {
+		t.Error("Reload() error = nil for an invalid file")
+	}
+	if _, err := store.LookupAPIKey(ctx, hash("beta")); err != nil {
+		t.Errorf("LookupAPIKey(beta) after failed reload error = %v", err)
+	}
+}
+
+func TestParseAPIKeyFile_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"abc svc\n",
+		HashAPIKey("x") + "\n",
+		HashAPIKey("x") + " svc read extra\n",
+	} {
+		if _, err := parseAPIKeyFile([]byte(data)); err == nil {
+			t.Errorf("parseAPIKeyFile(%q) error = nil", data)
+		}
+	}
+}
+
+type failingAPIKeyStore struct{}
+
+func (failingAPIKeyStore) LookupAPIKey(context.Context, []byte) (APIKeyPrincipal, error) {
+	return APIKeyPrincipal{}, errors.New("database down")
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	store.Add("secret", APIKeyPrincipal{ID: "svc"})
+
+	var gotID string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := GetAPIKeyPrincipal(r)
+		gotID = p.ID
+	})
+
+	tests := []struct {
+		name   string
+		store  APIKeyStore
+		key    string
+		want   int
+		wantID string
+	}{
+		{"valid", store, "secret", http.StatusOK, "svc"},
+		{"missing", store, "", http.StatusUnauthorized, ""},
+		{"unknown", store, "guess", http.StatusUnauthorized, ""},
+		{"store error", failingAPIKeyStore{}, "secret", http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID = ""
+			handler := APIKeyMiddleware(APIKeyOptions{Store: tt.store, Logger: discardLogger()})(next)
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.key != "" {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want || gotID != tt.wantID {
+				t.Errorf("status = %d, principal = %q, want %d, %q", w.Code, gotID, tt.want, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddleware_DeniedHandler(t *testing.T) {
+	denied := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"api key required"}`, http.StatusUnauthorized)
+	})
+	handler := APIKeyMiddleware(APIKeyOptions{Store: NewMemoryAPIKeyStore(), DeniedHandler: denied})(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "api key required") {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,276 @@
+package req
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrNoCredentials is returned when a request carries no credentials.
+var ErrNoCredentials = errors.New("req: no credentials")
+
+// ErrInvalidCredentials is returned for malformed credentials.
+var ErrInvalidCredentials = errors.New("req: invalid credentials")
+
+// Credentials are the parsed value of an Authorization header
+// (RFC 9110 section 11.4).
+//
+// A credential has either a Token, as in "Bearer abc" and "Basic dXNlcjpwYXNz",
+// or auth-params, as in `Digest username="u", realm="r"`.
+type Credentials struct {
+	Scheme string            // as sent, compare with strings.EqualFold
+	Token  string            // token68 form, empty when Params is used
+	Params map[string]string // auth-params with lowercase names and unquoted values
+}
+
+// Is reports whether the credentials use the given scheme, ignoring case.
+func (c Credentials) Is(scheme string) bool {
+	return strings.EqualFold(c.Scheme, scheme)
+}
+
+// Param returns an auth-param by name, ignoring case.
+func (c Credentials) Param(name string) string {
+	return c.Params[strings.ToLower(name)]
+}
+
+// BasicAuth decodes Basic credentials (RFC 7617) into user and password.
+func (c Credentials) BasicAuth() (user, password string, ok bool) {
+	if !c.Is("Basic") || c.Token == "" {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(c.Token)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// ParseAuthorization parses the Authorization header of a request.
+//
+// Returns:
+//   - Credentials: the parsed credentials
+//   - error: ErrNoCredentials if the header is missing, ErrInvalidCredentials if malformed
+func ParseAuthorization(r *http.Request) (Credentials, error) {
+	if r == nil {
+		return Credentials{}, ErrNoCredentials
+	}
+	header := r.Header.Get("Authorization")
+	if strings.TrimSpace(header) == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return ParseCredentials(header)
+}
+
+// ParseCredentials parses a credentials value such as "Bearer abc" or
+// `Digest username="Mufasa", realm="http-auth@example.org", nc=00000001`.
+//
+// Business logic:
+// - the scheme is the first token
+// - the rest is either a token68 (letters, digits, "-._~+/" and trailing "=") or a list of auth-params
+// - auth-param values may be tokens or quoted strings; names are lowercased
+// - a duplicate auth-param makes the credentials invalid
+func ParseCredentials(value string) (Credentials, error) {
+	value = strings.TrimSpace(value)
+	scheme, rest, _ := strings.Cut(value, " ")
+	if scheme == "" || !isToken(scheme) {
+		return Credentials{}, ErrInvalidCredentials
+	}
+
+	c := Credentials{Scheme: scheme}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return c, nil
+	}
+
+	if isToken68(rest) {
+		c.Token = rest
+		return c, nil
+	}
+
+	params, ok := parseAuthParams(rest)
+	if !ok {
+		return Credentials{}, ErrInvalidCredentials
+	}
+	c.Params = params
+	return c, nil
+}
+
+// TokenOptions configures GetToken.
+type TokenOptions struct {
+	// Scheme is the Authorization scheme carrying the token; empty means "Bearer".
+	Scheme string
+	// QueryParam is checked when the header is missing, e.g. "access_token".
+	// Empty disables the fallback; tokens in URLs end up in logs, so prefer
+	// it only for cases like WebSocket handshakes.
+	QueryParam string
+	// Cookie is checked when the header and query parameter are missing.
+	// Empty disables the fallback.
+	Cookie string
+}
+
+// GetToken extracts a bearer token from the request.
+//
+// Business logic:
+// - the Authorization header with the configured scheme is used first
+// - an Authorization header with another scheme is an error, not a reason to fall back
+// - then the configured query parameter, then the configured cookie
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - opts (TokenOptions): The scheme and fallbacks
+//
+// Returns:
+//   - string: the token
+//   - error: ErrNoCredentials if no token was found, ErrInvalidCredentials if malformed
+func GetToken(r *http.Request, opts TokenOptions) (string, error) {
+	scheme := opts.Scheme
+	if scheme == "" {
+		scheme = "Bearer"
+	}
+
+	c, err := ParseAuthorization(r)
+	switch {
+	case err == nil:
+		if !c.Is(scheme) || c.Token == "" {
+			return "", ErrInvalidCredentials
+		}
+		return c.Token, nil
+	case !errors.Is(err, ErrNoCredentials):
+		return "", err
+	case r == nil:
+		return "", ErrNoCredentials
+	}
+
+	if opts.QueryParam != "" && r.URL != nil {
+		if token := r.URL.Query().Get(opts.QueryParam); token != "" {
+			return token, nil
+		}
+	}
+	if token := requestCookie(r, opts.Cookie); token != "" {
+		return token, nil
+	}
+	return "", ErrNoCredentials
+}
+
+// Challenge is one challenge of a WWW-Authenticate header
+// (RFC 9110 section 11.6.1).
+type Challenge struct {
+	Scheme string
+	Realm  string            // written first as realm="..."
+	Params map[string]string // further auth-params, written in name order
+}
+
+// String formats the challenge, quoting parameter values, e.g.
+// `Bearer realm="api", error="invalid_token"`.
+func (c Challenge) String() string {
+	var b strings.Builder
+	b.WriteString(c.Scheme)
+
+	sep := " "
+	write := func(name, value string) {
+		b.WriteString(sep)
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(quoteHeader(value))
+		sep = ", "
+	}
+	if c.Realm != "" {
+		write("realm", c.Realm)
+	}
+	names := make([]string, 0, len(c.Params))
+	for name := range c.Params {
+		if !strings.EqualFold(name, "realm") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(name, c.Params[name])
+	}
+	return b.String()
+}
+
+// SetWWWAuthenticate adds challenges to the WWW-Authenticate header of a
+// response, to be sent with 401 Unauthorized.
+//
+// Example:
+//
+//	req.SetWWWAuthenticate(w, req.Challenge{
+//	    Scheme: "Bearer",
+//	    Realm:  "api",
+//	    Params: map[string]string{"error": "invalid_token"},
+//	})
+//	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+func SetWWWAuthenticate(w http.ResponseWriter, challenges ...Challenge) {
+	for _, c := range challenges {
+		w.Header().Add("WWW-Authenticate", c.String())
+	}
+}
+
+// parseAuthParams parses `name=value, name="quoted value"` pairs.
+func parseAuthParams(s string) (map[string]string, bool) {
+	params := map[string]string{}
+	for _, element := range splitHeaderList(s) {
+		name, value, ok := strings.Cut(element, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if !ok || !isToken(name) || value == "" {
+			return nil, false
+		}
+		if strings.HasPrefix(value, `"`) {
+			if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+				return nil, false
+			}
+			value = unquoteHeader(value)
+		} else if !isToken(value) {
+			return nil, false
+		}
+		if _, dup := params[name]; dup {
+			return nil, false
+		}
+		params[name] = value
+	}
+	return params, len(params) > 0
+}
+
+// quoteHeader formats a quoted-string.
+func quoteHeader(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// isToken reports whether s is an RFC 9110 token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isToken68 reports whether s is an RFC 9110 token68.
+func isToken68(s string) bool {
+	body := strings.TrimRight(s, "=")
+	if body == "" {
+		return false
+	}
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("-._~+/", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
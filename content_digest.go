@@ -0,0 +1,407 @@
+package req
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Body digest errors.
+var (
+	ErrDigestMissing   = errors.New("req: body digest missing")
+	ErrDigestMalformed = errors.New("req: body digest malformed")
+	ErrDigestMismatch  = errors.New("req: body digest mismatch")
+)
+
+// Digest algorithms, named as in the HTTP Digest Algorithm Values registry.
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+	DigestMD5    = "md5"
+)
+
+// DefaultDigestBufferSize is the Content-Length up to which the middleware
+// verifies bodies before calling the handler when BufferSize is zero.
+const DefaultDigestBufferSize = 1 << 20
+
+// digestStrength orders algorithms from strongest to weakest.
+var digestStrength = []string{DigestSHA512, DigestSHA256, DigestMD5}
+
+// BodyDigest is a verified body digest.
+type BodyDigest struct {
+	Algorithm string // DigestSHA512, DigestSHA256 or DigestMD5
+	Value     []byte
+	Header    string // the header it was sent in, e.g. "Content-Digest"
+}
+
+// DigestOptions configures NewDigestVerifier.
+type DigestOptions struct {
+	// Required rejects requests without a supported digest.
+	Required bool
+	// AllowMD5 accepts legacy MD5 digests from Content-MD5 and Digest.
+	// They only detect accidental corruption.
+	AllowMD5 bool
+	// Buffer makes the middleware read and verify every body, up to
+	// MaxBodySize, before calling the handler, see DigestVerifier.Verify.
+	Buffer bool
+	// BufferSize is the Content-Length up to which bodies are verified
+	// before calling the handler even without Buffer; zero means
+	// DefaultDigestBufferSize and a negative value disables it.
+	//
+	// Larger bodies and bodies of unknown length are verified as the
+	// handler reads them. That does not protect handlers that stop reading
+	// before the end, such as json.Decoder: they act on unverified bytes
+	// and the mismatch is only logged after the response is sent. Such
+	// handlers must read to the end and check GetBodyDigest before acting,
+	// or be served with Buffer.
+	BufferSize int64
+	// MaxBodySize limits buffered bodies and the rest of the body read
+	// after the handler returns; zero means DefaultMaxBodySize.
+	MaxBodySize int64
+	// Logger receives rejections; nil means slog.Default().
+	Logger *slog.Logger
+	// DeniedHandler responds to requests with a missing or malformed
+	// digest; nil means 400 Bad Request.
+	DeniedHandler http.Handler
+}
+
+// ParseContentDigest parses a Content-Digest or Repr-Digest value
+// (RFC 9530), e.g. "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:".
+//
+// Returns:
+//   - map[string][]byte: digests by lowercase algorithm name, including unsupported ones
+//   - error: ErrDigestMalformed
+func ParseContentDigest(value string) (map[string][]byte, error) {
+	members, err := parseSFDictionary(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDigestMalformed, err)
+	}
+	digests := map[string][]byte{}
+	for _, m := range members {
+		b, ok := m.item.value.([]byte)
+		if m.isList || !ok {
+			return nil, fmt.Errorf("%w: %s is not a byte sequence", ErrDigestMalformed, m.name)
+		}
+		digests[m.name] = b
+	}
+	return digests, nil
+}
+
+// parseLegacyDigest parses an RFC 3230 Digest value, e.g.
+// "SHA-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=".
+func parseLegacyDigest(value string) (map[string][]byte, error) {
+	digests := map[string][]byte{}
+	for _, element := range splitHeaderList(value) {
+		name, encoded, ok := strings.Cut(element, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrDigestMalformed, element)
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrDigestMalformed, element)
+		}
+		digests[strings.ToLower(strings.TrimSpace(name))] = b
+	}
+	return digests, nil
+}
+
+// DigestVerifier checks request bodies against their digest headers.
+type DigestVerifier struct {
+	opts DigestOptions
+}
+
+// NewDigestVerifier creates a body digest verifier.
+//
+// Example:
+//
+//	verifier := req.NewDigestVerifier(req.DigestOptions{Required: true})
+//	http.ListenAndServe(":8080", verifier.Middleware(handler))
+func NewDigestVerifier(opts DigestOptions) *DigestVerifier {
+	return &DigestVerifier{opts: opts}
+}
+
+// DigestMiddleware returns middleware that verifies request bodies, see
+// DigestVerifier.Middleware.
+func DigestMiddleware(opts DigestOptions) func(http.Handler) http.Handler {
+	return NewDigestVerifier(opts).Middleware
+}
+
+// Wrap replaces the body of r with a reader that hashes it as it streams.
+//
+// Business logic:
+// - digests are read from Content-Digest, Repr-Digest, Digest and Content-MD5
+// - Repr-Digest is only used when the body has no Content-Encoding, as it covers the decoded representation
+// - unknown algorithms are ignored; MD5 is ignored unless AllowMD5 is set
+// - every supported digest must match; the body is never buffered
+// - on mismatch, the read that reaches the end of the body returns ErrDigestMismatch instead of io.EOF
+// - after a successful full read, GetBodyDigest returns the strongest digest
+//
+// Returns:
+//   - *http.Request: a shallow copy of r with the wrapped body and digest state in its context
+//   - error: ErrDigestMissing if Required and no supported digest was sent, ErrDigestMalformed for invalid headers
+func (v *DigestVerifier) Wrap(r *http.Request) (*http.Request, error) {
+	expected, err := v.expectedDigests(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(expected) == 0 {
+		if v.opts.Required {
+			return nil, ErrDigestMissing
+		}
+		return r, nil
+	}
+
+	body := &digestBody{body: r.Body, expected: expected, hashes: map[string]hash.Hash{}, state: &digestState{}}
+	if body.body == nil {
+		body.body = http.NoBody
+	}
+	for _, e := range expected {
+		if _, ok := body.hashes[e.Algorithm]; !ok {
+			body.hashes[e.Algorithm] = newDigestHash(e.Algorithm)
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), digestContextKey{}, body.state))
+	r.Body = body
+	return r, nil
+}
+
+// Verify reads the whole body of r, up to MaxBodySize, and checks it
+// before returning, so the caller only ever sees verified bytes.
+//
+// Returns:
+//   - *http.Request: a shallow copy of r whose body replays the verified bytes, see Wrap
+//   - error: as Wrap, ErrDigestMismatch, ErrBodyTooLarge or a read error
+func (v *DigestVerifier) Verify(r *http.Request) (*http.Request, error) {
+	wrapped, err := v.Wrap(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := wrapped.Body.(*digestBody); !ok {
+		return wrapped, nil
+	}
+	if _, err := GetRawBody(wrapped, v.opts.MaxBodySize); err != nil {
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+// Middleware wraps next with the verifier.
+//
+// Business logic:
+// - a missing or malformed digest is rejected before next is called
+// - with Buffer, or a Content-Length up to BufferSize, the body is verified before next is called and a mismatch is rejected with 400, an oversized body with 413
+// - otherwise the body is verified as next reads it, and a read reaching the end of a mismatched body fails with ErrDigestMismatch
+// - a streamed body is not verified before next acts on it: next must read to the end and check GetBodyDigest
+// - after next returns, the unread rest of a streamed body is read, up to MaxBodySize, and a mismatch is logged, as the response can no longer be changed
+func (v *DigestVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verify := v.Wrap
+		if v.buffered(r) {
+			verify = v.Verify
+		}
+		wrapped, err := verify(r)
+		if err != nil {
+			v.reject(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, wrapped)
+
+		if body, ok := wrapped.Body.(*digestBody); ok && body.err == nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(body, v.maxBodySize()))
+			if errors.Is(body.err, ErrDigestMismatch) {
+				v.logger().Warn("req: body digest mismatch in unread body", "error", body.err, "path", r.URL.Path)
+			}
+		}
+	})
+}
+
+// reject responds to a request that failed verification.
+func (v *DigestVerifier) reject(w http.ResponseWriter, r *http.Request, err error) {
+	v.logger().Warn("req: body digest rejected", "error", err, "path", r.URL.Path)
+	if errors.Is(err, ErrBodyTooLarge) {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, ErrDigestMissing) {
+		w.Header().Set("Want-Content-Digest", "sha-512=10, sha-256=9")
+	}
+	if v.opts.DeniedHandler != nil {
+		v.opts.DeniedHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+}
+
+// buffered reports whether the middleware verifies the body of r before
+// calling the handler.
+func (v *DigestVerifier) buffered(r *http.Request) bool {
+	if v.opts.Buffer {
+		return true
+	}
+	size := v.opts.BufferSize
+	if size == 0 {
+		size = DefaultDigestBufferSize
+	}
+	return r.ContentLength >= 0 && r.ContentLength <= min(size, v.maxBodySize())
+}
+
+// maxBodySize returns the configured read limit.
+func (v *DigestVerifier) maxBodySize() int64 {
+	if v.opts.MaxBodySize > 0 {
+		return v.opts.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+// expectedDigests collects the supported digests of all digest headers.
+func (v *DigestVerifier) expectedDigests(r *http.Request) ([]BodyDigest, error) {
+	var expected []BodyDigest
+	add := func(header string, digests map[string][]byte) {
+		for _, alg := range digestStrength {
+			value, ok := digests[alg]
+			if !ok || (alg == DigestMD5 && !v.opts.AllowMD5) {
+				continue
+			}
+			expected = append(expected, BodyDigest{Algorithm: alg, Value: value, Header: header})
+		}
+	}
+
+	headers := []string{"Content-Digest"}
+	if encoding := r.Header.Get("Content-Encoding"); encoding == "" || strings.EqualFold(encoding, "identity") {
+		headers = append(headers, "Repr-Digest")
+	}
+	for _, header := range headers {
+		if value := strings.Join(r.Header.Values(header), ", "); value != "" {
+			digests, err := ParseContentDigest(value)
+			if err != nil {
+				return nil, err
+			}
+			add(header, digests)
+		}
+	}
+
+	if value := strings.Join(r.Header.Values("Digest"), ", "); value != "" {
+		digests, err := parseLegacyDigest(value)
+		if err != nil {
+			return nil, err
+		}
+		add("Digest", digests)
+	}
+	if value := r.Header.Get("Content-MD5"); value != "" {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: Content-MD5", ErrDigestMalformed)
+		}
+		add("Content-MD5", map[string][]byte{DigestMD5: b})
+	}
+	return expected, nil
+}
+
+// logger returns the configured logger.
+func (v *DigestVerifier) logger() *slog.Logger {
+	if v.opts.Logger != nil {
+		return v.opts.Logger
+	}
+	return slog.Default()
+}
+
+// newDigestHash returns the hash of a supported algorithm.
+func newDigestHash(alg string) hash.Hash {
+	switch alg {
+	case DigestSHA512:
+		return sha512.New()
+	case DigestMD5:
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+// digestState holds the verification result shared with the context.
+type digestState struct {
+	mu       sync.Mutex
+	verified bool
+	digest   BodyDigest
+}
+
+// digestBody hashes a body as it is read.
+type digestBody struct {
+	body     io.ReadCloser
+	expected []BodyDigest
+	hashes   map[string]hash.Hash
+	state    *digestState
+	err      error // sticky result once the end was reached
+}
+
+// Read implements io.Reader.
+func (d *digestBody) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.body.Read(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		d.err = d.verify()
+		return n, d.err
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (d *digestBody) Close() error {
+	return d.body.Close()
+}
+
+// verify compares every expected digest, returning io.EOF on success.
+func (d *digestBody) verify() error {
+	sums := map[string][]byte{}
+	for alg, h := range d.hashes {
+		sums[alg] = h.Sum(nil)
+	}
+	for _, e := range d.expected {
+		if subtle.ConstantTimeCompare(sums[e.Algorithm], e.Value) != 1 {
+			return fmt.Errorf("%w: %s %s", ErrDigestMismatch, e.Header, e.Algorithm)
+		}
+	}
+
+	strongest := slices.MinFunc(d.expected, func(a, b BodyDigest) int {
+		return slices.Index(digestStrength, a.Algorithm) - slices.Index(digestStrength, b.Algorithm)
+	})
+	d.state.mu.Lock()
+	d.state.verified = true
+	d.state.digest = strongest
+	d.state.mu.Unlock()
+	return io.EOF
+}
+
+// digestContextKey is the context key of the digest state.
+type digestContextKey struct{}
+
+// GetBodyDigest returns the strongest verified digest of the request body.
+// It reports false until the body was read to the end and matched.
+func GetBodyDigest(r *http.Request) (BodyDigest, bool) {
+	if r == nil {
+		return BodyDigest{}, false
+	}
+	state, ok := r.Context().Value(digestContextKey{}).(*digestState)
+	if !ok {
+		return BodyDigest{}, false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.digest, state.verified
+}
@@ -0,0 +1,193 @@
+package req
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Digests of `{"hello": "world"}` from RFC 9530.
+const (
+	helloSHA256 = "X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="
+	helloSHA512 = "WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew=="
+)
+
+func TestParseContentDigest(t *testing.T) {
+	digests, err := ParseContentDigest("sha-256=:" + helloSHA256 + ":, sha-512=:" + helloSHA512 + ":, unixsum=:AQ==:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 3 || len(digests[DigestSHA256]) != 32 || len(digests[DigestSHA512]) != 64 {
+		t.Errorf("ParseContentDigest() = %v", digests)
+	}
+
+	for _, value := range []string{"sha-256=" + helloSHA256, "sha-256=(:AQ==:)", "SHA-256=:AQ==:"} {
+		if _, err := ParseContentDigest(value); !errors.Is(err, ErrDigestMalformed) {
+			t.Errorf("ParseContentDigest(%q) error = %v, want ErrDigestMalformed", value, err)
+		}
+	}
+}
+
+func TestDigestVerifier_Wrap(t *testing.T) {
+	body := `{"hello": "world"}`
+	md5Sum := md5.Sum([]byte(body))
+	helloMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		opts    DigestOptions
+		wantErr error // from Wrap
+		readErr error // from reading the body
+		wantAlg string
+	}{
+		{"content-digest sha-256", map[string]string{"Content-Digest": "sha-256=:" + helloSHA256 + ":"}, DigestOptions{}, nil, nil, DigestSHA256},
+		{"strongest wins", map[string]string{"Content-Digest": "sha-256=:" + helloSHA256 + ":", "Repr-Digest": "sha-512=:" + helloSHA512 + ":"}, DigestOptions{}, nil, nil, DigestSHA512},
+		{"mismatch", map[string]string{"Content-Digest": "sha-256=:" + helloSHA512[:43] + "=:"}, DigestOptions{}, nil, ErrDigestMismatch, ""},
+		{"one of two mismatches", map[string]string{"Content-Digest": "sha-256=:" + helloSHA256 + ":, sha-512=:" + strings.Repeat("A", 86) + "==:"}, DigestOptions{}, nil, ErrDigestMismatch, ""},
+		{"legacy digest", map[string]string{"Digest": "SHA-256=" + helloSHA256}, DigestOptions{}, nil, nil, DigestSHA256},
+		{"content-md5 allowed", map[string]string{"Content-MD5": helloMD5}, DigestOptions{AllowMD5: true}, nil, nil, DigestMD5},
+		{"content-md5 ignored", map[string]string{"Content-MD5": helloMD5}, DigestOptions{Required: true}, ErrDigestMissing, nil, ""},
+		{"unknown algorithm", map[string]string{"Content-Digest": "unixsum=:AQ==:"}, DigestOptions{Required: true}, ErrDigestMissing, nil, ""},
+		{"repr-digest with encoding", map[string]string{"Repr-Digest": "sha-256=:" + helloSHA256 + ":", "Content-Encoding": "gzip"}, DigestOptions{Required: true}, ErrDigestMissing, nil, ""},
+		{"malformed", map[string]string{"Content-Digest": "sha-256=nope"}, DigestOptions{}, ErrDigestMalformed, nil, ""},
+		{"optional", map[string]string{}, DigestOptions{}, nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			wrapped, err := NewDigestVerifier(tt.opts).Wrap(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Wrap() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, ok := GetBodyDigest(wrapped); ok {
+				t.Error("GetBodyDigest() ok before the body was read")
+			}
+			got, err := io.ReadAll(wrapped.Body)
+			if !errors.Is(err, tt.readErr) {
+				t.Fatalf("ReadAll() error = %v, want %v", err, tt.readErr)
+			}
+			if string(got) != body {
+				t.Errorf("body = %q", got)
+			}
+
+			digest, ok := GetBodyDigest(wrapped)
+			if ok != (tt.wantAlg != "") || digest.Algorithm != tt.wantAlg {
+				t.Errorf("GetBodyDigest() = %+v, %v, want %q", digest, ok, tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestDigestMiddleware(t *testing.T) {
+	handler := DigestMiddleware(DigestOptions{Required: true, Logger: discardLogger()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		digest, _ := GetBodyDigest(r)
+		w.Write([]byte(digest.Algorithm))
+	}))
+
+	tests := []struct {
+		name   string
+		digest string
+		body   string
+		want   int
+	}{
+		{"valid", "sha-512=:" + helloSHA512 + ":", `{"hello": "world"}`, http.StatusOK},
+		{"tampered", "sha-512=:" + helloSHA512 + ":", `{"hello": "there"}`, http.StatusBadRequest},
+		{"missing", "", `{"hello": "world"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.digest != "" {
+				r.Header.Set("Content-Digest", tt.digest)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != DigestSHA512 {
+				t.Errorf("handler saw digest %q", w.Body.String())
+			}
+			if tt.digest == "" && w.Header().Get("Want-Content-Digest") == "" {
+				t.Error("Want-Content-Digest not set for a missing digest")
+			}
+		})
+	}
+}
+
+func TestDigestMiddleware_PartialRead(t *testing.T) {
+	signed := sha256.Sum256([]byte(`{"amount":1}` + "\n"))
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(signed[:]) + ":"
+
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool // unknown Content-Length
+		opts       DigestOptions
+		wantStatus int
+		wantCalled bool
+		wantLog    bool
+	}{
+		{"buffered valid", `{"amount":1}`, false, DigestOptions{Required: true, Buffer: true}, http.StatusOK, true, false},
+		{"buffered tampered", `{"amount":1000000}`, false, DigestOptions{Required: true, Buffer: true}, http.StatusBadRequest, false, false},
+		{"buffered too large", `{"amount":1}`, false, DigestOptions{Required: true, Buffer: true, MaxBodySize: 4}, http.StatusRequestEntityTooLarge, false, false},
+		{"small body buffered by default", `{"amount":1000000}`, false, DigestOptions{Required: true}, http.StatusBadRequest, false, false},
+		{"larger than BufferSize", `{"amount":1000000}`, false, DigestOptions{Required: true, BufferSize: 4}, http.StatusOK, true, true},
+		{"unknown length", `{"amount":1000000}`, true, DigestOptions{Required: true}, http.StatusOK, true, true},
+		{"buffering disabled", `{"amount":1000000}`, false, DigestOptions{Required: true, BufferSize: -1}, http.StatusOK, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			tt.opts.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+			called := false
+			handler := DigestMiddleware(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				var v struct{ Amount int }
+				if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				}
+			}))
+
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body+"\n"))
+			r.Header.Set("Content-Digest", digest)
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus || called != tt.wantCalled {
+				t.Errorf("status = %d, called = %v, want %d, %v", w.Code, called, tt.wantStatus, tt.wantCalled)
+			}
+			if logged := strings.Contains(logs.String(), "unread body"); logged != tt.wantLog {
+				t.Errorf("mismatch in unread body logged = %v, want %v: %s", logged, tt.wantLog, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package req
+
+import (
+	"cmp"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ExternalURL reconstructs the URL the client requested, including scheme
+// and host, which r.URL lacks on the server side, especially behind
+// TLS-terminating proxies.
+//
+// Business logic:
+// - the scheme is "https" if r.TLS is set, "http" otherwise, and the host is r.Host
+// - if RemoteAddr is in opts.TrustedProxies, the first Forwarded element (RFC 7239) overrides both
+// - otherwise trusted X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Port are used
+// - a forwarded host that is neither an IP literal nor a valid host name (see ValidateHostname) is ignored
+// - a trusted X-Forwarded-Prefix is prepended to the path
+// - the host is normalized (see NormalizeHost) and default ports are omitted
+// - the path and query are taken from r.URL
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - opts (HostOptions): Proxy trust configuration; BaseDomains is ignored
+//
+// Returns:
+//   - *url.URL: the external URL, or nil for a nil request
+func ExternalURL(r *http.Request, opts HostOptions) *url.URL {
+	if r == nil {
+		return nil
+	}
+
+	scheme, host, prefix := externalOrigin(r, opts)
+	u := &url.URL{Scheme: scheme, Host: host}
+	if r.URL != nil {
+		u.Path = prefix + r.URL.Path
+		if r.URL.RawPath != "" {
+			u.RawPath = prefix + r.URL.RawPath
+		}
+		u.RawQuery = r.URL.RawQuery
+	} else {
+		u.Path = prefix
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u
+}
+
+// externalOrigin returns the external scheme, host (with non-default port)
+// and trusted path prefix of a request, see ExternalURL.
+func externalOrigin(r *http.Request, opts HostOptions) (scheme, host, prefix string) {
+	scheme = "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	rawHost := r.Host
+	if rawHost == "" && r.URL != nil {
+		rawHost = r.URL.Host
+	}
+	port := ""
+
+	if isTrustedProxy(r, opts.TrustedProxies) {
+		forwarded := firstForwardedElement(r.Header.Values("Forwarded"))
+		forwarded["proto"] = cmp.Or(forwarded["proto"], firstHeaderValue(r, "X-Forwarded-Proto"))
+		forwarded["host"] = cmp.Or(forwarded["host"], firstHeaderValue(r, "X-Forwarded-Host"))
+
+		if proto := strings.ToLower(forwarded["proto"]); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if host := forwarded["host"]; isValidForwardedHost(host) {
+			rawHost = host
+		}
+		if p := firstHeaderValue(r, "X-Forwarded-Port"); isPortSuffix(":" + p) {
+			port = p
+		}
+		prefix = cleanForwardedPrefix(firstHeaderValue(r, "X-Forwarded-Prefix"))
+	}
+
+	hostname := NormalizeHost(rawHost)
+	if port == "" {
+		if _, p, err := net.SplitHostPort(strings.TrimSpace(rawHost)); err == nil && isPortSuffix(":"+p) {
+			port = p
+		}
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	switch {
+	case hostname == "":
+	case port != "":
+		host = net.JoinHostPort(hostname, port)
+	case strings.Contains(hostname, ":"):
+		host = "[" + hostname + "]"
+	default:
+		host = hostname
+	}
+	return scheme, host, prefix
+}
+
+// isValidForwardedHost reports whether a forwarded host, with optional
+// port, is an IP literal or a valid host name, so values such as
+// "evil.com/x" or "user@evil.com" cannot change the origin.
+func isValidForwardedHost(host string) bool {
+	normalized := NormalizeHost(host)
+	if normalized == "" {
+		return false
+	}
+	return net.ParseIP(stripZone(normalized)) != nil || ValidateHostname(normalized) == nil
+}
+
+// firstHeaderValue returns the first comma separated value of a header.
+func firstHeaderValue(r *http.Request, name string) string {
+	first, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(first)
+}
+
+// cleanForwardedPrefix accepts a path prefix such as "/app", rejecting
+// values that could turn the URL into a protocol-relative or absolute one.
+func cleanForwardedPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if !strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") ||
+		strings.ContainsAny(prefix, "\\?#") {
+		return ""
+	}
+	return prefix
+}
+
+// firstForwardedElement parses the first element of the Forwarded header
+// (RFC 7239), i.e. the one added by the proxy closest to the client, into
+// lowercase parameter names and unquoted values.
+func firstForwardedElement(values []string) map[string]string {
+	params := map[string]string{}
+	if len(values) == 0 {
+		return params
+	}
+
+	elements := splitHeaderList(values[0])
+	if len(elements) == 0 {
+		return params
+	}
+	for _, pair := range splitHeaderParams(elements[0]) {
+		name, value, ok := strings.Cut(pair, "=")
+		if ok {
+			params[strings.ToLower(strings.TrimSpace(name))] = unquoteHeader(strings.TrimSpace(value))
+		}
+	}
+	return params
+}
+
+// unquoteHeader removes the quotes and escapes of a quoted-string value.
+func unquoteHeader(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
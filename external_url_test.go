@@ -0,0 +1,185 @@
+package req
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternalURL(t *testing.T) {
+	trusted := HostOptions{TrustedProxies: []string{"10.0.0.0/8"}}
+
+	tests := []struct {
+		name       string
+		target     string
+		host       string
+		tls        bool
+		remoteAddr string
+		headers    map[string]string
+		opts       HostOptions
+		expected   string
+	}{
+		{
+			name:     "plain http",
+			target:   "/path?q=1",
+			host:     "example.com",
+			expected: "http://example.com/path?q=1",
+		},
+		{
+			name:     "direct tls with port",
+			target:   "/",
+			host:     "example.com:8443",
+			tls:      true,
+			expected: "https://example.com:8443/",
+		},
+		{
+			name:     "default port omitted",
+			target:   "/",
+			host:     "Example.COM:443",
+			tls:      true,
+			expected: "https://example.com/",
+		},
+		{
+			name:     "IPv6 host",
+			target:   "/",
+			host:     "[::1]:8080",
+			expected: "http://[::1]:8080/",
+		},
+		{
+			name:       "headers ignored from untrusted peer",
+			target:     "/",
+			host:       "example.com",
+			remoteAddr: "203.0.113.1:1234",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"},
+			opts:       trusted,
+			expected:   "http://example.com/",
+		},
+		{
+			name:       "x-forwarded headers",
+			target:     "/orders?page=2",
+			host:       "backend:8080",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-Proto":  "https, http",
+				"X-Forwarded-Host":   "shop.example.com, backend",
+				"X-Forwarded-Prefix": "/store/",
+			},
+			opts:     trusted,
+			expected: "https://shop.example.com/store/orders?page=2",
+		},
+		{
+			name:       "x-forwarded-port",
+			target:     "/",
+			host:       "backend:8080",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "example.com",
+				"X-Forwarded-Port":  "8443",
+			},
+			opts:     trusted,
+			expected: "https://example.com:8443/",
+		},
+		{
+			name:       "forwarded header wins",
+			target:     "/",
+			host:       "backend",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":         `for=192.0.2.60;proto=https;host="api.example.com:444", for=10.0.0.2;proto=http;host=backend`,
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "other.example.com",
+			},
+			opts:     trusted,
+			expected: "https://api.example.com:444/",
+		},
+		{
+			name:       "invalid proto and host ignored",
+			target:     "/",
+			host:       "example.com",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-Proto": "javascript", "X-Forwarded-Host": "[::1"},
+			opts:       trusted,
+			expected:   "http://example.com/",
+		},
+		{
+			name:       "forwarded host with path rejected",
+			target:     "/",
+			host:       "example.com",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-Host": "evil.com/x?"},
+			opts:       trusted,
+			expected:   "http://example.com/",
+		},
+		{
+			name:       "forwarded host with userinfo rejected",
+			target:     "/",
+			host:       "example.com",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `host="user@evil.com"`},
+			opts:       trusted,
+			expected:   "http://example.com/",
+		},
+		{
+			name:       "forwarded IPv6 host accepted",
+			target:     "/",
+			host:       "example.com",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-Host": "[2001:db8::1]:8443"},
+			opts:       trusted,
+			expected:   "http://[2001:db8::1]:8443/",
+		},
+		{
+			name:       "protocol relative prefix rejected",
+			target:     "/login",
+			host:       "example.com",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-Prefix": "//evil.com"},
+			opts:       trusted,
+			expected:   "http://example.com/login",
+		},
+		{
+			name:     "escaped path preserved",
+			target:   "/files/a%2Fb",
+			host:     "example.com",
+			expected: "http://example.com/files/a%2Fb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			r.Host = tt.host
+			r.TLS = nil
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := ExternalURL(r, tt.opts).String(); got != tt.expected {
+				t.Errorf("ExternalURL() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExternalURL_NilRequest(t *testing.T) {
+	if got := ExternalURL(nil, HostOptions{}); got != nil {
+		t.Errorf("ExternalURL(nil) = %v, want nil", got)
+	}
+}
+
+func TestFirstForwardedElement(t *testing.T) {
+	got := firstForwardedElement([]string{`For="[2001:db8::1]:4711";Proto=HTTPS;host="a\"b", for=10.0.0.1`})
+	if got["for"] != "[2001:db8::1]:4711" || got["proto"] != "HTTPS" || got["host"] != `a"b` {
+		t.Errorf("firstForwardedElement() = %v", got)
+	}
+	if _, ok := firstForwardedElement([]string{"for=1.2.3.4, proto=https"})["proto"]; ok {
+		t.Error("firstForwardedElement() read a parameter of the second element")
+	}
+}
@@ -0,0 +1,118 @@
+package req
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fileStamp identifies a version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFileStamp returns the current stamp of a file.
+func statFileStamp(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// runEvery calls fn at every interval until stop is closed.
+func runEvery(interval time.Duration, stop <-chan struct{}, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// fileReloader holds the parsed contents of a file and replaces them when
+// the file changes, without interrupting concurrent readers. File backed
+// types embed it for their Reload and Close methods.
+type fileReloader[T any] struct {
+	path  string
+	parse func(data []byte) (T, error)
+	value atomic.Pointer[T]
+
+	mu    sync.Mutex // serializes reloads
+	stamp fileStamp
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// open loads the file. If reloadInterval is positive, the file is checked
+// for changes at that interval until Close is called.
+func (f *fileReloader[T]) open(path string, reloadInterval time.Duration, parse func(data []byte) (T, error)) error {
+	f.path, f.parse, f.stop = path, parse, make(chan struct{})
+	if err := f.load(); err != nil {
+		return err
+	}
+	if reloadInterval > 0 {
+		go runEvery(reloadInterval, f.stop, func() { _ = f.Reload() })
+	}
+	return nil
+}
+
+// current returns the contents of the last successful load.
+func (f *fileReloader[T]) current() T {
+	return *f.value.Load()
+}
+
+// Reload rereads the file if its modification time or size changed.
+// If the file is invalid, the previous contents stay in use and the error
+// is returned.
+func (f *fileReloader[T]) Reload() error {
+	stamp, err := statFileStamp(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	unchanged := stamp == f.stamp
+	f.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	return f.load()
+}
+
+// Close stops automatic reloading.
+func (f *fileReloader[T]) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	return nil
+}
+
+// load reads and parses the file.
+func (f *fileReloader[T]) load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stamp, err := statFileStamp(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	value, err := f.parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+
+	f.value.Store(&value)
+	f.stamp = stamp
+	return nil
+}
@@ -0,0 +1,367 @@
+package req
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrGeoNotFound is returned when an IP address is not in any database.
+var ErrGeoNotFound = errors.New("req: IP address not found in geolocation databases")
+
+// GeoInfo holds geolocation and network ownership details for an IP address.
+type GeoInfo struct {
+	IP           string
+	CountryCode  string // ISO 3166-1 alpha-2, e.g. "DE"
+	CountryName  string
+	RegionCode   string // ISO 3166-2 subdivision code without country, e.g. "BE"
+	RegionName   string
+	City         string
+	Latitude     float64
+	Longitude    float64
+	ASN          uint
+	Organization string
+}
+
+// GeoSource is a geolocation database that can be queried by GeoLocator.
+// Implementations must be safe for concurrent use.
+type GeoSource interface {
+	LookupGeo(ip net.IP) (GeoInfo, bool, error)
+}
+
+// GeoLocatorOptions configures NewGeoLocator.
+type GeoLocatorOptions struct {
+	// Files lists the databases to query, in order. Files ending in ".csv"
+	// are read with OpenGeoCSV, all others with OpenMMDB. Results from
+	// several files are merged, so a City and an ASN database can be combined.
+	Files []string
+	// ReloadInterval is how often files are checked for changes. Zero disables
+	// automatic reloading; Reload can still be called explicitly.
+	ReloadInterval time.Duration
+}
+
+// GeoLocator looks up geolocation and ASN details from local database files.
+// It works fully offline, reloads files when they change and is safe for
+// concurrent use: lookups never block on a reload.
+type GeoLocator struct {
+	files []*fileReloader[GeoSource]
+}
+
+// NewGeoLocator opens the configured database files.
+//
+// Example:
+//
+//	geo, err := req.NewGeoLocator(req.GeoLocatorOptions{
+//	    Files:          []string{"GeoLite2-City.mmdb", "GeoLite2-ASN.mmdb"},
+//	    ReloadInterval: time.Minute,
+//	})
+//	info, err := geo.LookupRequest(r, req.IPOptions{})
+func NewGeoLocator(opts GeoLocatorOptions) (*GeoLocator, error) {
+	l := &GeoLocator{}
+	for _, path := range opts.Files {
+		file := &fileReloader[GeoSource]{}
+		if err := file.open(path, opts.ReloadInterval, geoFileParser(path)); err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.files = append(l.files, file)
+	}
+	return l, nil
+}
+
+// Lookup returns the merged geolocation details for ip, which is
+// normalized with NormalizeIP first.
+func (l *GeoLocator) Lookup(ip string) (GeoInfo, error) {
+	normalized := NormalizeIP(ip)
+	parsed := net.ParseIP(normalized)
+	if parsed == nil {
+		return GeoInfo{}, fmt.Errorf("req: invalid IP address %q", ip)
+	}
+
+	info := GeoInfo{IP: normalized}
+	found := false
+	for _, file := range l.files {
+		result, ok, err := file.current().LookupGeo(parsed)
+		if err != nil {
+			return GeoInfo{}, err
+		}
+		if ok {
+			mergeGeoInfo(&info, result)
+			found = true
+		}
+	}
+	if !found {
+		return info, ErrGeoNotFound
+	}
+	return info, nil
+}
+
+// LookupRequest looks up the client IP of a request, as determined by
+// GetIPCandidateWithOptions.
+func (l *GeoLocator) LookupRequest(r *http.Request, opts IPOptions) (GeoInfo, error) {
+	return l.Lookup(GetIPCandidateWithOptions(r, opts).IP)
+}
+
+// Reload reopens database files whose modification time or size changed.
+// If a file fails to load, the previous version stays in use and the
+// error is returned.
+func (l *GeoLocator) Reload() error {
+	var errs []error
+	for _, file := range l.files {
+		if err := file.Reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops automatic reloading.
+func (l *GeoLocator) Close() error {
+	for _, file := range l.files {
+		file.Close()
+	}
+	return nil
+}
+
+// geoFileParser returns the parser for a database file based on its
+// extension.
+func geoFileParser(path string) func(data []byte) (GeoSource, error) {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return func(data []byte) (GeoSource, error) {
+			return NewGeoCSV(bytes.NewReader(data))
+		}
+	}
+	return func(data []byte) (GeoSource, error) {
+		return NewMMDBReader(data)
+	}
+}
+
+// mergeGeoInfo copies the non-empty fields of src into dst.
+func mergeGeoInfo(dst *GeoInfo, src GeoInfo) {
+	setString := func(d *string, s string) {
+		if *d == "" && s != "" {
+			*d = s
+		}
+	}
+	setString(&dst.CountryCode, src.CountryCode)
+	setString(&dst.CountryName, src.CountryName)
+	setString(&dst.RegionCode, src.RegionCode)
+	setString(&dst.RegionName, src.RegionName)
+	setString(&dst.City, src.City)
+	setString(&dst.Organization, src.Organization)
+	if dst.Latitude == 0 && dst.Longitude == 0 {
+		dst.Latitude, dst.Longitude = src.Latitude, src.Longitude
+	}
+	if dst.ASN == 0 {
+		dst.ASN = src.ASN
+	}
+}
+
+// geoInfoFromMMDB extracts GeoInfo from a GeoIP2/GeoLite2 record.
+func geoInfoFromMMDB(record map[string]any) GeoInfo {
+	info := GeoInfo{}
+
+	country, ok := record["country"].(map[string]any)
+	if !ok {
+		country, _ = record["registered_country"].(map[string]any)
+	}
+	info.CountryCode = mmdbString(country["iso_code"])
+	info.CountryName = mmdbName(country)
+
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		subdivision, _ := subdivisions[0].(map[string]any)
+		info.RegionCode = mmdbString(subdivision["iso_code"])
+		info.RegionName = mmdbName(subdivision)
+	}
+
+	city, _ := record["city"].(map[string]any)
+	info.City = mmdbName(city)
+
+	if location, ok := record["location"].(map[string]any); ok {
+		info.Latitude, _ = location["latitude"].(float64)
+		info.Longitude, _ = location["longitude"].(float64)
+	}
+
+	info.ASN = uint(mmdbUint(record["autonomous_system_number"]))
+	info.Organization = mmdbString(record["autonomous_system_organization"])
+	if info.Organization == "" {
+		info.Organization = mmdbString(record["organization"])
+	}
+
+	return info
+}
+
+// mmdbName returns the English name of a GeoIP2 entity, or any name if no
+// English one is present.
+func mmdbName(entity map[string]any) string {
+	names, ok := entity["names"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	if en := mmdbString(names["en"]); en != "" {
+		return en
+	}
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := mmdbString(names[k]); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// GeoCSV is an in-memory geolocation database loaded from a CSV file with
+// the columns:
+//
+//	start_ip,end_ip,country_code,region,city,asn,organization
+//
+// start_ip may also be a CIDR, in which case end_ip is left empty. Trailing
+// columns are optional, lines starting with '#' are comments and a header
+// line is skipped. Ranges must not overlap. A GeoCSV is safe for
+// concurrent use.
+type GeoCSV struct {
+	ranges []geoCSVRange
+}
+
+// geoCSVRange is a single row of a GeoCSV database.
+type geoCSVRange struct {
+	start [16]byte
+	end   [16]byte
+	info  GeoInfo
+}
+
+// OpenGeoCSV reads a CSV range database from disk.
+func OpenGeoCSV(path string) (*GeoCSV, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGeoCSV(bytes.NewReader(data))
+}
+
+// NewGeoCSV reads a CSV range database from r.
+func NewGeoCSV(r io.Reader) (*GeoCSV, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	db := &GeoCSV{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, end, ok := parseGeoCSVRange(record)
+		if !ok {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("req: invalid IP range on CSV line %d", line)
+		}
+
+		field := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		asn, _ := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(field(5)), "AS"), 10, 32)
+
+		db.ranges = append(db.ranges, geoCSVRange{
+			start: start,
+			end:   end,
+			info: GeoInfo{
+				CountryCode:  field(2),
+				RegionName:   field(3),
+				City:         field(4),
+				ASN:          uint(asn),
+				Organization: field(6),
+			},
+		})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start[:], db.ranges[j].start[:]) < 0
+	})
+	return db, nil
+}
+
+// LookupGeo implements GeoSource.
+func (db *GeoCSV) LookupGeo(ip net.IP) (GeoInfo, bool, error) {
+	key, ok := ipKey(ip)
+	if !ok {
+		return GeoInfo{}, false, fmt.Errorf("req: invalid IP address")
+	}
+
+	// Find the last range starting at or before ip
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start[:], key[:]) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(key[:], db.ranges[i].end[:]) > 0 {
+		return GeoInfo{}, false, nil
+	}
+	return db.ranges[i].info, true, nil
+}
+
+// parseGeoCSVRange parses the start and end columns of a CSV row.
+func parseGeoCSVRange(record []string) ([16]byte, [16]byte, bool) {
+	var start, end [16]byte
+	if len(record) == 0 {
+		return start, end, false
+	}
+
+	first := strings.TrimSpace(record[0])
+	if strings.Contains(first, "/") {
+		_, network, err := net.ParseCIDR(first)
+		if err != nil {
+			return start, end, false
+		}
+		last := make(net.IP, len(network.IP))
+		for i := range network.IP {
+			last[i] = network.IP[i] | ^network.Mask[i]
+		}
+		start, ok1 := ipKey(network.IP)
+		end, ok2 := ipKey(last)
+		return start, end, ok1 && ok2
+	}
+
+	if len(record) < 2 {
+		return start, end, false
+	}
+	start, ok1 := ipKey(net.ParseIP(first))
+	end, ok2 := ipKey(net.ParseIP(strings.TrimSpace(record[1])))
+	if !ok1 || !ok2 || bytes.Compare(start[:], end[:]) > 0 {
+		return start, end, false
+	}
+	return start, end, true
+}
+
+// ipKey returns the 16-byte form of ip for ordered comparisons.
+func ipKey(ip net.IP) ([16]byte, bool) {
+	var key [16]byte
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return key, false
+	}
+	copy(key[:], ip16)
+	return key, true
+}
@@ -0,0 +1,446 @@
+package req
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mmdbTestWriter encodes values in the MaxMind DB data section format.
+type mmdbTestWriter struct {
+	buf []byte
+}
+
+func (w *mmdbTestWriter) ctrl(typ byte, size int) {
+	var sizeBits byte
+	var extra []byte
+	switch {
+	case size < 29:
+		sizeBits = byte(size)
+	case size < 285:
+		sizeBits = 29
+		extra = []byte{byte(size - 29)}
+	default:
+		sizeBits = 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	}
+	if typ > 7 {
+		w.buf = append(w.buf, sizeBits, typ-7)
+	} else {
+		w.buf = append(w.buf, typ<<5|sizeBits)
+	}
+	w.buf = append(w.buf, extra...)
+}
+
+func (w *mmdbTestWriter) str(s string) {
+	w.ctrl(2, len(s))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *mmdbTestWriter) uint(typ byte, v uint64) {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	w.ctrl(typ, len(b))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *mmdbTestWriter) double(v float64) {
+	w.ctrl(3, 8)
+	w.buf = binary.BigEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+func (w *mmdbTestWriter) pointer(offset int) {
+	w.buf = append(w.buf, 1<<5|byte(offset>>8)&0x7, byte(offset))
+}
+
+// value encodes maps (as ordered key/value slices), arrays, strings and numbers.
+func (w *mmdbTestWriter) value(v any) {
+	switch x := v.(type) {
+	case string:
+		w.str(x)
+	case uint32:
+		w.uint(6, uint64(x))
+	case uint16:
+		w.uint(5, uint64(x))
+	case float64:
+		w.double(x)
+	case mmdbTestPointer:
+		w.pointer(int(x))
+	case []any:
+		w.ctrl(11, len(x))
+		for _, e := range x {
+			w.value(e)
+		}
+	case mmdbTestMap:
+		w.ctrl(7, len(x)/2)
+		for i := 0; i < len(x); i += 2 {
+			w.value(x[i])
+			w.value(x[i+1])
+		}
+	default:
+		panic("unsupported test value")
+	}
+}
+
+type mmdbTestMap []any
+type mmdbTestPointer int
+
+type mmdbTestNode struct {
+	children [2]*mmdbTestNode
+	data     [2]int
+}
+
+// buildTestMMDB builds a database mapping each CIDR to the data at the given
+// offset within the encoded records.
+func buildTestMMDB(t *testing.T, ipVersion int, recordSize int, records []any, networks map[string]int) []byte {
+	t.Helper()
+
+	data := &mmdbTestWriter{}
+	offsets := make([]int, len(records))
+	for i, r := range records {
+		offsets[i] = len(data.buf)
+		data.value(r)
+	}
+
+	root := &mmdbTestNode{data: [2]int{-1, -1}}
+	for cidr, record := range networks {
+		ip, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		key := []byte(ip.To16())
+		if ipVersion == 4 {
+			key = ip.To4()
+		} else if ip.To4() != nil {
+			// IPv4 networks live under ::/96
+			key = append(make([]byte, 12), ip.To4()...)
+			ones += 96
+		}
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := (key[i/8] >> (7 - i%8)) & 1
+			if i == ones-1 {
+				node.data[bit] = offsets[record]
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &mmdbTestNode{data: [2]int{-1, -1}}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	var nodes []*mmdbTestNode
+	index := map[*mmdbTestNode]int{}
+	var walk func(n *mmdbTestNode)
+	walk = func(n *mmdbTestNode) {
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil {
+				walk(c)
+			}
+		}
+	}
+	walk(root)
+
+	nodeCount := len(nodes)
+	var tree []byte
+	for _, n := range nodes {
+		var rec [2]uint32
+		for bit := 0; bit < 2; bit++ {
+			switch {
+			case n.children[bit] != nil:
+				rec[bit] = uint32(index[n.children[bit]])
+			case n.data[bit] >= 0:
+				rec[bit] = uint32(nodeCount + 16 + n.data[bit])
+			default:
+				rec[bit] = uint32(nodeCount)
+			}
+		}
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]),
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		case 28:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]),
+				byte(rec[0]>>24)<<4|byte(rec[1]>>24)&0x0f,
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, rec[0])
+			tree = binary.BigEndian.AppendUint32(tree, rec[1])
+		}
+	}
+
+	meta := &mmdbTestWriter{}
+	meta.value(mmdbTestMap{
+		"node_count", uint32(nodeCount),
+		"record_size", uint16(recordSize),
+		"ip_version", uint16(ipVersion),
+		"database_type", "Test-City",
+		"languages", []any{"en"},
+		"binary_format_major_version", uint16(2),
+		"binary_format_minor_version", uint16(0),
+		"build_epoch", uint32(1700000000),
+		"description", mmdbTestMap{"en", "Test database"},
+	})
+
+	out := append(tree, make([]byte, 16)...)
+	out = append(out, data.buf...)
+	out = append(out, mmdbMetadataMarker...)
+	return append(out, meta.buf...)
+}
+
+func testCityRecords() []any {
+	london := mmdbTestMap{
+		"city", mmdbTestMap{"names", mmdbTestMap{"en", "London", "de", "London"}},
+		"country", mmdbTestMap{"iso_code", "GB", "names", mmdbTestMap{"en", "United Kingdom"}},
+		"subdivisions", []any{mmdbTestMap{"iso_code", "ENG", "names", mmdbTestMap{"en", "England"}}},
+		"location", mmdbTestMap{"latitude", 51.5142, "longitude", -0.0931},
+	}
+	// The country map of the first record starts after its first key/value pair
+	countryOffset := func() int {
+		w := &mmdbTestWriter{}
+		w.ctrl(7, 4)
+		w.value("city")
+		w.value(london[1])
+		w.value("country")
+		return len(w.buf)
+	}()
+	berlin := mmdbTestMap{
+		"city", mmdbTestMap{"names", mmdbTestMap{"de", "Berlin"}},
+		"registered_country", mmdbTestPointer(countryOffset),
+	}
+	return []any{london, berlin}
+}
+
+func TestMMDBReader_IPv6Database(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		buf := buildTestMMDB(t, 6, recordSize, testCityRecords(), map[string]int{
+			"81.2.69.0/24":  0,
+			"2a02:db8::/32": 1,
+		})
+		reader, err := NewMMDBReader(buf)
+		if err != nil {
+			t.Fatalf("record size %d: %v", recordSize, err)
+		}
+
+		meta := reader.Metadata()
+		if meta.DatabaseType != "Test-City" || meta.IPVersion != 6 || meta.Description["en"] != "Test database" {
+			t.Fatalf("unexpected metadata %+v", meta)
+		}
+
+		info, found, err := reader.LookupGeo(net.ParseIP("81.2.69.160"))
+		if err != nil || !found {
+			t.Fatalf("record size %d: expected record, got %v, %v", recordSize, found, err)
+		}
+		if info.CountryCode != "GB" || info.City != "London" || info.RegionCode != "ENG" || info.RegionName != "England" {
+			t.Fatalf("unexpected info %+v", info)
+		}
+		if info.Latitude != 51.5142 || info.Longitude != -0.0931 {
+			t.Fatalf("unexpected location %v,%v", info.Latitude, info.Longitude)
+		}
+
+		info, found, err = reader.LookupGeo(net.ParseIP("2a02:db8::1"))
+		if err != nil || !found {
+			t.Fatalf("expected IPv6 record, got %v, %v", found, err)
+		}
+		if info.City != "Berlin" || info.CountryCode != "GB" {
+			t.Fatalf("expected pointer to be followed, got %+v", info)
+		}
+
+		_, found, err = reader.LookupGeo(net.ParseIP("8.8.8.8"))
+		if err != nil || found {
+			t.Fatalf("expected no record, got %v, %v", found, err)
+		}
+	}
+}
+
+func TestMMDBReader_IPv4Database(t *testing.T) {
+	buf := buildTestMMDB(t, 4, 24, testCityRecords(), map[string]int{"81.2.69.0/24": 0})
+	reader, err := NewMMDBReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := reader.Lookup(net.ParseIP("81.2.69.1")); err != nil || !found {
+		t.Fatalf("expected record, got %v, %v", found, err)
+	}
+	if _, _, err := reader.Lookup(net.ParseIP("2001:db8::1")); !errors.Is(err, ErrMMDBIPv6) {
+		t.Fatalf("expected ErrMMDBIPv6 for IPv6 lookup in IPv4 database, got %v", err)
+	}
+	if _, found, err := reader.LookupGeo(net.ParseIP("2001:db8::1")); err != nil || found {
+		t.Fatalf("expected LookupGeo miss for IPv6 in IPv4 database, got %v, %v", found, err)
+	}
+}
+
+func TestGeoLocator_IPv6WithIPv4Database(t *testing.T) {
+	dir := t.TempDir()
+	cityPath := filepath.Join(dir, "city.mmdb")
+	asnPath := filepath.Join(dir, "asn.csv")
+	writeFile(t, cityPath, string(buildTestMMDB(t, 4, 24, testCityRecords(), map[string]int{"81.2.69.0/24": 0})))
+	writeFile(t, asnPath, "2001:db8::/32,,,,,64496,Example\n")
+
+	geo, err := NewGeoLocator(GeoLocatorOptions{Files: []string{cityPath, asnPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+
+	info, err := geo.Lookup("2001:db8::1")
+	if err != nil || info.ASN != 64496 {
+		t.Fatalf("Lookup() = %+v, %v, want the CSV answer", info, err)
+	}
+	if _, err := geo.Lookup("2001:db9::1"); !errors.Is(err, ErrGeoNotFound) {
+		t.Fatalf("expected ErrGeoNotFound, got %v", err)
+	}
+}
+
+func TestMMDBReader_Invalid(t *testing.T) {
+	if _, err := NewMMDBReader([]byte("not a database")); !errors.Is(err, ErrInvalidMMDB) {
+		t.Fatalf("expected ErrInvalidMMDB, got %v", err)
+	}
+
+	buf := buildTestMMDB(t, 6, 24, testCityRecords(), map[string]int{"2a02:db8::/32": 1})
+	markerAt := bytes.LastIndex(buf, mmdbMetadataMarker)
+
+	// Truncating the last record must be reported, not panic
+	truncated := append(append([]byte{}, buf[:markerAt-20]...), buf[markerAt:]...)
+	reader, err := NewMMDBReader(truncated)
+	if err == nil {
+		_, _, err = reader.Lookup(net.ParseIP("2a02:db8::1"))
+	}
+	if err == nil {
+		t.Fatal("expected error for truncated database")
+	}
+}
+
+func TestGeoCSV(t *testing.T) {
+	db, err := NewGeoCSV(strings.NewReader(`start_ip,end_ip,country_code,region,city,asn,organization
+# comment
+1.0.0.0,1.0.0.255,AU,Queensland,Brisbane,AS13335,Cloudflare
+8.8.8.0/24,,US,California,Mountain View,15169,Google
+2001:4860::,2001:4860:ffff:ffff:ffff:ffff:ffff:ffff,US,,,15169,Google
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, found, _ := db.LookupGeo(net.ParseIP("1.0.0.77"))
+	if !found || info.CountryCode != "AU" || info.City != "Brisbane" || info.ASN != 13335 || info.Organization != "Cloudflare" {
+		t.Fatalf("unexpected info %+v (found %v)", info, found)
+	}
+	info, found, _ = db.LookupGeo(net.ParseIP("8.8.8.8"))
+	if !found || info.ASN != 15169 {
+		t.Fatalf("unexpected info %+v (found %v)", info, found)
+	}
+	info, found, _ = db.LookupGeo(net.ParseIP("2001:4860::8888"))
+	if !found || info.Organization != "Google" {
+		t.Fatalf("unexpected info %+v (found %v)", info, found)
+	}
+	if _, found, _ := db.LookupGeo(net.ParseIP("1.0.1.0")); found {
+		t.Fatal("expected no match outside the ranges")
+	}
+
+	if _, err := NewGeoCSV(strings.NewReader("1.0.0.0,1.0.0.255,AU\nbad,row\n")); err == nil {
+		t.Fatal("expected error for invalid row")
+	}
+}
+
+func TestGeoLocator_MergeAndLookupRequest(t *testing.T) {
+	dir := t.TempDir()
+	cityPath := filepath.Join(dir, "city.mmdb")
+	asnPath := filepath.Join(dir, "asn.csv")
+	writeFile(t, cityPath, string(buildTestMMDB(t, 6, 28, testCityRecords(), map[string]int{"81.2.69.0/24": 0})))
+	writeFile(t, asnPath, "81.2.69.0/24,,,,,20712,Andrews & Arnold\n")
+
+	geo, err := NewGeoLocator(GeoLocatorOptions{Files: []string{cityPath, asnPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-FORWARDED-FOR", "81.2.69.142:5555")
+	info, err := geo.LookupRequest(r, IPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IP != "81.2.69.142" || info.City != "London" || info.ASN != 20712 || info.Organization != "Andrews & Arnold" {
+		t.Fatalf("unexpected merged info %+v", info)
+	}
+
+	if _, err := geo.Lookup("8.8.8.8"); !errors.Is(err, ErrGeoNotFound) {
+		t.Fatalf("expected ErrGeoNotFound, got %v", err)
+	}
+	if _, err := geo.Lookup("garbage"); err == nil {
+		t.Fatal("expected error for invalid IP")
+	}
+}
+
+func TestGeoLocator_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ranges.csv")
+	writeFile(t, path, "1.0.0.0,1.0.0.255,AU\n")
+
+	geo, err := NewGeoLocator(GeoLocatorOptions{Files: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				geo.Lookup("1.0.0.1")
+			}
+		}()
+	}
+
+	writeFile(t, path, "1.0.0.0,1.0.0.255,NZ\n")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := geo.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	info, err := geo.Lookup("1.0.0.1")
+	if err != nil || info.CountryCode != "NZ" {
+		t.Fatalf("expected reloaded data, got %+v, %v", info, err)
+	}
+
+	// A broken file keeps the previous version
+	writeFile(t, path, "1.0.0.0,1.0.0.255,AU\nbroken\n")
+	future = future.Add(time.Hour)
+	os.Chtimes(path, future, future)
+	if err := geo.Reload(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	if info, _ := geo.Lookup("1.0.0.1"); info.CountryCode != "NZ" {
+		t.Fatalf("expected previous data to stay in use, got %+v", info)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
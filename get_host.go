@@ -0,0 +1,152 @@
+package req
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultBaseDomains are the base domains used when HostOptions.BaseDomains
+// is nil, so that "api.localhost" has the subdomain "api".
+var DefaultBaseDomains = []string{"localhost"}
+
+// HostOptions controls how the request host is resolved.
+type HostOptions struct {
+	// TrustedProxies lists CIDRs or IPs of proxies allowed to set
+	// X-Forwarded-Host. The header is ignored unless the direct peer
+	// (RemoteAddr) is in this list.
+	TrustedProxies []string
+	// BaseDomains are development or internal domains, e.g. "localhost" or
+	// "test", whose labels are treated like a registrable domain: for the
+	// base domain "test", "api.test" has the subdomain "api". The longest
+	// matching base domain wins. Nil means DefaultBaseDomains.
+	BaseDomains []string
+}
+
+// GetHost returns the normalized host of the request, without port.
+//
+// Business logic:
+// - r.Host is used, falling back to r.URL.Host for client-side requests
+// - the host is normalized with NormalizeHost
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//
+// Returns:
+//   - string: the host, or an empty string if none found
+func GetHost(r *http.Request) string {
+	return GetHostWithOptions(r, HostOptions{})
+}
+
+// GetHostWithOptions returns the normalized host of the request, honoring
+// X-Forwarded-Host when the direct peer is a trusted proxy.
+//
+// Business logic:
+// - if RemoteAddr is in opts.TrustedProxies, the first X-Forwarded-Host value is used
+// - a forwarded value that is not an IP literal or a valid host name, such as "evil.com/x", is ignored
+// - otherwise r.Host is used, falling back to r.URL.Host
+// - the host is normalized with NormalizeHost
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - opts (HostOptions): Proxy trust configuration
+//
+// Returns:
+//   - string: the host, or an empty string if none found
+func GetHostWithOptions(r *http.Request, opts HostOptions) string {
+	if r == nil {
+		return ""
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && isTrustedProxy(r, opts.TrustedProxies) {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if isValidForwardedHost(first) {
+			return NormalizeHost(first)
+		}
+	}
+
+	if host := NormalizeHost(r.Host); host != "" {
+		return host
+	}
+	if r.URL != nil {
+		return NormalizeHost(r.URL.Host)
+	}
+	return ""
+}
+
+// NormalizeHost cleans up a Host header value.
+//
+// Business logic:
+// - surrounding whitespace is removed and the host is lowercased
+// - a port is stripped ("example.com:8080", "[::1]:443")
+// - square brackets around IPv6 literals are stripped; anything else in brackets is malformed
+// - a trailing dot is removed ("example.com.")
+// - internationalized names are converted to punycode ("bücher.example" becomes "xn--bcher-kva.example")
+//
+// Parameters:
+//   - raw: The value to normalize
+//
+// Returns:
+//   - string: the normalized host, or an empty string if raw is malformed
+func NormalizeHost(raw string) string {
+	host := strings.ToLower(strings.TrimSpace(raw))
+	if host == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end == -1 {
+			return ""
+		}
+		rest := host[end+1:]
+		if rest != "" && rest != ":" && !isPortSuffix(rest) {
+			return ""
+		}
+		if literal := host[1:end]; !strings.Contains(literal, ":") || net.ParseIP(stripZone(literal)) == nil {
+			return ""
+		}
+		return host[1:end]
+	}
+
+	switch strings.Count(host, ":") {
+	case 0:
+	case 1:
+		i := strings.Index(host, ":")
+		if rest := host[i:]; rest != ":" && !isPortSuffix(rest) {
+			return ""
+		}
+		host = host[:i]
+	default:
+		// Bare IPv6 literal
+		if net.ParseIP(stripZone(host)) == nil {
+			return ""
+		}
+		return host
+	}
+
+	return canonicalDomain(host)
+}
+
+// IsIPHost reports whether host is an IPv4 or IPv6 literal, with or without
+// port or brackets.
+func IsIPHost(host string) bool {
+	host = NormalizeHost(host)
+	return host != "" && net.ParseIP(stripZone(host)) != nil
+}
+
+// isTrustedProxy reports whether the direct peer is in the trusted list.
+func isTrustedProxy(r *http.Request, trustedProxies []string) bool {
+	if len(trustedProxies) == 0 {
+		return false
+	}
+	return containsIP(parseCIDRs(trustedProxies), NormalizeIP(r.RemoteAddr))
+}
+
+// stripZone removes an IPv6 zone ("fe80::1%eth0").
+func stripZone(host string) string {
+	if i := strings.Index(host, "%"); i != -1 {
+		return host[:i]
+	}
+	return host
+}
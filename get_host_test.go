@@ -0,0 +1,152 @@
+package req
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{raw: "example.com", expected: "example.com"},
+		{raw: " Example.COM:8080 ", expected: "example.com"},
+		{raw: "example.com.", expected: "example.com"},
+		{raw: "Bücher.example:8080", expected: "xn--bcher-kva.example"},
+		{raw: "example.com:", expected: "example.com"},
+		{raw: "127.0.0.1:8080", expected: "127.0.0.1"},
+		{raw: "[::1]:443", expected: "::1"},
+		{raw: "[2001:DB8::1]", expected: "2001:db8::1"},
+		{raw: "2001:db8::1", expected: "2001:db8::1"},
+		{raw: "example.com:http", expected: ""},
+		{raw: "[::1", expected: ""},
+		{raw: "[::1]x", expected: ""},
+		{raw: "[a/b]", expected: ""},
+		{raw: "[127.0.0.1]:80", expected: ""},
+		{raw: "a:b:c", expected: ""},
+		{raw: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := NormalizeHost(tt.raw); got != tt.expected {
+				t.Errorf("NormalizeHost(%q) = %q, want %q", tt.raw, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsIPHost(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":      true,
+		"127.0.0.1:8080": true,
+		"[::1]:443":      true,
+		"fe80::1%eth0":   true,
+		"example.com":    false,
+		"localhost":      false,
+		"":               false,
+	}
+	for host, expected := range tests {
+		if got := IsIPHost(host); got != expected {
+			t.Errorf("IsIPHost(%q) = %v, want %v", host, got, expected)
+		}
+	}
+}
+
+func TestGetHostWithOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		forwarded  string
+		opts       HostOptions
+		expected   string
+	}{
+		{
+			name:     "host with port",
+			host:     "api.example.com:8080",
+			expected: "api.example.com",
+		},
+		{
+			name:       "forwarded host ignored without trusted proxies",
+			host:       "internal:8080",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "api.example.com",
+			expected:   "internal",
+		},
+		{
+			name:       "forwarded host ignored from untrusted peer",
+			host:       "internal:8080",
+			remoteAddr: "203.0.113.9:1234",
+			forwarded:  "evil.example.com",
+			opts:       HostOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+			expected:   "internal",
+		},
+		{
+			name:       "forwarded host from trusted proxy",
+			host:       "internal:8080",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "API.example.com:443, proxy.internal",
+			opts:       HostOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+			expected:   "api.example.com",
+		},
+		{
+			name:       "malformed forwarded host falls back",
+			host:       "internal",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "[::1",
+			opts:       HostOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+			expected:   "internal",
+		},
+		{
+			name:       "forwarded host with a path falls back",
+			host:       "internal",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "evil.com/x",
+			opts:       HostOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+			expected:   "internal",
+		},
+		{
+			name:       "forwarded IPv6 literal",
+			host:       "internal",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "[2001:db8::1]:8443",
+			opts:       HostOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+			expected:   "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Host = tt.host
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-Host", tt.forwarded)
+			}
+
+			if got := GetHostWithOptions(r, tt.opts); got != tt.expected {
+				t.Errorf("GetHostWithOptions() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetHost_URLFallback(t *testing.T) {
+	u, err := url.Parse("http://sub.example.com:8080/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &http.Request{URL: u}
+	if got := GetHost(r); got != "sub.example.com" {
+		t.Errorf("GetHost() = %q, want %q", got, "sub.example.com")
+	}
+	if got := GetHost(nil); got != "" {
+		t.Errorf("GetHost(nil) = %q, want \"\"", got)
+	}
+}
@@ -1,13 +1,13 @@
 package req
 
-import (
-	"net"
-	"net/http"
-	"strings"
-)
+import "net/http"
 
 // IsPrivateIP checks if an IP address is in a private network range.
-// It supports both IPv4 and IPv6 addresses.
+// It supports both IPv4 and IPv6 addresses, including IPv4-mapped IPv6.
+//
+// Private ranges are private-use (RFC 1918, IPv6 ULA), shared carrier-grade
+// NAT space (100.64.0.0/10) and link-local addresses. Use IPClass for a
+// finer-grained classification.
 //
 // Parameters:
 //   - ipStr: The IP address to check (can be in string format)
@@ -15,90 +15,53 @@ import (
 // Returns:
 //   - bool: true if the IP is in a private range, false otherwise
 func IsPrivateIP(ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
+	switch IPClass(ipStr) {
+	case IPPrivate, IPShared, IPLinkLocal:
+		return true
+	default:
 		return false
 	}
-
-	// Check for IPv4 private ranges
-	if ip4 := ip.To4(); ip4 != nil {
-		switch {
-		case ip4[0] == 10: // 10.0.0.0/8
-			return true
-		case ip4[0] == 172 && ip4[1] >= 16 && ip4[1] <= 31: // 172.16.0.0/12
-			return true
-		case ip4[0] == 192 && ip4[1] == 168: // 192.168.0.0/16
-			return true
-		case ip4[0] == 100 && (ip4[1]&0b11000000) == 64: // 100.64.0.0/10 (Carrier-grade NAT)
-			return true
-		default:
-			return false
-		}
-	}
-
-	// Check for IPv6 private ranges (ULA - Unique Local Addresses)
-	if ip.To16() != nil {
-		// fc00::/7 - Unique Local Addresses (includes fc00::/8 and fd00::/8)
-		if len(ip) == net.IPv6len && ip[0]&0xfe == 0xfc {
-			return true
-		}
-		// fe80::/10 - Link-local addresses
-		if len(ip) == net.IPv6len && ip[0] == 0xfe && (ip[1]&0xc0) == 0x80 {
-			return true
-		}
-	}
-
-	return false
 }
 
 // GetIP gets the IP address for the user by checking X-REAL-IP, X-FORWARDED-FOR headers,
 // and finally falling back to RemoteAddr. For X-FORWARDED-FOR, it returns the first
-// non-private IP address in the chain, or the last IP if all are private.
+// public IP address in the chain (see IsPublicIP), or the last IP if none is public.
+//
+// Every candidate is normalized with NormalizeIP, so ports, brackets, quotes and
+// zones are stripped. Use GetIPCandidate to access the raw header value.
 func GetIP(r *http.Request) string {
+	return GetIPCandidate(r).Value()
+}
+
+// GetIPCandidate works like GetIP but returns the selected candidate, including
+// its raw value and the header it was read from.
+func GetIPCandidate(r *http.Request) IPCandidate {
 	// Get IP from the X-REAL-IP header
-	realIP := r.Header.Get("X-REAL-IP")
-	if realIP != "" {
+	realIP := newIPCandidate(r.Header.Get("X-REAL-IP"), IPSourceRealIP)
+	if realIP.Raw != "" {
 		return realIP
 	}
 
 	// Get IP from X-FORWARDED-FOR header
-	forwarded := r.Header.Get("X-FORWARDED-FOR")
-	if forwarded != "" {
-		// Split the header value by commas and trim whitespace
-		splitIps := strings.Split(forwarded, ",")
-		var lastIP string
-
-		// Iterate through all IPs in the X-FORWARDED-FOR header
-		for _, ipStr := range splitIps {
-			ipStr = strings.TrimSpace(ipStr)
-			if ipStr == "" {
-				continue
-			}
-
-			// Store the last valid IP in case all are private
-			lastIP = ipStr
+	var last IPCandidate
+	for _, candidate := range splitForwardedFor(r.Header.Get("X-FORWARDED-FOR")) {
+		// Store the last IP in case none is public
+		last = candidate
 
-			// Skip private IPs
-			if IsPrivateIP(ipStr) {
-				continue
-			}
-
-			// Return the first non-private IP
-			return ipStr
+		// Skip private, loopback, reserved and other non-public IPs
+		if !IsPublicIP(candidate.IP) {
+			continue
 		}
 
-		// If we get here, all IPs were private or empty, return the last one
-		if lastIP != "" {
-			return lastIP
-		}
+		// Return the first public IP
+		return candidate
 	}
 
-	// Fall back to RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		// If SplitHostPort fails, try using RemoteAddr as is
-		return r.RemoteAddr
+	// If we get here, no IP was public, return the last one
+	if last.Raw != "" {
+		return last
 	}
 
-	return host
+	// Fall back to RemoteAddr
+	return newIPCandidate(r.RemoteAddr, IPSourceRemoteAddr)
 }
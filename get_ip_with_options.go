@@ -18,8 +18,11 @@ import (
 //   If all are trusted, the last address is returned.
 // - Additional headers:
 //   AdditionalHeaders are checked in order before falling back to RemoteAddr.
+// - Chain length:
+//   An X-Forwarded-For with more than MaxForwardedChain entries is ignored.
 // - Validation:
-//   If Validate is true, candidate IPs must parse via net.ParseIP; invalid values are skipped.
+//   Candidates are normalized with NormalizeIP (ports, brackets, quotes and zones are stripped).
+//   If Validate is true, candidate IPs must parse after normalization; invalid values are skipped.
 //
 // Note: This function does not mutate request state and does not perform DNS lookups.
 // It relies entirely on headers/RemoteAddr and the provided options.
@@ -33,135 +36,145 @@ import (
 // If you want the simple behavior, use GetIP().
 // Use GetIPWithOptions when behind load balancers/reverse-proxies and you control trust.
 type IPOptions struct {
-	PreferForwardedFor         bool
-	TrustedProxies             []string
-	AdditionalHeaders          []string
-	Validate                   bool
-	ReturnPrivateIfAllPrivate  bool // used when no TrustedProxies specified and scanning XFF
+	PreferForwardedFor        bool
+	TrustedProxies            []string
+	AdditionalHeaders         []string
+	Validate                  bool
+	ReturnPrivateIfAllPrivate bool         // used when no TrustedProxies specified and scanning XFF
+	MaxForwardedChain         int          // longer X-Forwarded-For headers are ignored; 0 means DefaultMaxForwardedChain
+	Anonymizer                IPAnonymizer // applied only by GetIPWithOptions, never to candidates
 }
 
 // GetIPWithOptions determines the client IP using the provided options.
+//
+// Every candidate is normalized with NormalizeIP, so ports, brackets, quotes and
+// zones are stripped. Use GetIPCandidateWithOptions to access the raw header value.
 func GetIPWithOptions(r *http.Request, opts IPOptions) string {
+	ip := GetIPCandidateWithOptions(r, opts).Value()
+	if opts.Anonymizer != nil && ip != "" {
+		return opts.Anonymizer.Anonymize(ip)
+	}
+	return ip
+}
+
+// GetIPCandidateWithOptions works like GetIPWithOptions but returns the selected
+// candidate, including its raw value and the header it was read from.
+// The Anonymizer option is not applied to the candidate, so middleware that
+// matches or counts addresses, such as IPFilter and RateLimiter, always sees
+// the real client IP.
+func GetIPCandidateWithOptions(r *http.Request, opts IPOptions) IPCandidate {
 	if r == nil {
-		return ""
+		return IPCandidate{}
 	}
 
 	trustedNets := parseCIDRs(opts.TrustedProxies)
 
 	// Define helpers
-	getFirstValid := func(vals ...string) string {
+	getFirstValid := func(source string, vals ...string) IPCandidate {
 		for _, v := range vals {
-			ip := strings.TrimSpace(v)
-			if ip == "" {
+			candidate := newIPCandidate(v, source)
+			if candidate.Raw == "" {
 				continue
 			}
-			if opts.Validate && net.ParseIP(ip) == nil {
+			if opts.Validate && !candidate.IsValid() {
 				continue
 			}
-			return ip
+			return candidate
 		}
-		return ""
+		return IPCandidate{}
 	}
 
-	pickFromXFFTrusted := func(xff string) string {
-		if xff == "" {
-			return ""
-		}
-		parts := strings.Split(xff, ",")
-		last := ""
-		for i := 0; i < len(parts); i++ {
-			candidate := strings.TrimSpace(parts[i])
-			if candidate == "" {
-				continue
-			}
-			if opts.Validate && net.ParseIP(candidate) == nil {
+	pickFromXFFTrusted := func(chain []IPCandidate) IPCandidate {
+		last := IPCandidate{}
+		for _, candidate := range chain {
+			if opts.Validate && !candidate.IsValid() {
 				continue
 			}
 			last = candidate
 			// If not trusted, it's the client IP
-			if !containsIP(trustedNets, candidate) {
+			if !containsIP(trustedNets, candidate.IP) {
 				return candidate
 			}
 		}
 		return last
 	}
 
-	pickFromXFFPrivateAware := func(xff string) string {
-		if xff == "" {
-			return ""
-		}
-		parts := strings.Split(xff, ",")
-		last := ""
-		for _, p := range parts {
-			candidate := strings.TrimSpace(p)
-			if candidate == "" {
-				continue
-			}
-			if opts.Validate && net.ParseIP(candidate) == nil {
+	pickFromXFFPrivateAware := func(chain []IPCandidate) IPCandidate {
+		last := IPCandidate{}
+		for _, candidate := range chain {
+			if opts.Validate && !candidate.IsValid() {
 				continue
 			}
 			last = candidate
-			if !IsPrivateIP(candidate) {
+			if !IsPrivateIP(candidate.IP) {
 				return candidate
 			}
 		}
 		if opts.ReturnPrivateIfAllPrivate {
 			return last
 		}
-		return ""
+		return IPCandidate{}
 	}
 
-	getFromXFF := func() string {
-		xff := r.Header.Get("X-FORWARDED-FOR")
+	getFromXFF := func() IPCandidate {
+		chain := splitForwardedFor(r.Header.Get("X-FORWARDED-FOR"))
+		if len(chain) > maxForwardedChain(opts) {
+			// Too long to come from our proxies, likely padded by the client
+			return IPCandidate{}
+		}
 		if len(trustedNets) > 0 {
-			return pickFromXFFTrusted(xff)
+			return pickFromXFFTrusted(chain)
 		}
-		return pickFromXFFPrivateAware(xff)
+		return pickFromXFFPrivateAware(chain)
 	}
 
-	getFromRealIP := func() string {
+	getFromRealIP := func() IPCandidate {
 		val := r.Header.Get("X-REAL-IP")
-		return getFirstValid(val)
+		return getFirstValid(IPSourceRealIP, val)
 	}
 
-	getFromAdditional := func() string {
+	getFromAdditional := func() IPCandidate {
 		for _, hdr := range opts.AdditionalHeaders {
 			if hdr == "" {
 				continue
 			}
 			v := r.Header.Get(hdr)
-			if ip := getFirstValid(v); ip != "" {
-				return ip
+			if candidate := getFirstValid(hdr, v); candidate.Raw != "" {
+				return candidate
 			}
 		}
-		return ""
+		return IPCandidate{}
 	}
 
-	var ip string
+	var candidate IPCandidate
 	if opts.PreferForwardedFor {
-		ip = getFromXFF()
-		if ip == "" {
-			ip = getFromRealIP()
+		candidate = getFromXFF()
+		if candidate.Raw == "" {
+			candidate = getFromRealIP()
 		}
 	} else {
-		ip = getFromRealIP()
-		if ip == "" {
-			ip = getFromXFF()
+		candidate = getFromRealIP()
+		if candidate.Raw == "" {
+			candidate = getFromXFF()
 		}
 	}
-	if ip == "" {
-		ip = getFromAdditional()
+	if candidate.Raw == "" {
+		candidate = getFromAdditional()
 	}
-	if ip != "" {
-		return ip
+	if candidate.Raw != "" {
+		return candidate
 	}
 
 	// Fallback to RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+	return newIPCandidate(r.RemoteAddr, IPSourceRemoteAddr)
+}
+
+// maxForwardedChain returns the longest X-Forwarded-For header that is used.
+func maxForwardedChain(opts IPOptions) int {
+	if opts.MaxForwardedChain > 0 {
+		return opts.MaxForwardedChain
 	}
-	return host
+	return DefaultMaxForwardedChain
 }
 
 // parseCIDRs parses CIDR strings or single IPs into a slice of *net.IPNet.
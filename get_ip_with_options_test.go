@@ -110,6 +110,19 @@ func TestGetIPWithOptions_ValidateSkipsInvalid(t *testing.T) {
 	}
 }
 
+func TestGetIPWithOptions_MaxForwardedChain(t *testing.T) {
+	r := newReq("GET", "/", "")
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "198.51.100.1, 198.51.100.2, 203.0.113.9")
+
+	if ip := GetIPWithOptions(r, IPOptions{PreferForwardedFor: true}); ip != "198.51.100.1" {
+		t.Fatalf("expected 198.51.100.1, got %q", ip)
+	}
+	if ip := GetIPWithOptions(r, IPOptions{PreferForwardedFor: true, MaxForwardedChain: 2}); ip != "10.0.0.1" {
+		t.Fatalf("expected over-long chain to be ignored, got %q", ip)
+	}
+}
+
 func TestGetIPWithOptions_FallbackRemoteAddr(t *testing.T) {
 	r := newReq("GET", "/", "")
 	r.RemoteAddr = "203.0.113.5:12345"
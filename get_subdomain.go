@@ -8,10 +8,13 @@ import (
 // GetSubdomain finds the subdomain in the host of the given request.
 //
 // Business logic:
-// - extract the host from the request
-// - if the host is "localhost", return an empty string
-// - if there is no dot in the host, return an empty string
-// - otherwise, return the part of the host before the first dot
+// - resolve the host with GetHost (r.Host, without port)
+// - if the host is an IP address, return an empty string
+// - find the registrable domain using DefaultBaseDomains and the Public Suffix List
+// - if the host has no labels in front of it, return an empty string
+// - otherwise, return the leftmost label
+//
+// For "a.b.example.co.uk" this returns "a"; use GetFullSubdomain for "a.b".
 //
 // Parameters:
 //   - r (*http.Request): The HTTP request from which to extract the subdomain.
@@ -19,25 +22,75 @@ import (
 // Returns:
 //   - string: the subdomain, or an empty string if none found.
 func GetSubdomain(r *http.Request) string {
-	if r == nil || r.URL == nil || r.URL.Host == "" {
-		return ""
-	}
+	return GetSubdomainWithOptions(r, HostOptions{})
+}
 
-	// If the host is "localhost", there is no subdomain
-	if r.URL.Host == "localhost" {
+// GetSubdomainWithOptions is like GetSubdomain, resolving the host with
+// GetHostWithOptions and matching opts.BaseDomains before the Public
+// Suffix List.
+func GetSubdomainWithOptions(r *http.Request, opts HostOptions) string {
+	labels := GetSubdomainLabelsWithOptions(r, opts)
+	if len(labels) == 0 {
 		return ""
 	}
+	return labels[0]
+}
 
-	// Find the index of the first dot in the host
-	i := strings.Index(r.URL.Host, ".")
+// GetFullSubdomain returns the complete subdomain of the request host,
+// e.g. "a.b" for "a.b.example.com", or an empty string if there is none.
+func GetFullSubdomain(r *http.Request) string {
+	return GetFullSubdomainWithOptions(r, HostOptions{})
+}
 
-	// If there is no dot, there is no subdomain
-	if i == -1 {
-		return ""
+// GetFullSubdomainWithOptions is like GetFullSubdomain, using opts to
+// resolve the host and base domains.
+func GetFullSubdomainWithOptions(r *http.Request, opts HostOptions) string {
+	return strings.Join(GetSubdomainLabelsWithOptions(r, opts), ".")
+}
+
+// GetSubdomainLabels returns the subdomain labels of the request host,
+// e.g. ["a", "b"] for "a.b.example.com".
+func GetSubdomainLabels(r *http.Request) []string {
+	return GetSubdomainLabelsWithOptions(r, HostOptions{})
+}
+
+// GetSubdomainLabelsWithOptions is like GetSubdomainLabels, using opts to
+// resolve the host and base domains.
+func GetSubdomainLabelsWithOptions(r *http.Request, opts HostOptions) []string {
+	host := GetHostWithOptions(r, opts)
+	if host == "" || IsIPHost(host) {
+		return nil
 	}
 
-	// The subdomain is the part of the host before the first dot
-	subdomain := r.URL.Host[:i]
+	baseDomains := opts.BaseDomains
+	if baseDomains == nil {
+		baseDomains = DefaultBaseDomains
+	}
+	if labels, ok := baseDomainSubdomainLabels(host, baseDomains); ok {
+		return labels
+	}
 
-	return subdomain
+	return SubdomainLabels(host)
+}
+
+// baseDomainSubdomainLabels returns the labels of host in front of the
+// longest matching base domain. ok is false if no base domain matches.
+func baseDomainSubdomainLabels(host string, baseDomains []string) (labels []string, ok bool) {
+	match := ""
+	for _, base := range baseDomains {
+		base = canonicalDomain(strings.TrimPrefix(strings.TrimSpace(base), "."))
+		if base == "" || len(base) <= len(match) {
+			continue
+		}
+		if host == base || strings.HasSuffix(host, "."+base) {
+			match = base
+		}
+	}
+	if match == "" {
+		return nil, false
+	}
+	if host == match {
+		return nil, true
+	}
+	return domainLabels(strings.TrimSuffix(host, "."+match)), true
 }
@@ -2,6 +2,8 @@ package req
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -61,3 +63,105 @@ func TestGetSubdomain_NilRequest(t *testing.T) {
 		t.Errorf("GetSubdomain() = %q, want \"\"", subdomain)
 	}
 }
+
+func TestGetSubdomain_PublicSuffix(t *testing.T) {
+	tests := []struct {
+		host   string
+		first  string
+		full   string
+		labels []string
+	}{
+		{host: "example.co.uk", first: "", full: ""},
+		{host: "a.b.example.com", first: "a", full: "a.b", labels: []string{"a", "b"}},
+		{host: "api.example.co.uk", first: "api", full: "api", labels: []string{"api"}},
+		{host: "user.github.io", first: "", full: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "http://"+tt.host, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := GetSubdomain(r); got != tt.first {
+				t.Errorf("GetSubdomain() = %q, want %q", got, tt.first)
+			}
+			if got := GetFullSubdomain(r); got != tt.full {
+				t.Errorf("GetFullSubdomain() = %q, want %q", got, tt.full)
+			}
+			if got := GetSubdomainLabels(r); !reflect.DeepEqual(got, tt.labels) {
+				t.Errorf("GetSubdomainLabels() = %q, want %q", got, tt.labels)
+			}
+		})
+	}
+}
+
+func TestGetSubdomainWithOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		forwarded  string
+		opts       HostOptions
+		first      string
+		full       string
+	}{
+		{name: "reads r.Host", host: "api.example.com", first: "api", full: "api"},
+		{name: "strips port", host: "api.example.com:8080", first: "api", full: "api"},
+		{name: "IPv4 host", host: "127.0.0.1:8080", first: "", full: ""},
+		{name: "IPv6 host", host: "[::1]:8080", first: "", full: ""},
+		{name: "bare localhost", host: "localhost:3000", first: "", full: ""},
+		{name: "localhost subdomain", host: "a.api.localhost:3000", first: "a", full: "a.api"},
+		{name: "test without base domain", host: "api.myapp.test", first: "api", full: "api"},
+		{
+			name:  "test base domain",
+			host:  "api.myapp.test",
+			opts:  HostOptions{BaseDomains: []string{".test"}},
+			first: "api",
+			full:  "api.myapp",
+		},
+		{
+			name:  "longest base domain wins",
+			host:  "api.myapp.test",
+			opts:  HostOptions{BaseDomains: []string{"test", "myapp.test"}},
+			first: "api",
+			full:  "api",
+		},
+		{
+			name:  "empty base domains disable localhost",
+			host:  "api.localhost",
+			opts:  HostOptions{BaseDomains: []string{}},
+			first: "",
+			full:  "",
+		},
+		{
+			name:       "trusted forwarded host",
+			host:       "backend:8080",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "shop.example.co.uk",
+			opts:       HostOptions{TrustedProxies: []string{"10.0.0.1"}},
+			first:      "shop",
+			full:       "shop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Host = tt.host
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-Host", tt.forwarded)
+			}
+
+			if got := GetSubdomainWithOptions(r, tt.opts); got != tt.first {
+				t.Errorf("GetSubdomainWithOptions() = %q, want %q", got, tt.first)
+			}
+			if got := GetFullSubdomainWithOptions(r, tt.opts); got != tt.full {
+				t.Errorf("GetFullSubdomainWithOptions() = %q, want %q", got, tt.full)
+			}
+		})
+	}
+}
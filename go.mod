@@ -5,9 +5,8 @@ go 1.24.5
 require (
 	github.com/dracory/base v0.26.0
 	github.com/spf13/cast v1.9.2
+	golang.org/x/net v0.42.0
+	golang.org/x/text v0.27.0
 )
 
-require (
-	github.com/samber/lo v1.51.0 // indirect
-	golang.org/x/text v0.27.0 // indirect
-)
+require github.com/samber/lo v1.51.0 // indirect
@@ -0,0 +1,8 @@
+package req
+
+import "log/slog"
+
+// discardLogger returns a logger for tests that do not check log output.
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
@@ -0,0 +1,184 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ErrHostNotAllowed is returned when the request host is not in the allowlist.
+var ErrHostNotAllowed = errors.New("req: host not allowed")
+
+// ValidateHost checks the request host against an allowlist, so that an
+// attacker-controlled Host header cannot end up in generated links such as
+// password reset URLs. See ValidateHostWithOptions for the pattern syntax.
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - allowed ([]string): The allowed host patterns
+//
+// Returns:
+//   - error: nil if allowed, wrapping ErrInvalidHostname if the host is
+//     missing or malformed, or ErrHostNotAllowed if it is not in the list
+func ValidateHost(r *http.Request, allowed []string) error {
+	return ValidateHostWithOptions(r, allowed, HostOptions{})
+}
+
+// ValidateHostWithOptions is like ValidateHost, checking X-Forwarded-Host
+// instead of r.Host when the direct peer is in opts.TrustedProxies, the
+// same way GetHostWithOptions resolves the host.
+//
+// Business logic:
+// - patterns are host names without port, compared in canonical form (see NormalizeHost)
+// - "*.example.com" matches any subdomain of example.com, but not example.com itself
+// - "*" matches any well-formed host
+// - a trusted but malformed X-Forwarded-Host is rejected rather than falling back to r.Host
+func ValidateHostWithOptions(r *http.Request, allowed []string, opts HostOptions) error {
+	return newHostPatterns(allowed).validate(r, opts)
+}
+
+// HostValidatorOptions configures NewHostValidator.
+type HostValidatorOptions struct {
+	// AllowedHosts lists the accepted host patterns, e.g. "example.com" and
+	// "*.example.com".
+	AllowedHosts []string
+	// HostOptions controls which proxies may set X-Forwarded-Host.
+	// BaseDomains is ignored.
+	HostOptions HostOptions
+	// Logger receives rejections; nil means slog.Default().
+	Logger *slog.Logger
+	// DeniedHandler responds to rejected requests; nil means 400 Bad Request
+	// for missing or malformed hosts and 421 Misdirected Request for hosts
+	// not in the allowlist.
+	DeniedHandler http.Handler
+}
+
+// HostValidator rejects requests for hosts not in an allowlist.
+type HostValidator struct {
+	opts     HostValidatorOptions
+	patterns hostPatterns
+}
+
+// NewHostValidator creates a host validator.
+func NewHostValidator(opts HostValidatorOptions) *HostValidator {
+	return &HostValidator{opts: opts, patterns: newHostPatterns(opts.AllowedHosts)}
+}
+
+// HostValidatorMiddleware returns middleware that rejects requests whose
+// host is not in the allowlist.
+//
+// Example:
+//
+//	mw := req.HostValidatorMiddleware(req.HostValidatorOptions{
+//	    AllowedHosts: []string{"example.com", "*.example.com"},
+//	    HostOptions:  req.HostOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+//	})
+//	http.ListenAndServe(":8080", mw(handler))
+func HostValidatorMiddleware(opts HostValidatorOptions) func(http.Handler) http.Handler {
+	return NewHostValidator(opts).Middleware
+}
+
+// Validate checks the request host, see ValidateHostWithOptions.
+func (v *HostValidator) Validate(r *http.Request) error {
+	return v.patterns.validate(r, v.opts.HostOptions)
+}
+
+// Middleware wraps next with the validator.
+func (v *HostValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := v.Validate(r)
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v.logger().Warn("req: host validation rejected request",
+			"host", r.Host,
+			"forwarded_host", r.Header.Get("X-Forwarded-Host"),
+			"error", err,
+		)
+
+		if v.opts.DeniedHandler != nil {
+			v.opts.DeniedHandler.ServeHTTP(w, r)
+			return
+		}
+		status := http.StatusMisdirectedRequest
+		if errors.Is(err, ErrInvalidHostname) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, http.StatusText(status), status)
+	})
+}
+
+// logger returns the configured logger.
+func (v *HostValidator) logger() *slog.Logger {
+	if v.opts.Logger != nil {
+		return v.opts.Logger
+	}
+	return slog.Default()
+}
+
+// hostPatterns is a compiled host allowlist.
+type hostPatterns struct {
+	any      bool
+	exact    map[string]bool
+	suffixes []string // ".example.com" for "*.example.com"
+}
+
+// newHostPatterns compiles host patterns, ignoring invalid ones.
+func newHostPatterns(patterns []string) hostPatterns {
+	p := hostPatterns{exact: map[string]bool{}}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "*":
+			p.any = true
+		case strings.HasPrefix(pattern, "*."):
+			if suffix := canonicalDomain(pattern[2:]); suffix != "" {
+				p.suffixes = append(p.suffixes, "."+suffix)
+			}
+		default:
+			if host := NormalizeHost(pattern); host != "" {
+				p.exact[host] = true
+			}
+		}
+	}
+	return p
+}
+
+// validate checks the host of r against the patterns.
+func (p hostPatterns) validate(r *http.Request, opts HostOptions) error {
+	if r == nil {
+		return fmt.Errorf("%w: no request", ErrInvalidHostname)
+	}
+
+	raw := r.Host
+	if raw == "" && r.URL != nil {
+		raw = r.URL.Host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && isTrustedProxy(r, opts.TrustedProxies) {
+		raw, _, _ = strings.Cut(forwarded, ",")
+	}
+
+	host := NormalizeHost(raw)
+	if host == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidHostname, raw)
+	}
+	if !IsIPHost(host) {
+		if err := ValidateHostname(host); err != nil {
+			return err
+		}
+	}
+
+	if p.any || p.exact[host] {
+		return nil
+	}
+	for _, suffix := range p.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrHostNotAllowed, host)
+}
@@ -0,0 +1,146 @@
+package req
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateHostWithOptions(t *testing.T) {
+	allowed := []string{"example.com", "*.example.com", "bücher.example", "[::1]", "127.0.0.1"}
+	trusted := HostOptions{TrustedProxies: []string{"10.0.0.0/8"}}
+
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		forwarded  string
+		opts       HostOptions
+		expected   error
+	}{
+		{name: "exact", host: "example.com", expected: nil},
+		{name: "exact with port and case", host: "EXAMPLE.com:8443", expected: nil},
+		{name: "wildcard", host: "api.example.com", expected: nil},
+		{name: "nested wildcard", host: "a.b.example.com", expected: nil},
+		{name: "IDN pattern in unicode form", host: "xn--bcher-kva.example", expected: nil},
+		{name: "IPv6", host: "[::1]:8080", expected: nil},
+		{name: "IPv4", host: "127.0.0.1:8080", expected: nil},
+		{name: "unknown host", host: "evil.com", expected: ErrHostNotAllowed},
+		{name: "suffix without dot", host: "evilexample.com", expected: ErrHostNotAllowed},
+		{name: "empty host", host: "", expected: ErrInvalidHostname},
+		{name: "malformed port", host: "example.com:abc", expected: ErrInvalidHostname},
+		{name: "invalid characters", host: "exa mple.com", expected: ErrInvalidHostname},
+		{
+			name:       "forwarded host ignored from untrusted peer",
+			host:       "example.com",
+			remoteAddr: "203.0.113.5:1234",
+			forwarded:  "evil.com",
+			opts:       trusted,
+			expected:   nil,
+		},
+		{
+			name:       "forwarded host from trusted proxy",
+			host:       "backend:8080",
+			remoteAddr: "10.0.0.2:1234",
+			forwarded:  "shop.example.com",
+			opts:       trusted,
+			expected:   nil,
+		},
+		{
+			name:       "unknown forwarded host from trusted proxy",
+			host:       "example.com",
+			remoteAddr: "10.0.0.2:1234",
+			forwarded:  "evil.com",
+			opts:       trusted,
+			expected:   ErrHostNotAllowed,
+		},
+		{
+			name:       "malformed forwarded host from trusted proxy",
+			host:       "example.com",
+			remoteAddr: "10.0.0.2:1234",
+			forwarded:  "[::1",
+			opts:       trusted,
+			expected:   ErrInvalidHostname,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Host = tt.host
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-Host", tt.forwarded)
+			}
+
+			err := ValidateHostWithOptions(r, allowed, tt.opts)
+			if tt.expected == nil && err != nil {
+				t.Errorf("ValidateHostWithOptions() error = %v, want nil", err)
+			}
+			if tt.expected != nil && !errors.Is(err, tt.expected) {
+				t.Errorf("ValidateHostWithOptions() error = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateHost_Any(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "anything.test"
+	if err := ValidateHost(r, []string{"*"}); err != nil {
+		t.Errorf("ValidateHost() error = %v, want nil", err)
+	}
+	if err := ValidateHost(r, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("ValidateHost() error = %v, want ErrHostNotAllowed", err)
+	}
+	if err := ValidateHost(nil, []string{"*"}); !errors.Is(err, ErrInvalidHostname) {
+		t.Errorf("ValidateHost(nil) error = %v, want ErrInvalidHostname", err)
+	}
+}
+
+func TestHostValidatorMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		host   string
+		denied http.Handler
+		status int
+	}{
+		{name: "allowed", host: "app.example.com", status: http.StatusNoContent},
+		{name: "unknown", host: "evil.com", status: http.StatusMisdirectedRequest},
+		{name: "malformed", host: "example.com:x", status: http.StatusBadRequest},
+		{
+			name: "custom handler",
+			host: "evil.com",
+			denied: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}),
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := HostValidatorMiddleware(HostValidatorOptions{
+				AllowedHosts:  []string{"*.example.com"},
+				Logger:        discardLogger(),
+				DeniedHandler: tt.denied,
+			})
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			mw(next).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedPasswordHash is returned when verifying a hash whose
+// format is not supported, such as bcrypt or plain text.
+var ErrUnsupportedPasswordHash = errors.New("req: unsupported password hash")
+
+// MaxPasswordLength is the longest password, in bytes, that is hashed.
+// Longer passwords are rejected up front, as the cost of SHA-crypt grows
+// with the square of the password length.
+const MaxPasswordLength = 256
+
+// PasswordVerifier checks user passwords. Implementations must be safe for
+// concurrent use.
+type PasswordVerifier interface {
+	VerifyPassword(user, password string) bool
+}
+
+// Htpasswd holds the entries of an Apache htpasswd file. It implements
+// PasswordVerifier.
+//
+// Supported hash formats:
+//   - {SHA}: base64 SHA-1, as written by "htpasswd -s"
+//   - $5$ and $6$: SHA-256 and SHA-512 crypt, as written by "openssl passwd -5/-6"
+//   - $apr1$: Apache MD5, as written by "htpasswd -m"
+type Htpasswd struct {
+	users map[string]string
+	dummy string // the most expensive hash, verified for unknown users
+}
+
+// ParseHtpasswd parses "user:hash" lines. Empty lines and lines starting
+// with '#' are ignored. Entries with an unsupported hash format are skipped
+// with a warning logged to slog.Default(), so those users cannot log in
+// while everyone else still can.
+//
+// Returns:
+//   - *Htpasswd: the entries
+//   - error: for malformed lines and duplicate users
+func ParseHtpasswd(data []byte) (*Htpasswd, error) {
+	h := &Htpasswd{users: map[string]string{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		user, passwordHash, ok := strings.Cut(entry, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("req: invalid htpasswd entry on line %d", line)
+		}
+		if _, dup := h.users[user]; dup {
+			return nil, fmt.Errorf("req: duplicate htpasswd user %q on line %d", user, line)
+		}
+		if !isSupportedPasswordHash(passwordHash) {
+			slog.Default().Warn("req: skipping htpasswd entry with an unsupported password hash", "user", user, "line", line)
+			continue
+		}
+		h.users[user] = passwordHash
+		if h.dummy == "" || passwordHashCost(passwordHash) > passwordHashCost(h.dummy) {
+			h.dummy = passwordHash
+		}
+	}
+	return h, scanner.Err()
+}
+
+// VerifyPassword implements PasswordVerifier. Unknown users are checked
+// against the most expensive hash of the file, so they cost as much as a
+// wrong password for users with that hash format. Keep all users on the
+// same format and rounds to not reveal valid user names through response
+// times.
+func (h *Htpasswd) VerifyPassword(user, password string) bool {
+	passwordHash, ok := h.users[user]
+	if !ok {
+		dummy := h.dummy
+		if dummy == "" {
+			dummy = htpasswdDummyHash
+		}
+		_, _ = verifyPasswordHash(dummy, password)
+		return false
+	}
+	match, err := verifyPasswordHash(passwordHash, password)
+	return err == nil && match
+}
+
+// htpasswdDummyHash is verified for unknown users of an empty file.
+const htpasswdDummyHash = "$apr1$dummysal$0000000000000000000000"
+
+// passwordHashCost estimates the work of verifying a supported hash.
+func passwordHashCost(passwordHash string) int {
+	switch {
+	case strings.HasPrefix(passwordHash, "$apr1$"):
+		return 1000
+	case strings.HasPrefix(passwordHash, "$5$"), strings.HasPrefix(passwordHash, "$6$"):
+		rounds, _ := shaCryptRounds(passwordHash[3:])
+		if rounds == 0 {
+			rounds = 5000
+		}
+		return rounds
+	}
+	return 1
+}
+
+// isSupportedPasswordHash reports whether the format of an htpasswd hash is
+// supported, without computing it.
+func isSupportedPasswordHash(passwordHash string) bool {
+	switch {
+	case strings.HasPrefix(passwordHash, "{SHA}"), strings.HasPrefix(passwordHash, "$apr1$"):
+		return true
+	case strings.HasPrefix(passwordHash, "$5$"), strings.HasPrefix(passwordHash, "$6$"):
+		_, err := shaCryptRounds(passwordHash[3:])
+		return err == nil
+	}
+	return false
+}
+
+// verifyPasswordHash checks password against an htpasswd hash. Passwords
+// longer than MaxPasswordLength never match.
+func verifyPasswordHash(passwordHash, password string) (bool, error) {
+	if len(password) > MaxPasswordLength {
+		return false, nil
+	}
+	var computed string
+	switch {
+	case strings.HasPrefix(passwordHash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(passwordHash, "$apr1$"):
+		salt, _, _ := strings.Cut(passwordHash[len("$apr1$"):], "$")
+		computed = apr1Crypt(password, salt)
+	case strings.HasPrefix(passwordHash, "$5$"), strings.HasPrefix(passwordHash, "$6$"):
+		var err error
+		computed, err = shaCrypt(password, passwordHash)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, ErrUnsupportedPasswordHash
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(passwordHash)) == 1, nil
+}
+
+// cryptAlphabet is the base64 alphabet of crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptBase64 encodes 3 bytes as n characters, least significant first.
+func cryptBase64(b *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		b.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+// apr1Crypt computes the Apache MD5 hash of a password.
+func apr1Crypt(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	ctx := md5.New()
+	ctx.Write([]byte(password + magic + salt))
+	for n := len(pw); n > 0; n -= 16 {
+		ctx.Write(alt[:min(n, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx := md5.New()
+		if i&1 == 1 {
+			ctx.Write(pw)
+		} else {
+			ctx.Write(final)
+		}
+		if i%3 != 0 {
+			ctx.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			ctx.Write(pw)
+		}
+		if i&1 == 1 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(pw)
+		}
+		final = ctx.Sum(nil)
+	}
+
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		cryptBase64(&b, final[g[0]], final[g[1]], final[g[2]], 4)
+	}
+	cryptBase64(&b, 0, 0, final[11], 2)
+	return b.String()
+}
+
+// shaCrypt computes the SHA-256 ("$5$") or SHA-512 ("$6$") crypt hash of a
+// password with the prefix, rounds and salt of setting.
+func shaCrypt(password, setting string) (string, error) {
+	prefix := setting[:3]
+	newHash := sha256.New
+	if prefix == "$6$" {
+		newHash = sha512.New
+	}
+
+	rest := setting[3:]
+	rounds, err := shaCryptRounds(rest)
+	if err != nil {
+		return "", err
+	}
+	customRounds := rounds != 0
+	if customRounds {
+		_, rest, _ = strings.Cut(rest, "$")
+	} else {
+		rounds = 5000
+	}
+	salt, _, _ := strings.Cut(rest, "$")
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	final := shaCryptDigest(newHash, []byte(password), []byte(salt), rounds)
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	if customRounds {
+		b.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	b.WriteString(salt + "$")
+	if prefix == "$5$" {
+		for _, g := range [][3]int{{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14}, {15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29}} {
+			cryptBase64(&b, final[g[0]], final[g[1]], final[g[2]], 4)
+		}
+		cryptBase64(&b, 0, final[31], final[30], 3)
+	} else {
+		for i := 0; i < 21; i++ {
+			// Byte triples rotate: (0 21 42), (22 43 1), (44 2 23), ...
+			g := [3]int{i, i + 21, i + 42}
+			g = [3]int{g[i%3], g[(i+1)%3], g[(i+2)%3]}
+			cryptBase64(&b, final[g[0]], final[g[1]], final[g[2]], 4)
+		}
+		cryptBase64(&b, 0, 0, final[63], 2)
+	}
+	return b.String(), nil
+}
+
+// shaCryptRounds parses an optional "rounds=N$" setting, returning 0 if
+// it is missing. N is clamped to 1000-999999999 like crypt(3) does.
+func shaCryptRounds(setting string) (int, error) {
+	r, ok := strings.CutPrefix(setting, "rounds=")
+	if !ok {
+		return 0, nil
+	}
+	value, _, _ := strings.Cut(r, "$")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: invalid rounds %q", ErrUnsupportedPasswordHash, value)
+	}
+	return min(max(n, 1000), 999_999_999), nil
+}
+
+// shaCryptDigest runs the SHA-crypt key derivation.
+func shaCryptDigest(newHash func() hash.Hash, pw, salt []byte, rounds int) []byte {
+	sum := func(parts ...[]byte) []byte {
+		h := newHash()
+		for _, p := range parts {
+			h.Write(p)
+		}
+		return h.Sum(nil)
+	}
+	size := newHash().Size()
+
+	b := sum(pw, salt, pw)
+	a := newHash()
+	a.Write(pw)
+	a.Write(salt)
+	for n := len(pw); n > 0; n -= size {
+		a.Write(b[:min(n, size)])
+	}
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			a.Write(b)
+		} else {
+			a.Write(pw)
+		}
+	}
+	digest := a.Sum(nil)
+
+	// The password is hashed len(pw) times, which is why its length is
+	// limited by MaxPasswordLength.
+	dp := newHash()
+	for range pw {
+		dp.Write(pw)
+	}
+	p := repeatBytes(dp.Sum(nil), len(pw))
+
+	ds := newHash()
+	for i := 0; i < 16+int(digest[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatBytes(ds.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		c := newHash()
+		if i&1 == 1 {
+			c.Write(p)
+		} else {
+			c.Write(digest)
+		}
+		if i%3 != 0 {
+			c.Write(s)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 == 1 {
+			c.Write(digest)
+		} else {
+			c.Write(p)
+		}
+		digest = c.Sum(nil)
+	}
+	return digest
+}
+
+// repeatBytes repeats b up to n bytes.
+func repeatBytes(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, b[:min(len(b), n-len(out))]...)
+	}
+	return out
+}
+
+// HtpasswdFile is an Htpasswd read from a file. The file is reloaded when
+// it changes, without interrupting concurrent verifications.
+type HtpasswdFile struct {
+	fileReloader[*Htpasswd]
+}
+
+// OpenHtpasswdFile reads an htpasswd file. If reloadInterval is positive,
+// the file is checked for changes at that interval until Close is called.
+func OpenHtpasswdFile(path string, reloadInterval time.Duration) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{}
+	if err := f.open(path, reloadInterval, ParseHtpasswd); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// VerifyPassword implements PasswordVerifier.
+func (f *HtpasswdFile) VerifyPassword(user, password string) bool {
+	return f.current().VerifyPassword(user, password)
+}
+
+// BasicAuthOptions configures NewBasicAuth.
+type BasicAuthOptions struct {
+	// Realm is sent in the WWW-Authenticate challenge; empty means "Restricted".
+	Realm string
+	// Users verifies the credentials, e.g. an *HtpasswdFile.
+	Users PasswordVerifier
+	// Logger receives failed attempts at debug level; nil means slog.Default().
+	Logger *slog.Logger
+	// DeniedHandler responds to rejected requests after the challenge
+	// header is set; nil means 401 Unauthorized.
+	DeniedHandler http.Handler
+}
+
+// BasicAuth authenticates requests with HTTP Basic credentials.
+type BasicAuth struct {
+	opts BasicAuthOptions
+}
+
+// NewBasicAuth creates a Basic authenticator.
+//
+// Example:
+//
+//	users, err := req.OpenHtpasswdFile("/etc/app/.htpasswd", time.Minute)
+//	auth := req.NewBasicAuth(req.BasicAuthOptions{Realm: "Admin", Users: users})
+//	http.ListenAndServe(":8080", auth.Middleware(handler))
+func NewBasicAuth(opts BasicAuthOptions) *BasicAuth {
+	if opts.Realm == "" {
+		opts.Realm = "Restricted"
+	}
+	return &BasicAuth{opts: opts}
+}
+
+// BasicAuthMiddleware returns middleware that challenges requests without
+// valid Basic credentials and stores the user name in the context, see
+// GetBasicAuthUser.
+func BasicAuthMiddleware(opts BasicAuthOptions) func(http.Handler) http.Handler {
+	return NewBasicAuth(opts).Middleware
+}
+
+// Authenticate returns the user of valid Basic credentials.
+//
+// Returns:
+//   - string: the user name
+//   - error: ErrNoCredentials if there are none, ErrInvalidCredentials if they are malformed or wrong
+func (a *BasicAuth) Authenticate(r *http.Request) (string, error) {
+	c, err := ParseAuthorization(r)
+	if err != nil {
+		return "", err
+	}
+	user, password, ok := c.BasicAuth()
+	if !ok || a.opts.Users == nil || !a.opts.Users.VerifyPassword(user, password) {
+		return "", ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// Middleware wraps next with the authenticator.
+func (a *BasicAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.Authenticate(r)
+		if err == nil {
+			next.ServeHTTP(w, r.WithContext(WithBasicAuthUser(r.Context(), user)))
+			return
+		}
+
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.logger().Debug("req: basic auth failed", "ip", GetIP(r), "path", r.URL.Path)
+		}
+		SetWWWAuthenticate(w, Challenge{
+			Scheme: "Basic",
+			Realm:  a.opts.Realm,
+			Params: map[string]string{"charset": "UTF-8"},
+		})
+		if a.opts.DeniedHandler != nil {
+			a.opts.DeniedHandler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// logger returns the configured logger.
+func (a *BasicAuth) logger() *slog.Logger {
+	if a.opts.Logger != nil {
+		return a.opts.Logger
+	}
+	return slog.Default()
+}
+
+// basicAuthContextKey is the context key of the authenticated user.
+type basicAuthContextKey struct{}
+
+// WithBasicAuthUser returns a copy of ctx carrying user.
+func WithBasicAuthUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, basicAuthContextKey{}, user)
+}
+
+// BasicAuthUserFromContext returns the user stored by the Basic auth
+// middleware.
+func BasicAuthUserFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(basicAuthContextKey{}).(string)
+	return user, ok && user != ""
+}
+
+// GetBasicAuthUser returns the user stored in the request context by the
+// Basic auth middleware, or an empty string if there is none.
+func GetBasicAuthUser(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	user, _ := BasicAuthUserFromContext(r.Context())
+	return user
+}
@@ -0,0 +1,220 @@
+package req
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyPasswordHash(t *testing.T) {
+	tests := []struct {
+		hash     string
+		password string
+	}{
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret"},
+		{"$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1", "password"},
+		{"$apr1$xy$KWmjAYxMqmqTjytotPjDu.", "a much longer password than sixteen bytes"},
+		{"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!"},
+		{"$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!"},
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+		{"$6$rounds=1000$toolongsaltstrin$PP4GKms4/BPesRtNFLcPEBg7Cn1WnjvzxZqeKJFMSejCvZoyKQCG2foCAsma0gH1NjC4/tKiFkApyk.W4oah7/", "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hash[:6], func(t *testing.T) {
+			ok, err := verifyPasswordHash(tt.hash, tt.password)
+			if err != nil || !ok {
+				t.Errorf("verifyPasswordHash(%q, %q) = %v, %v, want true", tt.hash, tt.password, ok, err)
+			}
+			ok, _ = verifyPasswordHash(tt.hash, tt.password+"!")
+			if ok {
+				t.Errorf("verifyPasswordHash(%q, wrong password) = true", tt.hash)
+			}
+		})
+	}
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	h, err := ParseHtpasswd([]byte("# admins\nalice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n\nbob:$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "secret", true},
+		{"alice", "password", false},
+		{"bob", "password", true},
+		{"carol", "password", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := h.VerifyPassword(tt.user, tt.password); got != tt.want {
+			t.Errorf("VerifyPassword(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyPasswordHash_LongPassword(t *testing.T) {
+	sha := func(password string) string {
+		sum := sha1.Sum([]byte(password))
+		return "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	longest := strings.Repeat("a", MaxPasswordLength)
+	if ok, err := verifyPasswordHash(sha(longest), longest); !ok || err != nil {
+		t.Errorf("verifyPasswordHash(%d byte password) = %v, %v, want true", len(longest), ok, err)
+	}
+	// Rejected before hashing, even though the hash matches
+	tooLong := longest + "a"
+	if ok, err := verifyPasswordHash(sha(tooLong), tooLong); ok || err != nil {
+		t.Errorf("verifyPasswordHash(%d byte password) = %v, %v, want false", len(tooLong), ok, err)
+	}
+}
+
+func TestHtpasswd_UnknownUserCost(t *testing.T) {
+	h, err := ParseHtpasswd([]byte("bob:$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1\n" +
+		"alice:$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA\n" +
+		"carol:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(h.dummy, "$5$rounds=10000$") {
+		t.Fatalf("dummy hash = %q, want the 10000 rounds entry", h.dummy)
+	}
+
+	empty, err := ParseHtpasswd(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.VerifyPassword("mallory", "password") {
+		t.Error("VerifyPassword() = true for an empty file")
+	}
+}
+
+func TestParseHtpasswd_Invalid(t *testing.T) {
+	tests := []string{
+		"alice\n",
+		":{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n",
+		"alice:{SHA}a=\nalice:{SHA}b=\n",
+	}
+	for _, data := range tests {
+		if _, err := ParseHtpasswd([]byte(data)); err == nil {
+			t.Errorf("ParseHtpasswd(%q) error = nil", data)
+		}
+	}
+}
+
+func TestParseHtpasswd_SkipsUnsupported(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	h, err := ParseHtpasswd([]byte("alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n" +
+		"bob:$2y$10$abcdefghijklmnopqrstuu5Ue2xXq8uT5fC1Gz0JYh9v1EiGqYqO6\n" +
+		"carol:plaintext\n" +
+		"dave:$5$rounds=abc$salt$hash\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.VerifyPassword("alice", "secret") {
+		t.Error("supported entry rejected")
+	}
+	for _, user := range []string{"bob", "carol", "dave"} {
+		if h.VerifyPassword(user, "password") {
+			t.Errorf("VerifyPassword(%q) = true for a skipped entry", user)
+		}
+		if !strings.Contains(logs.String(), "user="+user) {
+			t.Errorf("no warning logged for %q: %s", user, logs.String())
+		}
+	}
+}
+
+func TestHtpasswdFile_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	writeFile(t, path, "alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+
+	users, err := OpenHtpasswdFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer users.Close()
+	if !users.VerifyPassword("alice", "secret") {
+		t.Fatal("VerifyPassword(alice) = false")
+	}
+
+	writeFile(t, path, "bob:$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1\n")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if users.VerifyPassword("alice", "secret") || !users.VerifyPassword("bob", "password") {
+		t.Error("reload did not replace the users")
+	}
+
+	writeFile(t, path, "broken\n")
+	if err := users.Reload(); err == nil {
+		t.Error("Reload() error = nil for an invalid file")
+	}
+	if !users.VerifyPassword("bob", "password") {
+		t.Error("failed reload dropped the previous users")
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	users, err := ParseHtpasswd([]byte("alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser string
+	handler := BasicAuthMiddleware(BasicAuthOptions{Realm: "Admin", Users: users, Logger: discardLogger()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotUser = GetBasicAuthUser(r)
+		}),
+	)
+
+	tests := []struct {
+		name     string
+		auth     func(r *http.Request)
+		want     int
+		wantUser string
+	}{
+		{"valid", func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, http.StatusOK, "alice"},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("alice", "nope") }, http.StatusUnauthorized, ""},
+		{"unknown user", func(r *http.Request) { r.SetBasicAuth("mallory", "secret") }, http.StatusUnauthorized, ""},
+		{"missing", func(*http.Request) {}, http.StatusUnauthorized, ""},
+		{"other scheme", func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") }, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = ""
+			r := httptest.NewRequest("GET", "/", nil)
+			tt.auth(r)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want || gotUser != tt.wantUser {
+				t.Errorf("status = %d, user = %q, want %d, %q", w.Code, gotUser, tt.want, tt.wantUser)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusUnauthorized && challenge != `Basic realm="Admin", charset="UTF-8"` {
+				t.Errorf("WWW-Authenticate = %q", challenge)
+			}
+		})
+	}
+}
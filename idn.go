@@ -0,0 +1,126 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidHostname is returned for host names that are not valid
+// internationalized domain names.
+var ErrInvalidHostname = errors.New("req: invalid host name")
+
+// domainProfile maps domains for lookups like idna.Lookup, but also
+// accepts ASCII labels that are not host names, such as "_dmarc".
+var domainProfile = idna.New(idna.MapForLookup(), idna.Transitional(false), idna.StrictDomainName(false))
+
+// HostToASCII converts a host name to its ASCII form, encoding Unicode
+// labels with punycode, e.g. "bücher.example" becomes
+// "xn--bcher-kva.example".
+//
+// Business logic:
+// - the host is mapped and validated with the UTS #46 Lookup profile of golang.org/x/net/idna
+// - a trailing dot is removed
+// - the ASCII form is at most 253 characters and every label 1-63
+//
+// Parameters:
+//   - host: The host name, without port
+//
+// Returns:
+//   - string: the ASCII host name
+//   - error: wrapping ErrInvalidHostname if a label is invalid
+func HostToASCII(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	// idna turns "xn--abc-" into "abc" instead of rejecting it
+	for _, label := range strings.Split(strings.ToLower(host), ".") {
+		if strings.HasPrefix(label, "xn--") {
+			if decoded, err := idna.Punycode.ToUnicode(label); err == nil && isASCII(decoded) {
+				return "", fmt.Errorf("%w: label %q is not a canonical punycode label", ErrInvalidHostname, label)
+			}
+		}
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidHostname, host, err)
+	}
+
+	ascii = strings.TrimSuffix(ascii, ".")
+	if ascii == "" {
+		return "", fmt.Errorf("%w: empty host", ErrInvalidHostname)
+	}
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("%w: %q is longer than 253 characters", ErrInvalidHostname, host)
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("%w: label %q must have 1 to 63 characters", ErrInvalidHostname, label)
+		}
+	}
+	return ascii, nil
+}
+
+// HostToUnicode converts a host name to its Unicode form, decoding
+// punycode labels, e.g. "xn--bcher-kva.example" becomes "bücher.example".
+// The host is validated like HostToASCII.
+func HostToUnicode(host string) (string, error) {
+	ascii, err := HostToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	unicode, err := idna.Lookup.ToUnicode(ascii)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidHostname, host, err)
+	}
+	return unicode, nil
+}
+
+// ValidateHostname checks that host is a valid, optionally
+// internationalized, domain name.
+//
+// Business logic:
+// - the ASCII form is at most 253 characters and every label 1-63
+// - ASCII labels contain only letters, digits and hyphens
+// - labels neither start nor end with a hyphen and only "xn--" labels have hyphens in positions 3 and 4
+// - punycode labels must decode to valid Unicode labels
+// - Unicode labels follow UTS #46, including its bidi and joiner rules
+func ValidateHostname(host string) error {
+	_, err := HostToASCII(host)
+	return err
+}
+
+// SameHost reports whether a and b name the same host, comparing their
+// canonical forms (see NormalizeHost), so "Bücher.example:443" and
+// "xn--bcher-kva.example" are the same host.
+func SameHost(a, b string) bool {
+	a, b = NormalizeHost(a), NormalizeHost(b)
+	return a != "" && a == b
+}
+
+// canonicalDomain returns the lowercase ASCII form of a domain for lookups.
+// Unlike HostToASCII it accepts ASCII labels that are not valid host names,
+// such as "_dmarc", but returns an empty string if a Unicode label cannot be
+// encoded.
+func canonicalDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if isASCII(domain) {
+		return domain
+	}
+	ascii, err := domainProfile.ToASCII(domain)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(ascii, ".")
+}
+
+// isASCII reports whether s contains only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
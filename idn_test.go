@@ -0,0 +1,167 @@
+package req
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPunycodeLabels(t *testing.T) {
+	// Samples from RFC 3492 section 7.1 and common IDN examples
+	tests := []struct {
+		unicode  string
+		punycode string
+	}{
+		{unicode: "bücher", punycode: "bcher-kva"},
+		{unicode: "münchen", punycode: "mnchen-3ya"},
+		{unicode: "他们为什么不说中文", punycode: "ihqwcrb4cv8a8dqg056pqjye"},
+		{unicode: "почемужеонинеговорятпорусски", punycode: "b1abfaaepdrnnbgefbadotcwatmq2g4l"},
+		{unicode: "3年b組金八先生", punycode: "3b-ww4c5e180e575a65lsy2b"},
+		{unicode: "ü", punycode: "tda"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unicode, func(t *testing.T) {
+			encoded, err := HostToASCII(tt.unicode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoded != "xn--"+tt.punycode {
+				t.Errorf("HostToASCII() = %q, want %q", encoded, "xn--"+tt.punycode)
+			}
+
+			decoded, err := HostToUnicode("xn--" + tt.punycode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != tt.unicode {
+				t.Errorf("HostToUnicode() = %q, want %q", decoded, tt.unicode)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"ü-tda", "99999999999", "a-!", "a-z"} {
+		if _, err := HostToUnicode("xn--" + invalid); !errors.Is(err, ErrInvalidHostname) {
+			t.Errorf("HostToUnicode(%q) error = %v, want ErrInvalidHostname", "xn--"+invalid, err)
+		}
+	}
+}
+
+func TestHostToASCII(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "example.com", expected: "example.com"},
+		{host: "Bücher.Example.", expected: "xn--bcher-kva.example"},
+		{host: "xn--bcher-kva.example", expected: "xn--bcher-kva.example"},
+		{host: "XN--BCHER-KVA.example", expected: "xn--bcher-kva.example"},
+		{host: "ｂüｃｈｅｒ。example", expected: "xn--bcher-kva.example"},
+		{host: "例え.テスト", expected: "xn--r8jz45g.xn--zckzah"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, err := HostToASCII(tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("HostToASCII() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHostToUnicode(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "xn--bcher-kva.example", expected: "bücher.example"},
+		{host: "bücher.example", expected: "bücher.example"},
+		{host: "xn--r8jz45g.xn--zckzah", expected: "例え.テスト"},
+		{host: "example.com", expected: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, err := HostToUnicode(tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("HostToUnicode() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		name  string
+		host  string
+		valid bool
+	}{
+		{name: "ascii", host: "api.example.com", valid: true},
+		{name: "unicode", host: "bücher.example", valid: true},
+		{name: "punycode", host: "xn--bcher-kva.example", valid: true},
+		{name: "digits and hyphens", host: "a-1.example", valid: true},
+		{name: "empty", host: "", valid: false},
+		{name: "empty label", host: "a..example", valid: false},
+		{name: "leading hyphen", host: "-a.example", valid: false},
+		{name: "trailing hyphen", host: "a-.example", valid: false},
+		{name: "underscore", host: "_dmarc.example", valid: false},
+		{name: "space", host: "a b.example", valid: false},
+		{name: "reserved hyphens", host: "ab--c.example", valid: false},
+		{name: "invalid punycode", host: "xn--a-ecp.example.xn--!!", valid: false},
+		{name: "punycode of ascii", host: "xn--abc-.example", valid: false},
+		{name: "non canonical punycode", host: "xn--Bcher-kva.example", valid: true},
+		{name: "leading combining mark", host: "́a.example", valid: false},
+		{name: "symbol allowed by UTS 46", host: "☃.example", valid: true},
+		{name: "long label", host: strings.Repeat("a", 64) + ".example", valid: false},
+		{name: "long host", host: strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHostname(tt.host)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateHostname(%q) error = %v", tt.host, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidHostname) {
+				t.Errorf("ValidateHostname(%q) error = %v, want ErrInvalidHostname", tt.host, err)
+			}
+		})
+	}
+}
+
+func TestSameHost(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: "Bücher.example:443", b: "xn--bcher-kva.example", expected: true},
+		{a: "EXAMPLE.com.", b: "example.com:8080", expected: true},
+		{a: "[::1]:80", b: "::1", expected: true},
+		{a: "a.example", b: "b.example", expected: false},
+		{a: "", b: "", expected: false},
+	}
+	for _, tt := range tests {
+		if got := SameHost(tt.a, tt.b); got != tt.expected {
+			t.Errorf("SameHost(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestInternationalizedSubdomains(t *testing.T) {
+	if got := EffectiveTLD("shop.例子.公司.cn"); got != "xn--55qx5d.cn" {
+		t.Errorf("EffectiveTLD() = %q, want %q", got, "xn--55qx5d.cn")
+	}
+	if got := RegistrableDomain("shop.xn--fsqu00a.xn--55qx5d.cn"); got != "xn--fsqu00a.xn--55qx5d.cn" {
+		t.Errorf("RegistrableDomain() = %q, want %q", got, "xn--fsqu00a.xn--55qx5d.cn")
+	}
+	if got := SubdomainLabels("Bücher.example.com"); len(got) != 1 || got[0] != "xn--bcher-kva" {
+		t.Errorf("SubdomainLabels() = %q, want [xn--bcher-kva]", got)
+	}
+}
@@ -0,0 +1,198 @@
+package req
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// DefaultMaxForwardedChain is the X-Forwarded-For length above which
+// GetIPWithOptions ignores the header and DetectIPAnomalies reports
+// IPAnomalyLongChain, unless IPOptions.MaxForwardedChain is set.
+const DefaultMaxForwardedChain = 10
+
+// IPAnomalyType identifies a kind of suspicious client IP information.
+type IPAnomalyType string
+
+const (
+	// IPAnomalyUntrustedProxy means forwarding headers were sent by a peer
+	// (RemoteAddr) that is not a trusted proxy.
+	IPAnomalyUntrustedProxy IPAnomalyType = "untrusted-proxy"
+	// IPAnomalyRealIPMismatch means X-Real-IP disagrees with the client
+	// selected from X-Forwarded-For.
+	IPAnomalyRealIPMismatch IPAnomalyType = "real-ip-mismatch"
+	// IPAnomalyPrivateAfterPublic means an untrusted private address follows
+	// a public address in X-Forwarded-For.
+	IPAnomalyPrivateAfterPublic IPAnomalyType = "private-after-public"
+	// IPAnomalyInvalidEntry means a header value is not a valid IP address.
+	IPAnomalyInvalidEntry IPAnomalyType = "invalid-entry"
+	// IPAnomalyLongChain means X-Forwarded-For has more entries than allowed.
+	IPAnomalyLongChain IPAnomalyType = "long-chain"
+)
+
+// IPAnomaly describes a single suspicious finding.
+type IPAnomaly struct {
+	Type    IPAnomalyType
+	Source  string // header name or IPSourceRemoteAddr
+	Value   string // raw offending value, if any
+	Message string
+}
+
+// IPAnomalyReport is the result of DetectIPAnomalies.
+type IPAnomalyReport struct {
+	// ClientIP is the IP selected by GetIPWithOptions with the same options
+	ClientIP string
+	// RemoteAddr is the normalized address of the direct peer
+	RemoteAddr string
+	// Chain holds the X-Forwarded-For entries in order
+	Chain []IPCandidate
+	// Anomalies holds the findings, empty if nothing suspicious was found
+	Anomalies []IPAnomaly
+}
+
+// HasAnomalies reports whether any anomaly was found.
+func (r IPAnomalyReport) HasAnomalies() bool {
+	return len(r.Anomalies) > 0
+}
+
+// Has reports whether an anomaly of the given type was found.
+func (r IPAnomalyReport) Has(t IPAnomalyType) bool {
+	for _, a := range r.Anomalies {
+		if a.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectIPAnomalies inspects the client IP headers of a request for signs of
+// spoofing or misconfigured proxies.
+//
+// Business logic:
+//   - forwarding headers (X-Forwarded-For, X-Real-IP, AdditionalHeaders) sent by
+//     a RemoteAddr outside TrustedProxies are reported as IPAnomalyUntrustedProxy;
+//     when TrustedProxies is empty, only non-public peers count as proxies
+//   - an X-Real-IP that differs from the client selected from X-Forwarded-For
+//     is reported as IPAnomalyRealIPMismatch
+//   - a private, non-trusted address following a public one in X-Forwarded-For
+//     is reported as IPAnomalyPrivateAfterPublic
+//   - header values that are not IP addresses are reported as IPAnomalyInvalidEntry
+//   - an X-Forwarded-For longer than MaxForwardedChain is reported as IPAnomalyLongChain
+//
+// Parameters:
+//   - r: The HTTP request
+//   - opts: The options used to resolve the client IP
+//
+// Returns:
+//   - IPAnomalyReport: the findings; a nil request yields an empty report
+func DetectIPAnomalies(r *http.Request, opts IPOptions) IPAnomalyReport {
+	report := IPAnomalyReport{}
+	if r == nil {
+		return report
+	}
+
+	trustedNets := parseCIDRs(opts.TrustedProxies)
+	remote := newIPCandidate(r.RemoteAddr, IPSourceRemoteAddr)
+	realIP := newIPCandidate(r.Header.Get("X-REAL-IP"), IPSourceRealIP)
+
+	report.ClientIP = GetIPWithOptions(r, opts)
+	report.RemoteAddr = remote.IP
+	report.Chain = splitForwardedFor(r.Header.Get("X-FORWARDED-FOR"))
+
+	add := func(t IPAnomalyType, source, value, message string) {
+		report.Anomalies = append(report.Anomalies, IPAnomaly{
+			Type:    t,
+			Source:  source,
+			Value:   value,
+			Message: message,
+		})
+	}
+
+	// Forwarding headers are only meaningful when set by a trusted proxy
+	forwardingHeaders := []string{}
+	if len(report.Chain) > 0 {
+		forwardingHeaders = append(forwardingHeaders, IPSourceForwardedFor)
+	}
+	if realIP.Raw != "" {
+		forwardingHeaders = append(forwardingHeaders, IPSourceRealIP)
+	}
+	for _, hdr := range opts.AdditionalHeaders {
+		if hdr != "" && r.Header.Get(hdr) != "" {
+			forwardingHeaders = append(forwardingHeaders, hdr)
+		}
+	}
+	if len(forwardingHeaders) > 0 && !isTrustedPeer(trustedNets, remote) {
+		for _, hdr := range forwardingHeaders {
+			add(IPAnomalyUntrustedProxy, hdr, remote.Raw,
+				fmt.Sprintf("%s sent by untrusted peer %q", hdr, remote.Raw))
+		}
+	}
+
+	// Invalid entries
+	for _, candidate := range report.Chain {
+		if !candidate.IsValid() {
+			add(IPAnomalyInvalidEntry, candidate.Source, candidate.Raw,
+				fmt.Sprintf("%s entry %q is not an IP address", candidate.Source, candidate.Raw))
+		}
+	}
+	if realIP.Raw != "" && !realIP.IsValid() {
+		add(IPAnomalyInvalidEntry, realIP.Source, realIP.Raw,
+			fmt.Sprintf("%s value %q is not an IP address", realIP.Source, realIP.Raw))
+	}
+	for _, hdr := range opts.AdditionalHeaders {
+		if hdr == "" {
+			continue
+		}
+		candidate := newIPCandidate(r.Header.Get(hdr), hdr)
+		if candidate.Raw != "" && !candidate.IsValid() {
+			add(IPAnomalyInvalidEntry, hdr, candidate.Raw,
+				fmt.Sprintf("%s value %q is not an IP address", hdr, candidate.Raw))
+		}
+	}
+
+	// Private addresses appearing after a public one
+	seenPublic := false
+	for _, candidate := range report.Chain {
+		if !candidate.IsValid() {
+			continue
+		}
+		if IsPublicIP(candidate.IP) {
+			seenPublic = true
+			continue
+		}
+		if seenPublic && IsPrivateIP(candidate.IP) && !containsIP(trustedNets, candidate.IP) {
+			add(IPAnomalyPrivateAfterPublic, candidate.Source, candidate.Raw,
+				fmt.Sprintf("private address %q follows a public address", candidate.Raw))
+		}
+	}
+
+	// X-Real-IP disagreeing with X-Forwarded-For
+	if realIP.IsValid() && len(report.Chain) > 0 {
+		xffOpts := opts
+		xffOpts.PreferForwardedFor = true
+		xffOpts.Validate = true
+		xffOpts.ReturnPrivateIfAllPrivate = true
+		xffClient := GetIPCandidateWithOptions(r, xffOpts)
+		if xffClient.Source == IPSourceForwardedFor && xffClient.IP != realIP.IP {
+			add(IPAnomalyRealIPMismatch, realIP.Source, realIP.Raw,
+				fmt.Sprintf("%s %q differs from %s client %q", realIP.Source, realIP.Raw, IPSourceForwardedFor, xffClient.IP))
+		}
+	}
+
+	// Unusually long chains
+	if maxChain := maxForwardedChain(opts); len(report.Chain) > maxChain {
+		add(IPAnomalyLongChain, IPSourceForwardedFor, "",
+			fmt.Sprintf("%s has %d entries, more than %d", IPSourceForwardedFor, len(report.Chain), maxChain))
+	}
+
+	return report
+}
+
+// isTrustedPeer reports whether the direct peer may set forwarding headers.
+// Without a trusted proxy list, any non-public peer is assumed to be a proxy.
+func isTrustedPeer(trustedNets []*net.IPNet, remote IPCandidate) bool {
+	if len(trustedNets) > 0 {
+		return containsIP(trustedNets, remote.IP)
+	}
+	return remote.IsValid() && !IsPublicIP(remote.IP)
+}
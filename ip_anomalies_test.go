@@ -0,0 +1,119 @@
+package req
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectIPAnomalies_Clean(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "8.8.8.8, 10.0.0.5")
+	r.Header.Set("X-REAL-IP", "8.8.8.8")
+
+	report := DetectIPAnomalies(r, IPOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+	if report.HasAnomalies() {
+		t.Fatalf("expected no anomalies, got %+v", report.Anomalies)
+	}
+	if report.ClientIP != "8.8.8.8" {
+		t.Fatalf("expected client 8.8.8.8, got %q", report.ClientIP)
+	}
+	if report.RemoteAddr != "10.0.0.1" {
+		t.Fatalf("expected remote 10.0.0.1, got %q", report.RemoteAddr)
+	}
+	if len(report.Chain) != 2 {
+		t.Fatalf("expected chain of 2, got %d", len(report.Chain))
+	}
+}
+
+func TestDetectIPAnomalies_UntrustedProxy(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "1.1.1.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "8.8.8.8")
+
+	report := DetectIPAnomalies(r, IPOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+	if !report.Has(IPAnomalyUntrustedProxy) {
+		t.Fatalf("expected untrusted proxy anomaly, got %+v", report.Anomalies)
+	}
+
+	// Without a trusted list, a public peer is not considered a proxy
+	report = DetectIPAnomalies(r, IPOptions{})
+	if !report.Has(IPAnomalyUntrustedProxy) {
+		t.Fatalf("expected untrusted proxy anomaly without trusted list, got %+v", report.Anomalies)
+	}
+
+	r.RemoteAddr = "192.168.0.2:1234"
+	report = DetectIPAnomalies(r, IPOptions{})
+	if report.Has(IPAnomalyUntrustedProxy) {
+		t.Fatalf("expected private peer to be treated as proxy, got %+v", report.Anomalies)
+	}
+}
+
+func TestDetectIPAnomalies_RealIPMismatch(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "8.8.8.8")
+	r.Header.Set("X-REAL-IP", "1.1.1.1")
+
+	report := DetectIPAnomalies(r, IPOptions{})
+	if !report.Has(IPAnomalyRealIPMismatch) {
+		t.Fatalf("expected real ip mismatch, got %+v", report.Anomalies)
+	}
+}
+
+func TestDetectIPAnomalies_PrivateAfterPublic(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "8.8.8.8, 192.168.1.1, 10.0.0.5")
+
+	report := DetectIPAnomalies(r, IPOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+	if !report.Has(IPAnomalyPrivateAfterPublic) {
+		t.Fatalf("expected private after public anomaly, got %+v", report.Anomalies)
+	}
+	for _, a := range report.Anomalies {
+		if a.Type == IPAnomalyPrivateAfterPublic && a.Value != "192.168.1.1" {
+			t.Fatalf("expected only 192.168.1.1 to be flagged, got %q", a.Value)
+		}
+	}
+}
+
+func TestDetectIPAnomalies_InvalidEntries(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "not-an-ip, 8.8.8.8")
+	r.Header.Set("CF-Connecting-IP", "garbage")
+
+	report := DetectIPAnomalies(r, IPOptions{AdditionalHeaders: []string{"CF-Connecting-IP"}})
+	count := 0
+	for _, a := range report.Anomalies {
+		if a.Type == IPAnomalyInvalidEntry {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 invalid entries, got %d: %+v", count, report.Anomalies)
+	}
+}
+
+func TestDetectIPAnomalies_LongChain(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", strings.TrimSuffix(strings.Repeat("8.8.8.8,", 5), ","))
+
+	report := DetectIPAnomalies(r, IPOptions{MaxForwardedChain: 4})
+	if !report.Has(IPAnomalyLongChain) {
+		t.Fatalf("expected long chain anomaly, got %+v", report.Anomalies)
+	}
+
+	report = DetectIPAnomalies(r, IPOptions{})
+	if report.Has(IPAnomalyLongChain) {
+		t.Fatalf("expected no long chain anomaly with default limit, got %+v", report.Anomalies)
+	}
+}
+
+func TestDetectIPAnomalies_NilRequest(t *testing.T) {
+	if report := DetectIPAnomalies(nil, IPOptions{}); report.HasAnomalies() {
+		t.Fatalf("expected empty report, got %+v", report)
+	}
+}
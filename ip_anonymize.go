@@ -0,0 +1,136 @@
+package req
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Common truncation prefixes for privacy-compliant logging.
+const (
+	DefaultAnonymizeV4Bits = 24 // keep the /24, e.g. 203.0.113.0
+	DefaultAnonymizeV6Bits = 48 // keep the /48, e.g. 2001:db8:1::
+)
+
+// IPAnonymizer transforms a client IP before it is returned by
+// GetIPWithOptions (see IPOptions.Anonymizer).
+type IPAnonymizer interface {
+	Anonymize(ip string) string
+}
+
+// AnonymizeIP truncates an IP address by keeping only its leading bits and
+// zeroing the rest. IPv4-mapped IPv6 addresses are treated as IPv4.
+//
+// Parameters:
+//   - ip: The IP address to anonymize (normalized with NormalizeIP first)
+//   - v4Bits: The number of leading bits to keep for IPv4 addresses (0-32)
+//   - v6Bits: The number of leading bits to keep for IPv6 addresses (0-128)
+//
+// Returns:
+//   - string: the truncated address, or an empty string if ip is not an IP
+func AnonymizeIP(ip string, v4Bits, v6Bits int) string {
+	parsed := net.ParseIP(NormalizeIP(ip))
+	if parsed == nil {
+		return ""
+	}
+	if ip4 := parsed.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(clampBits(v4Bits, 32), 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(clampBits(v6Bits, 128), 128)).String()
+}
+
+// IPTruncation is an IPAnonymizer that truncates addresses with AnonymizeIP.
+type IPTruncation struct {
+	V4Bits int
+	V6Bits int
+}
+
+// Anonymize implements IPAnonymizer.
+func (t IPTruncation) Anonymize(ip string) string {
+	return AnonymizeIP(ip, t.V4Bits, t.V6Bits)
+}
+
+// IPPseudonymizer is an IPAnonymizer that replaces an IP address with a
+// keyed token. The same address maps to the same token within a rotation
+// period (a UTC day by default), and to an unrelated token in the next one.
+//
+// The per-period salt is derived from Key with HMAC-SHA256, so every
+// instance sharing the key produces the same tokens without coordination.
+type IPPseudonymizer struct {
+	// Key is the secret used to derive the rotating salt. Without it the
+	// small IPv4 space could be brute-forced, so an empty Key yields
+	// empty tokens.
+	Key []byte
+	// Rotation is the salt lifetime; zero means 24 hours
+	Rotation time.Duration
+	// Now returns the current time; nil means time.Now
+	Now func() time.Time
+}
+
+// NewIPPseudonymizer returns a pseudonymizer with a daily rotating salt.
+//
+// Returns:
+//   - *IPPseudonymizer: the pseudonymizer
+//   - error: for an empty key
+func NewIPPseudonymizer(key []byte) (*IPPseudonymizer, error) {
+	if len(key) == 0 {
+		return nil, errors.New("req: empty IP pseudonymization key")
+	}
+	return &IPPseudonymizer{Key: key}, nil
+}
+
+// Anonymize implements IPAnonymizer. It returns an empty string for an
+// empty ip or an empty Key.
+func (p *IPPseudonymizer) Anonymize(ip string) string {
+	return p.PseudonymizeAt(ip, p.now())
+}
+
+// PseudonymizeAt returns the token for ip in the rotation period containing t.
+func (p *IPPseudonymizer) PseudonymizeAt(ip string, t time.Time) string {
+	if ip == "" || len(p.Key) == 0 {
+		return ""
+	}
+	if normalized := NormalizeIP(ip); normalized != "" {
+		ip = normalized
+	}
+
+	mac := hmac.New(sha256.New, p.salt(t))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// salt derives the salt for the rotation period containing t.
+func (p *IPPseudonymizer) salt(t time.Time) []byte {
+	rotation := p.Rotation
+	if rotation <= 0 {
+		rotation = 24 * time.Hour
+	}
+	period := t.UTC().UnixNano() / int64(rotation)
+
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte("req-ip-salt:" + strconv.FormatInt(period, 10)))
+	return mac.Sum(nil)
+}
+
+// now returns the current time.
+func (p *IPPseudonymizer) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// clampBits limits bits to the range [0, max].
+func clampBits(bits, max int) int {
+	if bits < 0 {
+		return 0
+	}
+	if bits > max {
+		return max
+	}
+	return bits
+}
@@ -0,0 +1,90 @@
+package req
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		v4Bits int
+		v6Bits int
+		want   string
+	}{
+		{"203.0.113.77", 24, 48, "203.0.113.0"},
+		{"203.0.113.77", 16, 48, "203.0.0.0"},
+		{"203.0.113.77:8080", 24, 48, "203.0.113.0"},
+		{"::ffff:203.0.113.77", 24, 48, "203.0.113.0"},
+		{"2001:db8:1234:5678::1", 24, 48, "2001:db8:1234::"},
+		{"[2001:db8:1234:5678::1]:443", 24, 64, "2001:db8:1234:5678::"},
+		{"203.0.113.77", 40, 48, "203.0.113.77"},
+		{"203.0.113.77", -1, 48, "0.0.0.0"},
+		{"not-an-ip", 24, 48, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := AnonymizeIP(tt.ip, tt.v4Bits, tt.v6Bits); got != tt.want {
+				t.Errorf("AnonymizeIP(%q, %d, %d) = %q, want %q", tt.ip, tt.v4Bits, tt.v6Bits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPPseudonymizer(t *testing.T) {
+	day := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	p, err := NewIPPseudonymizer([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Now = func() time.Time { return day }
+
+	token := p.Anonymize("203.0.113.7")
+	if len(token) != 16 {
+		t.Fatalf("expected 16 character token, got %q", token)
+	}
+	if p.Anonymize("203.0.113.7:1234") != token {
+		t.Fatal("expected normalized address to map to the same token")
+	}
+	if p.PseudonymizeAt("203.0.113.7", day.Add(12*time.Hour)) != token {
+		t.Fatal("expected the same token later on the same day")
+	}
+	if p.PseudonymizeAt("203.0.113.7", day.Add(24*time.Hour)) == token {
+		t.Fatal("expected a different token on the next day")
+	}
+	if p.Anonymize("203.0.113.8") == token {
+		t.Fatal("expected different addresses to map to different tokens")
+	}
+
+	other := &IPPseudonymizer{Key: []byte("other"), Now: p.Now}
+	if other.Anonymize("203.0.113.7") == token {
+		t.Fatal("expected different keys to produce different tokens")
+	}
+	if p.Anonymize("") != "" {
+		t.Fatal("expected empty token for empty ip")
+	}
+
+	if _, err := NewIPPseudonymizer(nil); err == nil {
+		t.Fatal("expected an error for an empty key")
+	}
+	if token := (&IPPseudonymizer{}).Anonymize("203.0.113.7"); token != "" {
+		t.Fatalf("expected empty token without a key, got %q", token)
+	}
+}
+
+func TestGetIPWithOptions_Anonymizer(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-REAL-IP", "198.51.100.23")
+
+	ip := GetIPWithOptions(r, IPOptions{Anonymizer: IPTruncation{V4Bits: DefaultAnonymizeV4Bits, V6Bits: DefaultAnonymizeV6Bits}})
+	if ip != "198.51.100.0" {
+		t.Fatalf("expected 198.51.100.0, got %q", ip)
+	}
+
+	candidate := GetIPCandidateWithOptions(r, IPOptions{Anonymizer: IPTruncation{V4Bits: 24}})
+	if candidate.IP != "198.51.100.23" {
+		t.Fatalf("expected candidate to keep full address, got %q", candidate.IP)
+	}
+}
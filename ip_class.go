@@ -0,0 +1,198 @@
+package req
+
+import (
+	"net"
+	"strings"
+)
+
+// IPClassification describes the kind of address space an IP belongs to.
+type IPClassification string
+
+const (
+	// IPInvalid is returned when the value does not parse as an IP address.
+	IPInvalid IPClassification = "invalid"
+	// IPPublic is a globally routable unicast address.
+	IPPublic IPClassification = "public"
+	// IPPrivate is a private-use address (RFC 1918, IPv6 ULA).
+	IPPrivate IPClassification = "private"
+	// IPLoopback is a loopback address (127.0.0.0/8, ::1).
+	IPLoopback IPClassification = "loopback"
+	// IPLinkLocal is a link-local address (169.254.0.0/16, fe80::/10).
+	IPLinkLocal IPClassification = "link-local"
+	// IPMulticast is a multicast address (224.0.0.0/4, ff00::/8).
+	IPMulticast IPClassification = "multicast"
+	// IPReserved is an address reserved by IANA for special purposes
+	// (benchmarking, protocol assignments, future use, ...).
+	IPReserved IPClassification = "reserved"
+	// IPDocumentation is an address reserved for documentation and examples.
+	IPDocumentation IPClassification = "documentation"
+	// IPShared is the shared address space used by carrier-grade NAT (RFC 6598).
+	IPShared IPClassification = "shared"
+	// IPBogon is an address that must never appear as a source on the
+	// public internet (unspecified, "this network", unallocated space).
+	IPBogon IPClassification = "bogon"
+)
+
+// ipClassRange maps a network to its classification.
+type ipClassRange struct {
+	network *net.IPNet
+	class   IPClassification
+}
+
+// ipv4ClassRanges follows the IANA IPv4 Special-Purpose Address Registry.
+// More specific ranges must come before the ranges that contain them.
+var ipv4ClassRanges = mustClassRanges([]struct {
+	cidr  string
+	class IPClassification
+}{
+	{"0.0.0.0/8", IPBogon},               // RFC 791 "this network"
+	{"10.0.0.0/8", IPPrivate},            // RFC 1918
+	{"100.64.0.0/10", IPShared},          // RFC 6598
+	{"127.0.0.0/8", IPLoopback},          // RFC 1122
+	{"169.254.0.0/16", IPLinkLocal},      // RFC 3927
+	{"172.16.0.0/12", IPPrivate},         // RFC 1918
+	{"192.0.0.0/24", IPReserved},         // RFC 6890 IETF protocol assignments
+	{"192.0.2.0/24", IPDocumentation},    // RFC 5737 TEST-NET-1
+	{"192.88.99.0/24", IPReserved},       // RFC 7526 deprecated 6to4 relay anycast
+	{"192.168.0.0/16", IPPrivate},        // RFC 1918
+	{"198.18.0.0/15", IPReserved},        // RFC 2544 benchmarking
+	{"198.51.100.0/24", IPDocumentation}, // RFC 5737 TEST-NET-2
+	{"203.0.113.0/24", IPDocumentation},  // RFC 5737 TEST-NET-3
+	{"224.0.0.0/4", IPMulticast},         // RFC 5771
+	{"240.0.0.0/4", IPReserved},          // RFC 1112 future use, includes 255.255.255.255
+})
+
+// ipv6ClassRanges follows the IANA IPv6 Special-Purpose Address Registry.
+// IPv4-mapped, NAT64, 6to4 and Teredo addresses are handled separately
+// by classifying the embedded IPv4 address.
+//
+// The local-use NAT64 prefix 64:ff9b:1::/48 is not unwrapped like
+// 64:ff9b::/96: each operator picks its own RFC 6052 prefix length inside
+// it, so the position of the IPv4 address is unknown. Like a ULA it is only
+// meaningful within one network and is not globally reachable, hence private.
+var ipv6ClassRanges = mustClassRanges([]struct {
+	cidr  string
+	class IPClassification
+}{
+	{"::/128", IPBogon},                // RFC 4291 unspecified
+	{"::1/128", IPLoopback},            // RFC 4291
+	{"::/96", IPBogon},                 // RFC 4291 deprecated IPv4-compatible
+	{"64:ff9b:1::/48", IPPrivate},      // RFC 8215 local-use IPv4/IPv6 translation, see above
+	{"100::/64", IPReserved},           // RFC 6666 discard-only
+	{"2001:2::/48", IPReserved},        // RFC 5180 benchmarking
+	{"2001:db8::/32", IPDocumentation}, // RFC 3849
+	{"2001::/23", IPReserved},          // RFC 2928 IETF protocol assignments
+	{"3fff::/20", IPDocumentation},     // RFC 9637
+	{"2000::/3", IPPublic},             // global unicast
+	{"fc00::/7", IPPrivate},            // RFC 4193 unique local
+	{"fe80::/10", IPLinkLocal},         // RFC 4291
+	{"fec0::/10", IPReserved},          // RFC 3879 deprecated site-local
+	{"ff00::/8", IPMulticast},          // RFC 4291
+})
+
+var (
+	nat64Prefix  = mustParseCIDR("64:ff9b::/96") // RFC 6052
+	sixToFourNet = mustParseCIDR("2002::/16")    // RFC 3056
+	teredoNet    = mustParseCIDR("2001::/32")    // RFC 4380
+)
+
+// IPClass classifies an IP address according to the IANA special-purpose
+// address registries.
+//
+// IPv4-mapped (::ffff:0:0/96) and NAT64 (64:ff9b::/96) addresses are
+// classified by their embedded IPv4 address. 6to4 (2002::/16) and Teredo
+// (2001::/32) addresses are classified by the IPv4 address of the tunnel
+// client they encode. Local-use NAT64 addresses (64:ff9b:1::/48) are
+// always IPPrivate, as their layout is site-specific.
+//
+// Parameters:
+//   - ipStr: The IP address to classify
+//
+// Returns:
+//   - IPClassification: the class of the address, or IPInvalid if it does not parse
+func IPClass(ipStr string) IPClassification {
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return IPInvalid
+	}
+	return classifyIP(ip)
+}
+
+// IsPublicIP checks if an IP address is globally routable, i.e. it is not
+// private, shared, loopback, link-local, multicast, documentation, reserved
+// or bogon address space.
+//
+// Parameters:
+//   - ipStr: The IP address to check
+//
+// Returns:
+//   - bool: true if the IP is public, false otherwise
+func IsPublicIP(ipStr string) bool {
+	return IPClass(ipStr) == IPPublic
+}
+
+// classifyIP classifies a parsed IP address.
+func classifyIP(ip net.IP) IPClassification {
+	// To4 also unwraps IPv4-mapped IPv6 addresses
+	if ip4 := ip.To4(); ip4 != nil {
+		return classifyInRanges(ip4, ipv4ClassRanges)
+	}
+
+	if embedded := embeddedIPv4(ip); embedded != nil {
+		return classifyInRanges(embedded, ipv4ClassRanges)
+	}
+
+	return classifyInRanges(ip, ipv6ClassRanges)
+}
+
+// classifyInRanges returns the class of the first range containing ip.
+// Addresses outside every listed range are public for IPv4 and bogon
+// (unallocated) for IPv6.
+func classifyInRanges(ip net.IP, ranges []ipClassRange) IPClassification {
+	for _, r := range ranges {
+		if r.network.Contains(ip) {
+			return r.class
+		}
+	}
+	if ip.To4() != nil {
+		return IPPublic
+	}
+	return IPBogon
+}
+
+// embeddedIPv4 returns the IPv4 address carried by NAT64, 6to4 and Teredo
+// addresses, or nil if ip is not one of those.
+func embeddedIPv4(ip net.IP) net.IP {
+	ip = ip.To16()
+	switch {
+	case nat64Prefix.Contains(ip):
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15]).To4()
+	case sixToFourNet.Contains(ip):
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5]).To4()
+	case teredoNet.Contains(ip):
+		// The Teredo client address is stored with all bits inverted
+		return net.IPv4(^ip[12], ^ip[13], ^ip[14], ^ip[15]).To4()
+	}
+	return nil
+}
+
+// mustClassRanges parses a classification table, panicking on invalid CIDRs.
+func mustClassRanges(entries []struct {
+	cidr  string
+	class IPClassification
+}) []ipClassRange {
+	out := make([]ipClassRange, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, ipClassRange{network: mustParseCIDR(e.cidr), class: e.class})
+	}
+	return out
+}
+
+// mustParseCIDR parses a CIDR, panicking if it is invalid.
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic("req: invalid CIDR " + cidr)
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+package req
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPClass(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want IPClassification
+	}{
+		{"8.8.8.8", IPPublic},
+		{"2606:4700:4700::1111", IPPublic},
+		{"10.1.2.3", IPPrivate},
+		{"172.20.0.1", IPPrivate},
+		{"192.168.1.1", IPPrivate},
+		{"fd12:3456::1", IPPrivate},
+		{"100.64.0.1", IPShared},
+		{"127.0.0.1", IPLoopback},
+		{"::1", IPLoopback},
+		{"169.254.10.10", IPLinkLocal},
+		{"fe80::1", IPLinkLocal},
+		{"224.0.0.251", IPMulticast},
+		{"ff02::1", IPMulticast},
+		{"192.0.2.10", IPDocumentation},
+		{"198.51.100.7", IPDocumentation},
+		{"203.0.113.9", IPDocumentation},
+		{"2001:db8::1", IPDocumentation},
+		{"198.18.0.1", IPReserved},
+		{"198.19.255.255", IPReserved},
+		{"240.0.0.1", IPReserved},
+		{"255.255.255.255", IPReserved},
+		{"0.0.0.0", IPBogon},
+		{"0.1.2.3", IPBogon},
+		{"::", IPBogon},
+		{"4000::1", IPBogon},
+		{"::ffff:10.0.0.1", IPPrivate},
+		{"::ffff:8.8.8.8", IPPublic},
+		{"::ffff:127.0.0.1", IPLoopback},
+		{"64:ff9b::808:808", IPPublic},
+		{"64:ff9b::a00:1", IPPrivate},
+		{"64:ff9b:1::808:808", IPPrivate},                   // local-use NAT64 is never unwrapped
+		{"2002:c0a8:0101::1", IPPrivate},                    // 6to4 for 192.168.1.1
+		{"2002:0808:0808::1", IPPublic},                     // 6to4 for 8.8.8.8
+		{"2001:0:4136:e378:8000:63bf:f7f7:f7f7", IPPublic},  // Teredo client 8.8.8.8
+		{"2001:0:4136:e378:8000:63bf:f5ff:fffe", IPPrivate}, // Teredo client 10.0.0.1
+		{" 8.8.4.4 ", IPPublic},
+		{"not-an-ip", IPInvalid},
+		{"", IPInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IPClass(tt.ip); got != tt.want {
+				t.Errorf("IPClass(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	if !IsPublicIP("1.1.1.1") {
+		t.Error("expected 1.1.1.1 to be public")
+	}
+	for _, ip := range []string{"10.0.0.1", "127.0.0.1", "203.0.113.1", "::1", "invalid"} {
+		if IsPublicIP(ip) {
+			t.Errorf("expected %q not to be public", ip)
+		}
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	for _, ip := range []string{"10.0.0.1", "100.64.1.1", "169.254.1.1", "fd00::1", "fe80::1", "::ffff:192.168.0.1"} {
+		if !IsPrivateIP(ip) {
+			t.Errorf("expected %q to be private", ip)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "127.0.0.1", "::1", "invalid"} {
+		if IsPrivateIP(ip) {
+			t.Errorf("expected %q not to be private", ip)
+		}
+	}
+}
+
+func TestGetIP_XFFSkipsNonPublic(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-FORWARDED-FOR", "127.0.0.1, 203.0.113.5, 100.64.0.2, 8.8.8.8, 10.0.0.1")
+	if ip := GetIP(r); ip != "8.8.8.8" {
+		t.Fatalf("expected 8.8.8.8, got %q", ip)
+	}
+
+	r.Header.Set("X-FORWARDED-FOR", "10.0.0.1, 198.18.0.1")
+	if ip := GetIP(r); ip != "198.18.0.1" {
+		t.Fatalf("expected last entry 198.18.0.1, got %q", ip)
+	}
+}
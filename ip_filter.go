@@ -0,0 +1,216 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IPList is a set of networks an IP address can be checked against.
+// Implementations must be safe for concurrent use.
+type IPList interface {
+	Contains(ip string) bool
+}
+
+// StaticIPList is an IPList built from a fixed set of networks.
+type StaticIPList []*net.IPNet
+
+// NewIPList builds an IPList from CIDRs or single IPs, using the same format
+// as IPOptions.TrustedProxies. Invalid entries are ignored.
+func NewIPList(cidrs ...string) StaticIPList {
+	return StaticIPList(parseCIDRs(cidrs))
+}
+
+// Contains implements IPList.
+func (l StaticIPList) Contains(ip string) bool {
+	return containsIP(l, NormalizeIP(ip))
+}
+
+// FileIPList is an IPList read from a file with one CIDR or IP per line.
+// Empty lines and text after '#' are ignored. The file is reloaded when it
+// changes, without interrupting concurrent lookups.
+type FileIPList struct {
+	fileReloader[[]*net.IPNet]
+}
+
+// OpenIPListFile reads an IP list file. If reloadInterval is positive, the
+// file is checked for changes at that interval until Close is called.
+func OpenIPListFile(path string, reloadInterval time.Duration) (*FileIPList, error) {
+	l := &FileIPList{}
+	if err := l.open(path, reloadInterval, parseIPListFile); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Contains implements IPList.
+func (l *FileIPList) Contains(ip string) bool {
+	return containsIP(l.current(), NormalizeIP(ip))
+}
+
+// parseIPListFile parses one CIDR or IP per line, rejecting invalid entries.
+func parseIPListFile(data []byte) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		entry := scanner.Text()
+		if i := strings.Index(entry, "#"); i != -1 {
+			entry = entry[:i]
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parsed := parseCIDRs([]string{entry})
+		if len(parsed) == 0 {
+			return nil, fmt.Errorf("req: invalid entry %q on line %d", entry, line)
+		}
+		nets = append(nets, parsed...)
+	}
+	return nets, scanner.Err()
+}
+
+// IPFilterPolicy decides which client IPs may access a route.
+//
+// Business logic:
+// - an IP contained in Deny is rejected
+// - if Allow is set, an IP not contained in it is rejected
+// - otherwise the IP is accepted
+type IPFilterPolicy struct {
+	Allow IPList // nil means every IP not denied is allowed
+	Deny  IPList // nil means nothing is denied
+}
+
+// IPFilterRoute applies a policy to requests whose path is PathPrefix or
+// below it: "/admin" matches "/admin" and "/admin/users", not "/administrator".
+type IPFilterRoute struct {
+	PathPrefix string
+	Policy     IPFilterPolicy
+}
+
+// IPFilterOptions configures NewIPFilter.
+type IPFilterOptions struct {
+	// IPOptions controls how the client IP is resolved (see
+	// GetIPCandidateWithOptions).
+	IPOptions IPOptions
+	// Policy applies to requests not matching any route.
+	Policy IPFilterPolicy
+	// Routes overrides Policy for path prefixes; the longest prefix wins.
+	Routes []IPFilterRoute
+	// DryRun logs rejections but lets every request through.
+	DryRun bool
+	// Logger receives rejections; nil means slog.Default().
+	Logger *slog.Logger
+	// DeniedHandler responds to rejected requests; nil means 403 Forbidden.
+	DeniedHandler http.Handler
+}
+
+// IPFilterDecision is the outcome of checking a request.
+type IPFilterDecision struct {
+	IP      string
+	Allowed bool
+	Reason  string // "allowed", "denied" or "not-allowed"
+	Route   string // matched PathPrefix, empty for the default policy
+}
+
+// IPFilter checks client IPs against allow and deny lists.
+type IPFilter struct {
+	opts IPFilterOptions
+}
+
+// NewIPFilter creates an IP filter.
+func NewIPFilter(opts IPFilterOptions) *IPFilter {
+	return &IPFilter{opts: opts}
+}
+
+// IPFilterMiddleware returns middleware that rejects requests whose client
+// IP is not allowed by the configured policies.
+//
+// Example:
+//
+//	deny, _ := req.OpenIPListFile("/etc/app/deny.txt", time.Minute)
+//	mw := req.IPFilterMiddleware(req.IPFilterOptions{
+//	    IPOptions: req.IPOptions{TrustedProxies: []string{"10.0.0.0/8"}},
+//	    Policy:    req.IPFilterPolicy{Deny: deny},
+//	    Routes: []req.IPFilterRoute{
+//	        {PathPrefix: "/admin", Policy: req.IPFilterPolicy{Allow: req.NewIPList("192.0.2.0/24")}},
+//	    },
+//	})
+//	http.ListenAndServe(":8080", mw(handler))
+func IPFilterMiddleware(opts IPFilterOptions) func(http.Handler) http.Handler {
+	return NewIPFilter(opts).Middleware
+}
+
+// Check evaluates the policy matching the request.
+func (f *IPFilter) Check(r *http.Request) IPFilterDecision {
+	policy, route := f.policyFor(r)
+	ip := GetIPCandidateWithOptions(r, f.opts.IPOptions).IP
+
+	decision := IPFilterDecision{IP: ip, Allowed: true, Reason: "allowed", Route: route}
+	switch {
+	case policy.Deny != nil && policy.Deny.Contains(ip):
+		decision.Allowed, decision.Reason = false, "denied"
+	case policy.Allow != nil && !policy.Allow.Contains(ip):
+		decision.Allowed, decision.Reason = false, "not-allowed"
+	}
+	return decision
+}
+
+// Middleware wraps next with the filter.
+func (f *IPFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision := f.Check(r)
+		if decision.Allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		f.logger().Warn("req: IP filter rejected request",
+			"ip", decision.IP,
+			"reason", decision.Reason,
+			"route", decision.Route,
+			"path", r.URL.Path,
+			"dry_run", f.opts.DryRun,
+		)
+		if f.opts.DryRun {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if f.opts.DeniedHandler != nil {
+			f.opts.DeniedHandler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+// policyFor returns the policy of the longest matching route.
+func (f *IPFilter) policyFor(r *http.Request) (IPFilterPolicy, string) {
+	policy, route := f.opts.Policy, ""
+	for _, rt := range f.opts.Routes {
+		if pathHasPrefix(r.URL.Path, rt.PathPrefix) && len(rt.PathPrefix) >= len(route) {
+			policy, route = rt.Policy, rt.PathPrefix
+		}
+	}
+	return policy, route
+}
+
+// pathHasPrefix reports whether path is prefix or below it, respecting
+// path segment boundaries.
+func pathHasPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// logger returns the configured logger.
+func (f *IPFilter) logger() *slog.Logger {
+	if f.opts.Logger != nil {
+		return f.opts.Logger
+	}
+	return slog.Default()
+}
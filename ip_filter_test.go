@@ -0,0 +1,157 @@
+package req
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveFiltered(t *testing.T, opts IPFilterOptions, path, remoteAddr string) int {
+	t.Helper()
+	handler := IPFilterMiddleware(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := httptest.NewRequest("GET", path, nil)
+	r.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestIPFilter_AllowDeny(t *testing.T) {
+	opts := IPFilterOptions{
+		Policy: IPFilterPolicy{
+			Allow: NewIPList("203.0.113.0/24", "198.51.100.7"),
+			Deny:  NewIPList("203.0.113.66"),
+		},
+		Logger: discardLogger(),
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"203.0.113.5:1234", http.StatusOK},
+		{"198.51.100.7:1234", http.StatusOK},
+		{"203.0.113.66:1234", http.StatusForbidden},
+		{"8.8.8.8:1234", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := serveFiltered(t, opts, "/", tt.remoteAddr); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilter_Routes(t *testing.T) {
+	opts := IPFilterOptions{
+		Routes: []IPFilterRoute{
+			{PathPrefix: "/admin", Policy: IPFilterPolicy{Allow: NewIPList("10.0.0.0/8")}},
+			{PathPrefix: "/admin/public", Policy: IPFilterPolicy{}},
+		},
+		Logger: discardLogger(),
+	}
+
+	if got := serveFiltered(t, opts, "/", "8.8.8.8:1"); got != http.StatusOK {
+		t.Errorf("expected default policy to allow, got %d", got)
+	}
+	if got := serveFiltered(t, opts, "/admin/users", "8.8.8.8:1"); got != http.StatusForbidden {
+		t.Errorf("expected admin route to deny, got %d", got)
+	}
+	if got := serveFiltered(t, opts, "/admin/users", "10.1.1.1:1"); got != http.StatusOK {
+		t.Errorf("expected admin route to allow internal IP, got %d", got)
+	}
+	if got := serveFiltered(t, opts, "/admin/public/x", "8.8.8.8:1"); got != http.StatusOK {
+		t.Errorf("expected longest prefix to win, got %d", got)
+	}
+	if got := serveFiltered(t, opts, "/admin", "8.8.8.8:1"); got != http.StatusForbidden {
+		t.Errorf("expected admin route to match its own path, got %d", got)
+	}
+	if got := serveFiltered(t, opts, "/administrator", "8.8.8.8:1"); got != http.StatusOK {
+		t.Errorf("expected admin route not to match /administrator, got %d", got)
+	}
+}
+
+func TestIPFilter_UsesIPOptions(t *testing.T) {
+	filter := NewIPFilter(IPFilterOptions{
+		IPOptions: IPOptions{TrustedProxies: []string{"10.0.0.0/8"}, PreferForwardedFor: true},
+		Policy:    IPFilterPolicy{Deny: NewIPList("198.51.100.0/24")},
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-FORWARDED-FOR", "198.51.100.9, 10.0.0.2")
+
+	decision := filter.Check(r)
+	if decision.Allowed || decision.IP != "198.51.100.9" || decision.Reason != "denied" {
+		t.Fatalf("unexpected decision %+v", decision)
+	}
+}
+
+func TestIPFilter_DryRun(t *testing.T) {
+	var logs bytes.Buffer
+	opts := IPFilterOptions{
+		Policy: IPFilterPolicy{Deny: NewIPList("8.8.8.8")},
+		DryRun: true,
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	if got := serveFiltered(t, opts, "/", "8.8.8.8:1"); got != http.StatusOK {
+		t.Fatalf("expected dry run to let the request through, got %d", got)
+	}
+	if !strings.Contains(logs.String(), "ip=8.8.8.8") || !strings.Contains(logs.String(), "dry_run=true") {
+		t.Fatalf("expected rejection to be logged, got %q", logs.String())
+	}
+}
+
+func TestIPFilter_DeniedHandler(t *testing.T) {
+	opts := IPFilterOptions{
+		Policy: IPFilterPolicy{Deny: NewIPList("8.8.8.8")},
+		DeniedHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		Logger: discardLogger(),
+	}
+	if got := serveFiltered(t, opts, "/", "8.8.8.8:1"); got != http.StatusTeapot {
+		t.Fatalf("expected custom denied handler, got %d", got)
+	}
+}
+
+func TestFileIPList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	writeFile(t, path, "# blocked networks\n203.0.113.0/24\n\n198.51.100.7 # single host\n")
+
+	list, err := OpenIPListFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	if !list.Contains("203.0.113.9") || !list.Contains("198.51.100.7:443") || list.Contains("8.8.8.8") {
+		t.Fatal("unexpected list contents")
+	}
+
+	writeFile(t, path, "8.8.8.0/24\n")
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(path, future, future)
+	if err := list.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !list.Contains("8.8.8.8") || list.Contains("203.0.113.9") {
+		t.Fatal("expected reloaded contents")
+	}
+
+	writeFile(t, path, "not-a-network\n")
+	future = future.Add(time.Hour)
+	os.Chtimes(path, future, future)
+	if err := list.Reload(); err == nil {
+		t.Fatal("expected error for invalid entry")
+	}
+	if !list.Contains("8.8.8.8") {
+		t.Fatal("expected previous contents to stay in use")
+	}
+}
@@ -0,0 +1,130 @@
+package req
+
+import (
+	"net"
+	"strings"
+)
+
+// Sources reported in IPCandidate.Source.
+const (
+	IPSourceRealIP       = "X-Real-IP"
+	IPSourceForwardedFor = "X-Forwarded-For"
+	IPSourceRemoteAddr   = "RemoteAddr"
+)
+
+// IPCandidate is a client IP candidate taken from a request header or
+// from RemoteAddr.
+type IPCandidate struct {
+	// Raw is the value exactly as received (whitespace trimmed)
+	Raw string
+	// IP is the normalized address, or empty if Raw is not an IP address
+	IP string
+	// Source is the header name the value came from, or IPSourceRemoteAddr
+	Source string
+}
+
+// Value returns the normalized IP if Raw parsed as an IP address,
+// otherwise Raw itself.
+func (c IPCandidate) Value() string {
+	if c.IP != "" {
+		return c.IP
+	}
+	return c.Raw
+}
+
+// IsValid reports whether the candidate parsed as an IP address.
+func (c IPCandidate) IsValid() bool {
+	return c.IP != ""
+}
+
+// NormalizeIP cleans up an IP address as commonly sent by proxies in
+// X-Forwarded-For, X-Real-IP and similar headers.
+//
+// Business logic:
+// - surrounding whitespace and double quotes are removed
+// - a port is stripped ("1.2.3.4:5678", "[2001:db8::1]:443")
+// - square brackets are stripped ("[::1]")
+// - an IPv6 zone is stripped ("fe80::1%eth0")
+// - IPv4-mapped IPv6 addresses are unmapped ("::ffff:1.2.3.4" becomes "1.2.3.4")
+// - IPv6 addresses are returned in their canonical compressed form
+//
+// Parameters:
+//   - raw: The value to normalize
+//
+// Returns:
+//   - string: the normalized IP address, or an empty string if raw is not an IP
+func NormalizeIP(raw string) string {
+	host := strings.TrimSpace(raw)
+	host = strings.TrimSpace(strings.Trim(host, `"`))
+	if host == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end == -1 {
+			return ""
+		}
+		rest := host[end+1:]
+		if rest != "" && !isPortSuffix(rest) {
+			return ""
+		}
+		host = host[1:end]
+	} else if strings.Count(host, ":") == 1 {
+		// Only IPv4 addresses can carry a port without brackets
+		i := strings.Index(host, ":")
+		if !isPortSuffix(host[i:]) {
+			return ""
+		}
+		host = host[:i]
+	}
+
+	if i := strings.Index(host, "%"); i != -1 {
+		host = host[:i]
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.String()
+}
+
+// newIPCandidate builds a candidate from a raw value and its source.
+func newIPCandidate(raw, source string) IPCandidate {
+	raw = strings.TrimSpace(raw)
+	return IPCandidate{Raw: raw, IP: NormalizeIP(raw), Source: source}
+}
+
+// splitForwardedFor splits an X-Forwarded-For value into candidates,
+// skipping empty entries.
+func splitForwardedFor(xff string) []IPCandidate {
+	if xff == "" {
+		return nil
+	}
+	var out []IPCandidate
+	for _, part := range strings.Split(xff, ",") {
+		candidate := newIPCandidate(part, IPSourceForwardedFor)
+		if candidate.Raw == "" {
+			continue
+		}
+		out = append(out, candidate)
+	}
+	return out
+}
+
+// isPortSuffix reports whether s is ":" followed by one or more digits.
+func isPortSuffix(s string) bool {
+	if len(s) < 2 || s[0] != ':' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package req
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"1.2.3.4", "1.2.3.4"},
+		{" 1.2.3.4 ", "1.2.3.4"},
+		{"1.2.3.4:5678", "1.2.3.4"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{`"[::1]"`, "::1"},
+		{`"1.2.3.4"`, "1.2.3.4"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[fe80::1%25eth0]:80", "fe80::1"},
+		{"::ffff:1.2.3.4", "1.2.3.4"},
+		{"[::ffff:10.0.0.1]:8080", "10.0.0.1"},
+		{"2001:DB8:0:0:0:0:0:1", "2001:db8::1"},
+		{"1.2.3.4:port", ""},
+		{"[2001:db8::1", ""},
+		{"[2001:db8::1]x", ""},
+		{"unknown", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := NormalizeIP(tt.raw); got != tt.want {
+				t.Errorf("NormalizeIP(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIP_NormalizesCandidates(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-REAL-IP", `"[2606:4700::1]:443"`)
+	if ip := GetIP(r); ip != "2606:4700::1" {
+		t.Fatalf("expected 2606:4700::1, got %q", ip)
+	}
+
+	candidate := GetIPCandidate(r)
+	if candidate.Raw != `"[2606:4700::1]:443"` {
+		t.Fatalf("expected raw value to be preserved, got %q", candidate.Raw)
+	}
+	if candidate.Source != IPSourceRealIP {
+		t.Fatalf("expected source %q, got %q", IPSourceRealIP, candidate.Source)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-FORWARDED-FOR", "10.0.0.1:1234, 8.8.8.8:5678")
+	if ip := GetIP(r); ip != "8.8.8.8" {
+		t.Fatalf("expected 8.8.8.8, got %q", ip)
+	}
+}
+
+func TestGetIPWithOptions_NormalizesCandidates(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-FORWARDED-FOR", "198.51.100.50:1234, [::ffff:10.0.0.5]:80, 127.0.0.1")
+	candidate := GetIPCandidateWithOptions(r, IPOptions{
+		PreferForwardedFor: true,
+		TrustedProxies:     []string{"10.0.0.0/8", "127.0.0.1/32"},
+		Validate:           true,
+	})
+	if candidate.IP != "198.51.100.50" {
+		t.Fatalf("expected 198.51.100.50, got %q", candidate.IP)
+	}
+	if candidate.Raw != "198.51.100.50:1234" {
+		t.Fatalf("expected raw 198.51.100.50:1234, got %q", candidate.Raw)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("CF-Connecting-IP", "fe80::1%eth0")
+	ip := GetIPWithOptions(r, IPOptions{AdditionalHeaders: []string{"CF-Connecting-IP"}, Validate: true})
+	if ip != "fe80::1" {
+		t.Fatalf("expected fe80::1, got %q", ip)
+	}
+}
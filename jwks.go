@@ -0,0 +1,192 @@
+package req
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+)
+
+// JWK is a verification key of a JSON Web Key Set (RFC 7517).
+type JWK struct {
+	ID        string // "kid"
+	Algorithm string // "alg", empty if the key does not restrict it
+	Key       any    // []byte, *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+}
+
+// JWKS is a parsed JSON Web Key Set. It implements JWTKeyResolver.
+type JWKS struct {
+	Keys []JWK
+}
+
+// jwkJSON is the JSON form of a key.
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JSON Web Key Set.
+//
+// Business logic:
+// - supported key types: RSA, EC with crv P-256, OKP with crv Ed25519, and oct (HMAC secrets)
+// - keys with "use" other than "sig" are skipped
+// - keys of other types or curves are skipped, so a set can be shared with other software
+// - RSA keys smaller than 2048 bits are skipped with a warning logged to slog.Default()
+// - a supported key with invalid parameters is an error
+//
+// Returns:
+//   - *JWKS: the usable keys
+//   - error: if the set or one of its supported keys is malformed
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var raw struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("req: invalid JWKS: %w", err)
+	}
+
+	set := &JWKS{}
+	for i, k := range raw.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if errors.Is(err, errWeakRSAKey) {
+			slog.Default().Warn("req: skipping JWKS key", "index", i, "kid", k.Kid, "error", err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("req: invalid JWKS key %d (kid %q): %w", i, k.Kid, err)
+		}
+		if key != nil {
+			set.Keys = append(set.Keys, JWK{ID: k.Kid, Algorithm: k.Alg, Key: key})
+		}
+	}
+	return set, nil
+}
+
+// JWTKeys implements JWTKeyResolver. With a kid, only keys with that ID
+// are returned; without one, all keys usable with alg are.
+func (s *JWKS) JWTKeys(kid, alg string) ([]any, error) {
+	var keys []any
+	for _, k := range s.Keys {
+		if kid != "" && k.ID != kid {
+			continue
+		}
+		if k.Algorithm != "" && k.Algorithm != alg {
+			continue
+		}
+		if jwtKeyMatches(alg, k.Key) {
+			keys = append(keys, k.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: kid %q", ErrJWTKeyNotFound, kid)
+	}
+	return keys, nil
+}
+
+// errWeakRSAKey is returned by jwkJSON.publicKey for RSA keys that are too
+// small to be trusted.
+var errWeakRSAKey = errors.New("RSA key smaller than 2048 bits")
+
+// publicKey decodes a supported key, returning nil for unsupported ones.
+func (k jwkJSON) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errWeakRSAKey
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid P-256 point")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid oct key")
+		}
+		return secret, nil
+	}
+	return nil, nil
+}
+
+// decodeJWKInt decodes a base64url unsigned big-endian integer.
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWKSFile is a JWKS read from a local file. The file is reloaded when it
+// changes, so keys can be rotated by adding the new key, switching the
+// signer to its kid, and removing the old key once its tokens expired.
+type JWKSFile struct {
+	fileReloader[*JWKS]
+}
+
+// OpenJWKSFile reads a JWKS file. If reloadInterval is positive, the file
+// is checked for changes at that interval until Close is called.
+func OpenJWKSFile(path string, reloadInterval time.Duration) (*JWKSFile, error) {
+	f := &JWKSFile{}
+	if err := f.open(path, reloadInterval, ParseJWKS); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// JWTKeys implements JWTKeyResolver.
+func (f *JWKSFile) JWTKeys(kid, alg string) ([]any, error) {
+	return f.current().JWTKeys(kid, alg)
+}
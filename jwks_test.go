@@ -0,0 +1,182 @@
+package req
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJWK returns the JWK JSON form of a public key.
+func testJWK(kid string, key any) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k)}
+	case []byte:
+		return map[string]string{"kty": "oct", "kid": kid, "k": b64(k)}
+	}
+	return nil
+}
+
+func testJWKS(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey := rsaTestKey(t)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	encryption := testJWK("enc", &rsaKey.PublicKey)
+	encryption["use"] = "enc"
+	p384 := map[string]string{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AA", "y": "AA"}
+
+	set, err := ParseJWKS(testJWKS(t,
+		testJWK("rsa", &rsaKey.PublicKey),
+		testJWK("ec", &ecKey.PublicKey),
+		testJWK("ed", edPub),
+		testJWK("hmac", []byte("secret")),
+		encryption,
+		p384,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 4 {
+		t.Fatalf("len(Keys) = %d, want 4", len(set.Keys))
+	}
+
+	tests := []struct {
+		kid, alg string
+		wantErr  bool
+	}{
+		{"rsa", JWTAlgRS256, false},
+		{"rsa", JWTAlgPS256, false},
+		{"ec", JWTAlgES256, false},
+		{"ed", JWTAlgEdDSA, false},
+		{"hmac", JWTAlgHS256, false},
+		{"rsa", JWTAlgES256, true},
+		{"enc", JWTAlgRS256, true},
+		{"missing", JWTAlgRS256, true},
+	}
+	for _, tt := range tests {
+		keys, err := set.JWTKeys(tt.kid, tt.alg)
+		if tt.wantErr {
+			if !errors.Is(err, ErrJWTKeyNotFound) {
+				t.Errorf("JWTKeys(%q, %q) error = %v, want ErrJWTKeyNotFound", tt.kid, tt.alg, err)
+			}
+			continue
+		}
+		if err != nil || len(keys) != 1 {
+			t.Errorf("JWTKeys(%q, %q) = %v, %v", tt.kid, tt.alg, keys, err)
+		}
+	}
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	tests := [][]byte{
+		[]byte("not json"),
+		testJWKS(t, map[string]string{"kty": "RSA", "n": "AQAB", "e": "AQ"}),
+		testJWKS(t, map[string]string{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}),
+		testJWKS(t, map[string]string{"kty": "OKP", "crv": "Ed25519", "x": "AQ"}),
+		testJWKS(t, map[string]string{"kty": "oct", "k": ""}),
+	}
+	for i, data := range tests {
+		if _, err := ParseJWKS(data); err == nil {
+			t.Errorf("case %d: ParseJWKS() error = nil", i)
+		}
+	}
+}
+
+func TestParseJWKS_SkipsWeakRSAKey(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	rsaKey := rsaTestKey(t)
+	legacy := new(big.Int).Lsh(big.NewInt(1), 1023)
+	set, err := ParseJWKS(testJWKS(t,
+		map[string]string{"kty": "RSA", "kid": "legacy", "n": base64.RawURLEncoding.EncodeToString(legacy.Bytes()), "e": "AQAB"},
+		testJWK("current", &rsaKey.PublicKey),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].ID != "current" {
+		t.Fatalf("Keys = %+v, want only the 2048 bit key", set.Keys)
+	}
+	if !strings.Contains(logs.String(), "kid=legacy") {
+		t.Errorf("no warning logged for the weak key: %s", logs.String())
+	}
+}
+
+func TestJWKSFile_Rotation(t *testing.T) {
+	oldPub, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	newPub, newKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeFile(t, path, string(testJWKS(t, testJWK("2024", oldPub))))
+
+	jwks, err := OpenJWKSFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+	v := NewJWTVerifier(JWTVerifierOptions{Keys: jwks})
+
+	oldToken := signTestJWT(t, JWTAlgEdDSA, "2024", oldKey, map[string]any{})
+	newToken := signTestJWT(t, JWTAlgEdDSA, "2025", newKey, map[string]any{})
+	if _, err := v.Verify(oldToken); err != nil {
+		t.Errorf("Verify(old) error = %v", err)
+	}
+	if _, err := v.Verify(newToken); !errors.Is(err, ErrJWTKeyNotFound) {
+		t.Errorf("Verify(new) error = %v, want ErrJWTKeyNotFound", err)
+	}
+
+	// Publish the new key next to the old one
+	writeFile(t, path, string(testJWKS(t, testJWK("2024", oldPub), testJWK("2025", newPub))))
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := jwks.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(newToken); err != nil {
+		t.Errorf("Verify(new) after reload error = %v", err)
+	}
+	if _, err := v.Verify(oldToken); err != nil {
+		t.Errorf("Verify(old) after reload error = %v", err)
+	}
+
+	// An invalid file keeps the previous keys
+	writeFile(t, path, "{")
+	if err := jwks.Reload(); err == nil {
+		t.Error("Reload() error = nil for an invalid file")
+	}
+	if _, err := v.Verify(newToken); err != nil {
+		t.Errorf("Verify(new) after failed reload error = %v", err)
+	}
+}
@@ -0,0 +1,442 @@
+package req
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// JWT verification errors. Errors returned by JWTVerifier wrap
+// ErrInvalidJWT and, where it applies, one of the more specific errors.
+var (
+	ErrInvalidJWT            = errors.New("req: invalid JWT")
+	ErrJWTSignature          = errors.New("req: JWT signature is invalid")
+	ErrJWTAlgorithm          = errors.New("req: JWT algorithm not allowed")
+	ErrJWTKeyNotFound        = errors.New("req: JWT key not found")
+	ErrJWTExpired            = errors.New("req: JWT is expired")
+	ErrJWTNotYetValid        = errors.New("req: JWT is not valid yet")
+	ErrJWTInvalidAudience    = errors.New("req: JWT audience is invalid")
+	ErrJWTInvalidIssuer      = errors.New("req: JWT issuer is invalid")
+	ErrJWTMissingExpiration  = errors.New("req: JWT has no expiration")
+	ErrJWTUnsupportedCritHdr = errors.New("req: JWT has unsupported critical headers")
+)
+
+// Supported JWS algorithms (RFC 7518, RFC 8037).
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgHS384 = "HS384"
+	JWTAlgHS512 = "HS512"
+	JWTAlgRS256 = "RS256"
+	JWTAlgPS256 = "PS256"
+	JWTAlgES256 = "ES256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
+// DefaultJWTLeeway is the clock skew allowed when JWTVerifierOptions.Leeway is zero.
+const DefaultJWTLeeway = 30 * time.Second
+
+// JWTKeyResolver finds the keys that may have signed a token.
+// Implementations must be safe for concurrent use.
+type JWTKeyResolver interface {
+	// JWTKeys returns the candidate keys for the "kid" and "alg" token
+	// headers: []byte for HMAC, *rsa.PublicKey, *ecdsa.PublicKey or
+	// ed25519.PublicKey. kid may be empty.
+	JWTKeys(kid, alg string) ([]any, error)
+}
+
+// JWTKeyFunc adapts a function to a JWTKeyResolver.
+type JWTKeyFunc func(kid, alg string) ([]any, error)
+
+// JWTKeys implements JWTKeyResolver.
+func (f JWTKeyFunc) JWTKeys(kid, alg string) ([]any, error) {
+	return f(kid, alg)
+}
+
+// StaticJWTKeys returns a resolver offering the same keys for every token,
+// regardless of "kid".
+func StaticJWTKeys(keys ...any) JWTKeyResolver {
+	return JWTKeyFunc(func(string, string) ([]any, error) {
+		return keys, nil
+	})
+}
+
+// JWTVerifierOptions configures NewJWTVerifier.
+type JWTVerifierOptions struct {
+	// Keys resolves verification keys, e.g. a *JWKSFile or StaticJWTKeys.
+	Keys JWTKeyResolver
+	// Algorithms lists the accepted "alg" values; nil means all supported
+	// algorithms. The key type must always match the algorithm.
+	Algorithms []string
+	// Issuer, if set, must equal the "iss" claim.
+	Issuer string
+	// Audience, if set, must be contained in the "aud" claim.
+	Audience string
+	// Leeway is the allowed clock skew for exp, nbf and iat; zero means
+	// DefaultJWTLeeway, a negative value means none.
+	Leeway time.Duration
+	// RequireExpiration rejects tokens without an "exp" claim.
+	RequireExpiration bool
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+}
+
+// JWT is a verified token.
+type JWT struct {
+	Header map[string]any
+	Claims JWTClaims
+	Raw    string
+
+	payload []byte
+}
+
+// Bind decodes the claims into v with encoding/json, so a struct's json
+// tags select the claims.
+//
+// Example:
+//
+//	var claims struct {
+//	    Subject string   `json:"sub"`
+//	    Roles   []string `json:"roles"`
+//	}
+//	err := token.Bind(&claims)
+func (t *JWT) Bind(v any) error {
+	return json.Unmarshal(t.payload, v)
+}
+
+// JWTClaims are the claims of a token. Numbers are json.Number values.
+type JWTClaims map[string]any
+
+// String returns a claim converted to a string, or "" if it is missing.
+func (c JWTClaims) String(name string) string {
+	return cast.ToString(c[name])
+}
+
+// Int64 returns a claim converted to an int64, or 0 if it is missing or
+// not a number.
+func (c JWTClaims) Int64(name string) int64 {
+	return cast.ToInt64(c[name])
+}
+
+// Float64 returns a claim converted to a float64, or 0.
+func (c JWTClaims) Float64(name string) float64 {
+	return cast.ToFloat64(c[name])
+}
+
+// Bool returns a claim converted to a bool, or false.
+func (c JWTClaims) Bool(name string) bool {
+	return cast.ToBool(c[name])
+}
+
+// Strings returns a claim holding a string or an array of strings.
+func (c JWTClaims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		return cast.ToStringSlice(v)
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim such as "exp", or the zero time.
+func (c JWTClaims) Time(name string) time.Time {
+	t, _ := c.numericDate(name)
+	return t
+}
+
+// Subject returns the "sub" claim.
+func (c JWTClaims) Subject() string {
+	return c.String("sub")
+}
+
+// Audience returns the "aud" claim.
+func (c JWTClaims) Audience() []string {
+	return c.Strings("aud")
+}
+
+// numericDate parses a NumericDate claim, reporting whether it is present
+// and valid.
+func (c JWTClaims) numericDate(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec, frac := int64(f), f-float64(int64(f))
+	return time.Unix(sec, int64(frac*1e9)), true
+}
+
+// JWTVerifier verifies JWS compact serialized JWTs.
+type JWTVerifier struct {
+	opts JWTVerifierOptions
+}
+
+// NewJWTVerifier creates a JWT verifier.
+//
+// Example:
+//
+//	jwks, err := req.OpenJWKSFile("/etc/app/jwks.json", time.Minute)
+//	verifier := req.NewJWTVerifier(req.JWTVerifierOptions{
+//	    Keys:     jwks,
+//	    Issuer:   "https://auth.example.com",
+//	    Audience: "api",
+//	})
+//	token, err := verifier.VerifyRequest(r, req.TokenOptions{})
+func NewJWTVerifier(opts JWTVerifierOptions) *JWTVerifier {
+	if opts.Leeway == 0 {
+		opts.Leeway = DefaultJWTLeeway
+	}
+	if opts.Leeway < 0 {
+		opts.Leeway = 0
+	}
+	return &JWTVerifier{opts: opts}
+}
+
+// VerifyRequest extracts a token with GetToken and verifies it.
+func (v *JWTVerifier) VerifyRequest(r *http.Request, opts TokenOptions) (*JWT, error) {
+	token, err := GetToken(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return v.Verify(token)
+}
+
+// Verify checks the signature and claims of a token.
+//
+// Business logic:
+// - the token must have three base64url parts and a JSON header and payload
+// - "alg" must be allowed, "crit" headers are not supported
+// - one of the resolved keys must match the algorithm and verify the signature
+// - exp, nbf and iat are checked with the configured leeway
+// - iss and aud are checked when configured
+//
+// Returns:
+//   - *JWT: the verified token
+//   - error: wrapping ErrInvalidJWT and a more specific error if available
+func (v *JWTVerifier) Verify(token string) (*JWT, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, jwtError(nil, "token must have three parts")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, jwtError(nil, "malformed header encoding")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, jwtError(nil, "malformed payload encoding")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, jwtError(nil, "malformed signature encoding")
+	}
+
+	var header map[string]any
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, jwtError(nil, "malformed header")
+	}
+	claims := JWTClaims{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, jwtError(nil, "malformed payload")
+	}
+
+	alg, _ := header["alg"].(string)
+	if !v.algorithmAllowed(alg) {
+		return nil, jwtError(ErrJWTAlgorithm, alg)
+	}
+	if _, ok := header["crit"]; ok {
+		return nil, jwtError(ErrJWTUnsupportedCritHdr, "")
+	}
+
+	kid, _ := header["kid"].(string)
+	if v.opts.Keys == nil {
+		return nil, jwtError(ErrJWTKeyNotFound, "no key resolver")
+	}
+	keys, err := v.opts.Keys.JWTKeys(kid, alg)
+	if err != nil {
+		return nil, jwtError(err, "")
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified, matched := false, false
+	for _, key := range keys {
+		if !jwtKeyMatches(alg, key) {
+			continue
+		}
+		matched = true
+		if verifyJWS(alg, key, signingInput, signature) {
+			verified = true
+			break
+		}
+	}
+	switch {
+	case !matched:
+		return nil, jwtError(ErrJWTKeyNotFound, fmt.Sprintf("no %s key for kid %q", alg, kid))
+	case !verified:
+		return nil, jwtError(ErrJWTSignature, "")
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return &JWT{Header: header, Claims: claims, Raw: token, payload: payload}, nil
+}
+
+// validateClaims checks the registered claims.
+func (v *JWTVerifier) validateClaims(claims JWTClaims) error {
+	now := time.Now()
+	if v.opts.Now != nil {
+		now = v.opts.Now()
+	}
+	leeway := v.opts.Leeway
+
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		if _, present := claims[name]; !present {
+			continue
+		}
+		if _, ok := claims.numericDate(name); !ok {
+			return jwtError(nil, name+" is not a NumericDate")
+		}
+	}
+
+	if exp, ok := claims.numericDate("exp"); ok {
+		if !now.Before(exp.Add(leeway)) {
+			return jwtError(ErrJWTExpired, "")
+		}
+	} else if v.opts.RequireExpiration {
+		return jwtError(ErrJWTMissingExpiration, "")
+	}
+	if nbf, ok := claims.numericDate("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return jwtError(ErrJWTNotYetValid, "")
+	}
+	if iat, ok := claims.numericDate("iat"); ok && now.Add(leeway).Before(iat) {
+		return jwtError(ErrJWTNotYetValid, "issued in the future")
+	}
+
+	if v.opts.Issuer != "" && claims.String("iss") != v.opts.Issuer {
+		return jwtError(ErrJWTInvalidIssuer, "")
+	}
+	if v.opts.Audience != "" && !slices.Contains(claims.Audience(), v.opts.Audience) {
+		return jwtError(ErrJWTInvalidAudience, "")
+	}
+	return nil
+}
+
+// algorithmAllowed reports whether alg is supported and allowed.
+func (v *JWTVerifier) algorithmAllowed(alg string) bool {
+	if _, ok := jwtHashes[alg]; !ok && alg != JWTAlgEdDSA {
+		return false
+	}
+	return v.opts.Algorithms == nil || slices.Contains(v.opts.Algorithms, alg)
+}
+
+// jwtError wraps ErrInvalidJWT and an optional specific error.
+func jwtError(specific error, detail string) error {
+	switch {
+	case specific != nil && detail != "":
+		return fmt.Errorf("%w: %w: %s", ErrInvalidJWT, specific, detail)
+	case specific != nil:
+		return fmt.Errorf("%w: %w", ErrInvalidJWT, specific)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidJWT, detail)
+	}
+}
+
+// jwtHashes maps algorithms to their hash functions.
+var jwtHashes = map[string]crypto.Hash{
+	JWTAlgHS256: crypto.SHA256,
+	JWTAlgHS384: crypto.SHA384,
+	JWTAlgHS512: crypto.SHA512,
+	JWTAlgRS256: crypto.SHA256,
+	JWTAlgPS256: crypto.SHA256,
+	JWTAlgES256: crypto.SHA256,
+}
+
+// jwtKeyMatches reports whether key has the type required by alg.
+func jwtKeyMatches(alg string, key any) bool {
+	switch alg {
+	case JWTAlgHS256, JWTAlgHS384, JWTAlgHS512:
+		k, ok := key.([]byte)
+		return ok && len(k) > 0
+	case JWTAlgRS256, JWTAlgPS256:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case JWTAlgES256:
+		k, ok := key.(*ecdsa.PublicKey)
+		return ok && k.Curve == elliptic.P256()
+	case JWTAlgEdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		return ok && len(k) == ed25519.PublicKeySize
+	}
+	return false
+}
+
+// verifyJWS checks a signature with a key of the matching type.
+func verifyJWS(alg string, key any, input, signature []byte) bool {
+	if alg == JWTAlgEdDSA {
+		return ed25519.Verify(key.(ed25519.PublicKey), input, signature)
+	}
+
+	h := jwtHashes[alg]
+	switch alg {
+	case JWTAlgHS256, JWTAlgHS384, JWTAlgHS512:
+		mac := hmac.New(hashFunc(h), key.([]byte))
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+
+	hasher := h.New()
+	hasher.Write(input)
+	digest := hasher.Sum(nil)
+
+	switch alg {
+	case JWTAlgRS256:
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), h, digest, signature) == nil
+	case JWTAlgPS256:
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+		return rsa.VerifyPSS(key.(*rsa.PublicKey), h, digest, signature, opts) == nil
+	case JWTAlgES256:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key.(*ecdsa.PublicKey), digest, r, s)
+	}
+	return false
+}
+
+// hashFunc returns the constructor of a hash for use with hmac.New.
+func hashFunc(h crypto.Hash) func() hash.Hash {
+	switch h {
+	case crypto.SHA384:
+		return sha512.New384
+	case crypto.SHA512:
+		return sha512.New
+	}
+	return sha256.New
+}
@@ -0,0 +1,262 @@
+package req
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKey     *rsa.PrivateKey
+)
+
+// rsaTestKey returns a shared RSA key, as generating one is slow.
+func rsaTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testRSAKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRSAKey = key
+	})
+	return testRSAKey
+}
+
+// signTestJWT creates a token signed with key for alg.
+func signTestJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	var sig []byte
+	var err error
+	switch alg {
+	case JWTAlgHS256, JWTAlgHS384, JWTAlgHS512:
+		mac := hmac.New(hashFunc(jwtHashes[alg]), key.([]byte))
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case JWTAlgRS256:
+		digest := sha256Sum(input)
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest)
+	case JWTAlgPS256:
+		digest := sha256Sum(input)
+		sig, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case JWTAlgES256:
+		r, s, signErr := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), sha256Sum(input))
+		err = signErr
+		sig = make([]byte, 64)
+		if err == nil {
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+	case JWTAlgEdDSA:
+		sig = ed25519.Sign(key.(ed25519.PrivateKey), []byte(input))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func sha256Sum(s string) []byte {
+	h := crypto.SHA256.New()
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func TestJWTVerifier_Algorithms(t *testing.T) {
+	rsaKey := rsaTestKey(t)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		alg     string
+		signKey any
+		keys    []any
+	}{
+		{JWTAlgHS256, secret, []any{secret}},
+		{JWTAlgHS384, secret, []any{secret}},
+		{JWTAlgHS512, secret, []any{secret}},
+		{JWTAlgRS256, rsaKey, []any{&rsaKey.PublicKey}},
+		{JWTAlgPS256, rsaKey, []any{&rsaKey.PublicKey}},
+		{JWTAlgES256, ecKey, []any{&ecKey.PublicKey}},
+		{JWTAlgEdDSA, edKey, []any{edPub}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			v := NewJWTVerifier(JWTVerifierOptions{Keys: StaticJWTKeys(tt.keys...)})
+			token := signTestJWT(t, tt.alg, "", tt.signKey, map[string]any{"sub": "42"})
+
+			got, err := v.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.Claims.Subject() != "42" {
+				t.Errorf("Subject() = %q, want 42", got.Claims.Subject())
+			}
+
+			tampered := token[:len(token)-4] + "AAAA"
+			if _, err := v.Verify(tampered); !errors.Is(err, ErrJWTSignature) {
+				t.Errorf("Verify(tampered) error = %v, want ErrJWTSignature", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey := rsaTestKey(t)
+	v := NewJWTVerifier(JWTVerifierOptions{Keys: StaticJWTKeys(&rsaKey.PublicKey)})
+
+	// An HS256 token signed with the public key bytes must not verify
+	token := signTestJWT(t, JWTAlgHS256, "", rsaKey.PublicKey.N.Bytes(), map[string]any{})
+	if _, err := v.Verify(token); !errors.Is(err, ErrJWTKeyNotFound) {
+		t.Errorf("Verify() error = %v, want ErrJWTKeyNotFound", err)
+	}
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + "."
+	if _, err := v.Verify(none); !errors.Is(err, ErrJWTAlgorithm) {
+		t.Errorf("Verify(none) error = %v, want ErrJWTAlgorithm", err)
+	}
+
+	restricted := NewJWTVerifier(JWTVerifierOptions{Keys: StaticJWTKeys(&rsaKey.PublicKey), Algorithms: []string{JWTAlgPS256}})
+	token = signTestJWT(t, JWTAlgRS256, "", rsaKey, map[string]any{})
+	if _, err := restricted.Verify(token); !errors.Is(err, ErrJWTAlgorithm) {
+		t.Errorf("Verify(RS256) error = %v, want ErrJWTAlgorithm", err)
+	}
+}
+
+func TestJWTVerifier_Claims(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1_700_000_000, 0)
+	base := JWTVerifierOptions{
+		Keys:     StaticJWTKeys(secret),
+		Issuer:   "https://auth.example.com",
+		Audience: "api",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	}
+	unix := func(d time.Duration) int64 { return now.Add(d).Unix() }
+
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		require bool
+		want    error
+	}{
+		{"valid", map[string]any{"iss": "https://auth.example.com", "aud": "api", "exp": unix(time.Hour)}, false, nil},
+		{"audience array", map[string]any{"iss": "https://auth.example.com", "aud": []string{"web", "api"}}, false, nil},
+		{"expired within leeway", map[string]any{"iss": "https://auth.example.com", "aud": "api", "exp": unix(-30 * time.Second)}, false, nil},
+		{"expired", map[string]any{"iss": "https://auth.example.com", "aud": "api", "exp": unix(-2 * time.Minute)}, false, ErrJWTExpired},
+		{"not yet valid", map[string]any{"iss": "https://auth.example.com", "aud": "api", "nbf": unix(2 * time.Minute)}, false, ErrJWTNotYetValid},
+		{"nbf within leeway", map[string]any{"iss": "https://auth.example.com", "aud": "api", "nbf": unix(30 * time.Second)}, false, nil},
+		{"issued in future", map[string]any{"iss": "https://auth.example.com", "aud": "api", "iat": unix(time.Hour)}, false, ErrJWTNotYetValid},
+		{"wrong issuer", map[string]any{"iss": "https://evil.example.com", "aud": "api"}, false, ErrJWTInvalidIssuer},
+		{"wrong audience", map[string]any{"iss": "https://auth.example.com", "aud": "web"}, false, ErrJWTInvalidAudience},
+		{"missing exp", map[string]any{"iss": "https://auth.example.com", "aud": "api"}, true, ErrJWTMissingExpiration},
+		{"exp not a number", map[string]any{"iss": "https://auth.example.com", "aud": "api", "exp": "tomorrow"}, false, ErrInvalidJWT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base
+			opts.RequireExpiration = tt.require
+			token := signTestJWT(t, JWTAlgHS256, "", secret, tt.claims)
+			_, err := NewJWTVerifier(opts).Verify(token)
+			if tt.want == nil && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.want)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidJWT) {
+				t.Errorf("Verify() error = %v, want it to wrap ErrInvalidJWT", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_Malformed(t *testing.T) {
+	v := NewJWTVerifier(JWTVerifierOptions{Keys: StaticJWTKeys([]byte("secret"))})
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!!.e30.", "e30.!!.", "bm90IGpzb24.e30."} {
+		if _, err := v.Verify(token); !errors.Is(err, ErrInvalidJWT) {
+			t.Errorf("Verify(%q) error = %v, want ErrInvalidJWT", token, err)
+		}
+	}
+}
+
+func TestJWT_BindAndClaims(t *testing.T) {
+	secret := []byte("secret")
+	token := signTestJWT(t, JWTAlgHS256, "", secret, map[string]any{
+		"sub":   "42",
+		"roles": []string{"admin", "editor"},
+		"org":   7,
+		"exp":   int64(4_000_000_000),
+		"beta":  true,
+	})
+	got, err := NewJWTVerifier(JWTVerifierOptions{Keys: StaticJWTKeys(secret)}).Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims struct {
+		Subject string   `json:"sub"`
+		Roles   []string `json:"roles"`
+		Org     int      `json:"org"`
+	}
+	if err := got.Bind(&claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || len(claims.Roles) != 2 || claims.Org != 7 {
+		t.Errorf("Bind() = %+v", claims)
+	}
+
+	if got.Claims.Int64("org") != 7 {
+		t.Errorf("Int64(org) = %d, want 7", got.Claims.Int64("org"))
+	}
+	if !got.Claims.Bool("beta") {
+		t.Error("Bool(beta) = false, want true")
+	}
+	if roles := got.Claims.Strings("roles"); len(roles) != 2 || roles[1] != "editor" {
+		t.Errorf("Strings(roles) = %v", roles)
+	}
+	if exp := got.Claims.Time("exp"); exp.Unix() != 4_000_000_000 {
+		t.Errorf("Time(exp) = %v", exp)
+	}
+}
+
+func TestJWTVerifier_VerifyRequest(t *testing.T) {
+	secret := []byte("secret")
+	v := NewJWTVerifier(JWTVerifierOptions{Keys: StaticJWTKeys(secret)})
+	token := signTestJWT(t, JWTAlgHS256, "", secret, map[string]any{"sub": "1"})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, err := v.VerifyRequest(r, TokenOptions{}); err != nil {
+		t.Errorf("VerifyRequest() error = %v", err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	if _, err := v.VerifyRequest(r, TokenOptions{}); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("VerifyRequest() error = %v, want ErrNoCredentials", err)
+	}
+}
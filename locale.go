@@ -0,0 +1,216 @@
+package req
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// Locale sources reported by LocaleWithSource.
+const (
+	LocaleSourceParam          = "param"
+	LocaleSourceCookie         = "cookie"
+	LocaleSourceSubdomain      = "subdomain"
+	LocaleSourcePathPrefix     = "path"
+	LocaleSourceAcceptLanguage = "Accept-Language"
+	LocaleSourceDefault        = "default"
+)
+
+// LocaleOptions configures Locale and Timezone.
+type LocaleOptions struct {
+	// Supported lists the supported BCP 47 locales, e.g. "en", "pt-BR".
+	// The first one is the default.
+	Supported []string
+	// Param is the GET or POST parameter holding an explicit locale;
+	// empty means "lang", "-" disables it.
+	Param string
+	// Cookie is the cookie holding the locale; empty means "lang", "-"
+	// disables it.
+	Cookie string
+	// FromSubdomain reads the locale from the subdomain ("pt-br.example.com").
+	FromSubdomain bool
+	// FromPathPrefix reads the locale from the first path segment ("/pt-BR/about").
+	FromPathPrefix bool
+	// HostOptions controls how the subdomain is resolved.
+	HostOptions HostOptions
+
+	// TimezoneParam is the GET or POST parameter holding an IANA time zone
+	// name; empty means "tz", "-" disables it.
+	TimezoneParam string
+	// TimezoneCookie is the cookie holding the time zone; empty means "tz",
+	// "-" disables it.
+	TimezoneCookie string
+	// TimezoneHeader is the request header holding the time zone; empty
+	// means "Time-Zone", "-" disables it.
+	TimezoneHeader string
+	// DefaultTimezone is returned when no valid time zone is found; nil
+	// means time.UTC.
+	DefaultTimezone *time.Location
+}
+
+// Locale returns the locale of the request, matched against opts.Supported.
+//
+// Business logic:
+// - candidates are tried in order: lang parameter (via GetString), lang cookie, subdomain, path prefix, Accept-Language
+// - each candidate is parsed and canonicalized as a BCP 47 tag ("pt_br" becomes "pt-BR")
+// - a candidate matches a supported locale exactly or by fallback ("pt-BR" → "pt")
+// - if nothing matches, the first supported locale is returned
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - opts (LocaleOptions): The supported locales and sources
+//
+// Returns:
+//   - string: the supported locale, as written in opts.Supported
+func Locale(r *http.Request, opts LocaleOptions) string {
+	locale, _ := LocaleWithSource(r, opts)
+	return locale
+}
+
+// LocaleWithSource is like Locale, also returning where the locale came
+// from, one of the LocaleSource constants.
+func LocaleWithSource(r *http.Request, opts LocaleOptions) (string, string) {
+	if len(opts.Supported) == 0 {
+		return "", LocaleSourceDefault
+	}
+	if r == nil {
+		return opts.Supported[0], LocaleSourceDefault
+	}
+
+	candidates := []struct {
+		source string
+		value  func() string
+	}{
+		{LocaleSourceParam, func() string { return requestParam(r, optionName(opts.Param, "lang")) }},
+		{LocaleSourceCookie, func() string { return requestCookie(r, optionName(opts.Cookie, "lang")) }},
+		{LocaleSourceSubdomain, func() string {
+			if !opts.FromSubdomain {
+				return ""
+			}
+			return GetSubdomainWithOptions(r, opts.HostOptions)
+		}},
+		{LocaleSourcePathPrefix, func() string {
+			if !opts.FromPathPrefix || r.URL == nil {
+				return ""
+			}
+			segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+			return segment
+		}},
+	}
+
+	for _, candidate := range candidates {
+		if locale := matchLocale(candidate.value(), opts.Supported); locale != "" {
+			return locale, candidate.source
+		}
+	}
+
+	if locale, ok := negotiateLanguage(r, opts.Supported); ok {
+		return locale, LocaleSourceAcceptLanguage
+	}
+	return opts.Supported[0], LocaleSourceDefault
+}
+
+// Timezone returns the time zone of the request.
+//
+// Business logic:
+// - candidates are tried in order: the tz parameter (via GetString), the tz cookie, then the Time-Zone header
+// - a candidate must be an IANA time zone name such as "Europe/Berlin" or "UTC"
+// - if none is valid, opts.DefaultTimezone (or UTC) is returned
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - opts (LocaleOptions): The time zone sources
+//
+// Returns:
+//   - *time.Location: the time zone, never nil
+func Timezone(r *http.Request, opts LocaleOptions) *time.Location {
+	fallback := opts.DefaultTimezone
+	if fallback == nil {
+		fallback = time.UTC
+	}
+	if r == nil {
+		return fallback
+	}
+
+	candidates := []string{
+		requestParam(r, optionName(opts.TimezoneParam, "tz")),
+		requestCookie(r, optionName(opts.TimezoneCookie, "tz")),
+	}
+	if header := optionName(opts.TimezoneHeader, "Time-Zone"); header != "" {
+		candidates = append(candidates, r.Header.Get(header))
+	}
+
+	for _, name := range candidates {
+		if loc := loadTimezone(name); loc != nil {
+			return loc
+		}
+	}
+	return fallback
+}
+
+// matchLocale canonicalizes a BCP 47 candidate and looks it up in supported.
+func matchLocale(candidate string, supported []string) string {
+	candidate = strings.TrimSpace(candidate)
+	if candidate == "" || len(candidate) > 35 {
+		return ""
+	}
+	tag, err := language.Parse(strings.ReplaceAll(candidate, "_", "-"))
+	if err != nil {
+		return ""
+	}
+	return lookupLanguage(strings.ToLower(tag.String()), supported, func(string) bool { return true })
+}
+
+// timezoneCache holds loaded time zones by name.
+var timezoneCache sync.Map
+
+// loadTimezone loads an IANA time zone, rejecting "Local" and empty names.
+func loadTimezone(name string) *time.Location {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "Local" || len(name) > 64 {
+		return nil
+	}
+	if loc, ok := timezoneCache.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	timezoneCache.Store(name, loc)
+	return loc
+}
+
+// optionName returns name, def if name is empty, or "" if name is "-".
+func optionName(name, def string) string {
+	switch name {
+	case "":
+		return def
+	case "-":
+		return ""
+	}
+	return name
+}
+
+// requestParam returns a GET or POST parameter, or "" if key is empty.
+func requestParam(r *http.Request, key string) string {
+	if key == "" || r.URL == nil {
+		return ""
+	}
+	return GetString(r, key)
+}
+
+// requestCookie returns a cookie value, or "" if name is empty or missing.
+func requestCookie(r *http.Request, name string) string {
+	if name == "" {
+		return ""
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
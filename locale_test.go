@@ -0,0 +1,138 @@
+package req
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLocaleWithSource(t *testing.T) {
+	supported := []string{"en", "pt-BR", "de", "zh-Hant"}
+
+	tests := []struct {
+		name     string
+		target   string
+		host     string
+		cookie   string
+		accept   string
+		opts     LocaleOptions
+		expected string
+		source   string
+	}{
+		{name: "default", target: "/", expected: "en", source: LocaleSourceDefault},
+		{name: "param", target: "/?lang=de", accept: "pt-BR", expected: "de", source: LocaleSourceParam},
+		{name: "param canonicalized", target: "/?lang=pt_br", expected: "pt-BR", source: LocaleSourceParam},
+		{name: "param fallback", target: "/?lang=de-AT", expected: "de", source: LocaleSourceParam},
+		{name: "unsupported param falls through", target: "/?lang=fr", cookie: "de", expected: "de", source: LocaleSourceCookie},
+		{name: "invalid param ignored", target: "/?lang=../../etc", expected: "en", source: LocaleSourceDefault},
+		{name: "cookie", target: "/", cookie: "pt-BR", accept: "de", expected: "pt-BR", source: LocaleSourceCookie},
+		{
+			name:     "subdomain",
+			target:   "/",
+			host:     "de.example.com",
+			opts:     LocaleOptions{FromSubdomain: true},
+			expected: "de",
+			source:   LocaleSourceSubdomain,
+		},
+		{name: "subdomain disabled", target: "/", host: "de.example.com", expected: "en", source: LocaleSourceDefault},
+		{
+			name:     "non-locale subdomain",
+			target:   "/",
+			host:     "www.example.com",
+			accept:   "de",
+			opts:     LocaleOptions{FromSubdomain: true},
+			expected: "de",
+			source:   LocaleSourceAcceptLanguage,
+		},
+		{
+			name:     "path prefix",
+			target:   "/pt-BR/about",
+			opts:     LocaleOptions{FromPathPrefix: true},
+			expected: "pt-BR",
+			source:   LocaleSourcePathPrefix,
+		},
+		{name: "accept-language", target: "/", accept: "fr, zh-Hant-TW;q=0.8", expected: "zh-Hant", source: LocaleSourceAcceptLanguage},
+		{
+			name:     "custom param and disabled cookie",
+			target:   "/?locale=de",
+			cookie:   "pt-BR",
+			opts:     LocaleOptions{Param: "locale", Cookie: "-"},
+			expected: "de",
+			source:   LocaleSourceParam,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "lang", Value: tt.cookie})
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept-Language", tt.accept)
+			}
+
+			opts := tt.opts
+			opts.Supported = supported
+			locale, source := LocaleWithSource(r, opts)
+			if locale != tt.expected || source != tt.source {
+				t.Errorf("LocaleWithSource() = %q, %q, want %q, %q", locale, source, tt.expected, tt.source)
+			}
+		})
+	}
+}
+
+func TestLocale_NoSupported(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?lang=de", nil)
+	if got := Locale(r, LocaleOptions{}); got != "" {
+		t.Errorf("Locale() = %q, want \"\"", got)
+	}
+	if got := Locale(nil, LocaleOptions{Supported: []string{"en"}}); got != "en" {
+		t.Errorf("Locale(nil) = %q, want en", got)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		cookie   string
+		header   string
+		opts     LocaleOptions
+		expected string
+	}{
+		{name: "default", target: "/", expected: "UTC"},
+		{name: "custom default", target: "/", opts: LocaleOptions{DefaultTimezone: berlin}, expected: "Europe/Berlin"},
+		{name: "param", target: "/?tz=America/New_York", cookie: "Europe/Berlin", expected: "America/New_York"},
+		{name: "cookie", target: "/", cookie: "Europe/Berlin", header: "Asia/Tokyo", expected: "Europe/Berlin"},
+		{name: "header", target: "/", header: "Asia/Tokyo", expected: "Asia/Tokyo"},
+		{name: "invalid falls through", target: "/?tz=Mars/Olympus", header: "Asia/Tokyo", expected: "Asia/Tokyo"},
+		{name: "path traversal rejected", target: "/?tz=../../etc/passwd", expected: "UTC"},
+		{name: "local rejected", target: "/?tz=Local", expected: "UTC"},
+		{name: "header disabled", target: "/", header: "Asia/Tokyo", opts: LocaleOptions{TimezoneHeader: "-"}, expected: "UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "tz", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set("Time-Zone", tt.header)
+			}
+			if got := Timezone(r, tt.opts); got.String() != tt.expected {
+				t.Errorf("Timezone() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
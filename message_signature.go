@@ -0,0 +1,653 @@
+package req
+
+import (
+	"container/heap"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP message signature errors.
+var (
+	ErrMessageSignatureMissing     = errors.New("req: message signature missing")
+	ErrMessageSignatureMalformed   = errors.New("req: message signature malformed")
+	ErrMessageSignatureInvalid     = errors.New("req: message signature invalid")
+	ErrMessageSignatureExpired     = errors.New("req: message signature expired")
+	ErrMessageSignatureReplayed    = errors.New("req: message signature nonce reused")
+	ErrMessageSignatureKeyNotFound = errors.New("req: message signature key not found")
+)
+
+// HTTP message signature algorithms (RFC 9421 section 3.3).
+const (
+	SignatureAlgHMACSHA256   = "hmac-sha256"
+	SignatureAlgRSAPSSSHA512 = "rsa-pss-sha512"
+	SignatureAlgRSAV15SHA256 = "rsa-v1_5-sha256"
+	SignatureAlgECDSAP256    = "ecdsa-p256-sha256"
+	SignatureAlgECDSAP384    = "ecdsa-p384-sha384"
+	SignatureAlgEd25519      = "ed25519"
+)
+
+// DefaultSignatureLeeway is the clock skew allowed when
+// MessageSignatureOptions.Leeway is zero.
+const DefaultSignatureLeeway = 30 * time.Second
+
+// SignatureKey is a verification key.
+type SignatureKey struct {
+	// Key is []byte for HMAC, *rsa.PublicKey, *ecdsa.PublicKey or
+	// ed25519.PublicKey.
+	Key any
+	// Algorithm binds the key to one algorithm. It is required when
+	// signatures omit the "alg" parameter.
+	Algorithm string
+}
+
+// SignatureKeyResolver finds verification keys by the "keyid" signature
+// parameter. Implementations must be safe for concurrent use.
+type SignatureKeyResolver interface {
+	// ResolveSignatureKey returns the key, or an error wrapping
+	// ErrMessageSignatureKeyNotFound.
+	ResolveSignatureKey(ctx context.Context, keyID string) (SignatureKey, error)
+}
+
+// SignatureKeyMap is a SignatureKeyResolver backed by a map.
+type SignatureKeyMap map[string]SignatureKey
+
+// ResolveSignatureKey implements SignatureKeyResolver.
+func (m SignatureKeyMap) ResolveSignatureKey(_ context.Context, keyID string) (SignatureKey, error) {
+	key, ok := m[keyID]
+	if !ok {
+		return SignatureKey{}, fmt.Errorf("%w: %q", ErrMessageSignatureKeyNotFound, keyID)
+	}
+	return key, nil
+}
+
+// NonceStore records signature nonces to reject replays. Implementations
+// must be safe for concurrent use.
+type NonceStore interface {
+	// UseNonce records a nonce of a key until expires and reports whether
+	// it was unused.
+	UseNonce(ctx context.Context, keyID, nonce string, expires time.Time) bool
+}
+
+// MemoryNonceStore is an in-memory NonceStore for single instances.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	expiry nonceHeap // nonces by expiry, for sweeping
+	now    func() time.Time
+}
+
+// NewMemoryNonceStore creates an empty in-memory nonce store.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}, now: time.Now}
+}
+
+// UseNonce implements NonceStore. Expired nonces are dropped as new ones
+// are recorded, in logarithmic time per nonce.
+func (s *MemoryNonceStore) UseNonce(_ context.Context, keyID, nonce string, expires time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for len(s.expiry) > 0 && !now.Before(s.expiry[0].expires) {
+		e := heap.Pop(&s.expiry).(nonceExpiry)
+		// A nonce recorded again after expiring has a newer entry with a
+		// later expiry, which this older entry must not remove
+		if s.nonces[e.key].Equal(e.expires) {
+			delete(s.nonces, e.key)
+		}
+	}
+
+	key := keyID + "\x00" + nonce
+	if until, ok := s.nonces[key]; ok && now.Before(until) {
+		return false
+	}
+	s.nonces[key] = expires
+	heap.Push(&s.expiry, nonceExpiry{key: key, expires: expires})
+	return true
+}
+
+// nonceExpiry is a recorded nonce and its expiry.
+type nonceExpiry struct {
+	key     string
+	expires time.Time
+}
+
+// nonceHeap is a min-heap of nonces by expiry, see container/heap.
+type nonceHeap []nonceExpiry
+
+func (h nonceHeap) Len() int           { return len(h) }
+func (h nonceHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h nonceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x any)        { *h = append(*h, x.(nonceExpiry)) }
+
+func (h *nonceHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// MessageSignatureOptions configures NewMessageSignatureVerifier.
+type MessageSignatureOptions struct {
+	// Keys resolves the "keyid" parameter.
+	Keys SignatureKeyResolver
+	// Label selects the signature to verify; empty means the first one
+	// in Signature-Input.
+	Label string
+	// RequiredComponents must all be covered by the signature, e.g.
+	// "@method", "@path", "@authority", "content-digest". Components with
+	// parameters are given as serialized component identifiers, e.g.
+	// `"@query-param";name="id"`.
+	RequiredComponents []string
+	// MaxAge rejects signatures whose "created" is older; zero disables
+	// the check. It also bounds how long nonces are remembered.
+	MaxAge time.Duration
+	// RequireCreated rejects signatures without "created".
+	RequireCreated bool
+	// Nonces, if set, rejects reused "nonce" values; RequireNonce rejects
+	// signatures without one. A nonce is remembered until its signature
+	// expires, so signatures with a nonce but neither "expires" nor
+	// "created" bounded by MaxAge are rejected, as they would stay valid
+	// after the nonce is forgotten.
+	Nonces       NonceStore
+	RequireNonce bool
+	// Leeway is the allowed clock skew; zero means DefaultSignatureLeeway.
+	Leeway time.Duration
+	// HostOptions controls how @authority, @scheme and @target-uri are
+	// derived behind proxies.
+	HostOptions HostOptions
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+	// Logger receives rejections; nil means slog.Default().
+	Logger *slog.Logger
+	// DeniedHandler responds to rejected requests; nil means 401 Unauthorized.
+	DeniedHandler http.Handler
+}
+
+// MessageSignature describes a verified signature.
+type MessageSignature struct {
+	Label      string
+	KeyID      string
+	Algorithm  string
+	Components []string // covered component identifiers, e.g. `"@query-param";name="id"`
+	Created    time.Time
+	Expires    time.Time
+	Nonce      string
+	Tag        string
+}
+
+// MessageSignatureVerifier verifies RFC 9421 HTTP message signatures.
+type MessageSignatureVerifier struct {
+	opts MessageSignatureOptions
+}
+
+// NewMessageSignatureVerifier creates a message signature verifier.
+//
+// Example:
+//
+//	verifier := req.NewMessageSignatureVerifier(req.MessageSignatureOptions{
+//	    Keys:               req.SignatureKeyMap{"partner-1": {Key: partnerKey, Algorithm: req.SignatureAlgEd25519}},
+//	    RequiredComponents: []string{"@method", "@path", "@authority", "content-digest"},
+//	    MaxAge:             5 * time.Minute,
+//	    Nonces:             req.NewMemoryNonceStore(),
+//	})
+//	http.ListenAndServe(":8080", verifier.Middleware(handler))
+func NewMessageSignatureVerifier(opts MessageSignatureOptions) *MessageSignatureVerifier {
+	if opts.Leeway == 0 {
+		opts.Leeway = DefaultSignatureLeeway
+	}
+	return &MessageSignatureVerifier{opts: opts}
+}
+
+// MessageSignatureMiddleware returns middleware that rejects requests
+// without a valid signature and stores it in the context, see
+// GetMessageSignature.
+func MessageSignatureMiddleware(opts MessageSignatureOptions) func(http.Handler) http.Handler {
+	return NewMessageSignatureVerifier(opts).Middleware
+}
+
+// Verify verifies the signature of a request.
+//
+// Business logic:
+// - the signature is selected from Signature-Input and Signature by label
+// - the signature base is built from the covered components (RFC 9421 section 2.5)
+// - derived components: @method, @target-uri, @authority, @scheme, @request-target, @path, @query, @query-param
+// - header components are the combined field values; missing headers fail verification
+// - the key is resolved by "keyid"; an "alg" parameter must match the key
+// - created, expires and nonce are checked as configured
+//
+// Returns:
+//   - *MessageSignature: the verified signature
+//   - error: one of the ErrMessageSignature errors, or a resolver error
+func (v *MessageSignatureVerifier) Verify(r *http.Request) (*MessageSignature, error) {
+	input, signature, err := v.selectSignature(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := &MessageSignature{Label: input.name}
+	if err := readSignatureParams(input.item, sig); err != nil {
+		return nil, err
+	}
+	for _, component := range input.list {
+		name, ok := component.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: component identifiers must be strings", ErrMessageSignatureMalformed)
+		}
+		id := serializeSFBareItem(name) + serializeSFParams(component.params)
+		if slices.Contains(sig.Components, id) {
+			return nil, fmt.Errorf("%w: duplicate component %s", ErrMessageSignatureMalformed, id)
+		}
+		sig.Components = append(sig.Components, id)
+	}
+	for _, required := range v.opts.RequiredComponents {
+		if !slices.Contains(sig.Components, componentIdentifier(required)) {
+			return nil, fmt.Errorf("%w: %q is not covered", ErrMessageSignatureInvalid, required)
+		}
+	}
+
+	if err := v.checkTimes(sig); err != nil {
+		return nil, err
+	}
+
+	base, err := v.signatureBase(r, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.opts.Keys == nil {
+		return nil, ErrMessageSignatureKeyNotFound
+	}
+	key, err := v.opts.Keys.ResolveSignatureKey(r.Context(), sig.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	alg := sig.Algorithm
+	switch {
+	case alg == "":
+		alg = key.Algorithm
+	case key.Algorithm != "" && key.Algorithm != alg:
+		return nil, fmt.Errorf("%w: key %q does not allow %s", ErrMessageSignatureInvalid, sig.KeyID, alg)
+	}
+	if !verifyMessageSignature(alg, key.Key, []byte(base), signature) {
+		return nil, ErrMessageSignatureInvalid
+	}
+	sig.Algorithm = alg
+
+	// Record the nonce only for authentic signatures, so forged requests
+	// cannot burn nonces
+	if v.opts.Nonces != nil && sig.Nonce != "" {
+		expires, _ := v.nonceExpiry(sig) // bounded, see checkTimes
+		if !v.opts.Nonces.UseNonce(r.Context(), sig.KeyID, sig.Nonce, expires) {
+			return nil, ErrMessageSignatureReplayed
+		}
+	}
+	return sig, nil
+}
+
+// Middleware wraps next with the verifier.
+func (v *MessageSignatureVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig, err := v.Verify(r)
+		if err == nil {
+			next.ServeHTTP(w, r.WithContext(WithMessageSignature(r.Context(), sig)))
+			return
+		}
+
+		if !isMessageSignatureError(err) {
+			v.logger().Error("req: signature key resolution failed", "error", err, "path", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		v.logger().Warn("req: message signature rejected", "error", err, "path", r.URL.Path)
+		if v.opts.DeniedHandler != nil {
+			v.opts.DeniedHandler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// selectSignature returns the Signature-Input member and signature bytes
+// of the configured label.
+func (v *MessageSignatureVerifier) selectSignature(r *http.Request) (sfMember, []byte, error) {
+	inputHeader := strings.Join(r.Header.Values("Signature-Input"), ", ")
+	signatureHeader := strings.Join(r.Header.Values("Signature"), ", ")
+	if inputHeader == "" || signatureHeader == "" {
+		return sfMember{}, nil, ErrMessageSignatureMissing
+	}
+	inputs, err1 := parseSFDictionary(inputHeader)
+	signatures, err2 := parseSFDictionary(signatureHeader)
+	if err1 != nil || err2 != nil || len(inputs) == 0 {
+		return sfMember{}, nil, ErrMessageSignatureMalformed
+	}
+
+	var input *sfMember
+	for i := range inputs {
+		if v.opts.Label == "" || inputs[i].name == v.opts.Label {
+			input = &inputs[i]
+			break
+		}
+	}
+	if input == nil {
+		return sfMember{}, nil, fmt.Errorf("%w: no signature labeled %q", ErrMessageSignatureMissing, v.opts.Label)
+	}
+	if !input.isList {
+		return sfMember{}, nil, fmt.Errorf("%w: %s is not an inner list", ErrMessageSignatureMalformed, input.name)
+	}
+	for _, s := range signatures {
+		if s.name != input.name {
+			continue
+		}
+		signature, ok := s.item.value.([]byte)
+		if s.isList || !ok {
+			return sfMember{}, nil, fmt.Errorf("%w: %s is not a byte sequence", ErrMessageSignatureMalformed, s.name)
+		}
+		return *input, signature, nil
+	}
+	return sfMember{}, nil, fmt.Errorf("%w: no signature for %s", ErrMessageSignatureMissing, input.name)
+}
+
+// readSignatureParams copies the signature parameters into sig.
+func readSignatureParams(input sfItem, sig *MessageSignature) error {
+	for _, p := range input.params {
+		var ok bool
+		switch p.name {
+		case "keyid":
+			sig.KeyID, ok = p.value.(string)
+		case "alg":
+			sig.Algorithm, ok = p.value.(string)
+		case "nonce":
+			sig.Nonce, ok = p.value.(string)
+		case "tag":
+			sig.Tag, ok = p.value.(string)
+		case "created", "expires":
+			var n int64
+			if n, ok = p.value.(int64); ok {
+				if p.name == "created" {
+					sig.Created = time.Unix(n, 0)
+				} else {
+					sig.Expires = time.Unix(n, 0)
+				}
+			}
+		default:
+			ok = true
+		}
+		if !ok {
+			return fmt.Errorf("%w: invalid %q parameter", ErrMessageSignatureMalformed, p.name)
+		}
+	}
+	return nil
+}
+
+// componentIdentifier returns the serialized form of a required component,
+// given as a name such as "@method" or as a serialized identifier such as
+// `"@query-param";name="id"`. Malformed identifiers match no component.
+func componentIdentifier(required string) string {
+	if !strings.HasPrefix(required, `"`) {
+		return serializeSFBareItem(required)
+	}
+	p := &sfParser{s: required}
+	item, err := p.item()
+	name, ok := item.value.(string)
+	if err != nil || !ok || !p.done() {
+		return ""
+	}
+	return serializeSFBareItem(name) + serializeSFParams(item.params)
+}
+
+// checkTimes checks created, expires and the nonce requirement.
+func (v *MessageSignatureVerifier) checkTimes(sig *MessageSignature) error {
+	now := v.now()
+	leeway := max(v.opts.Leeway, 0)
+
+	if sig.Created.IsZero() {
+		if v.opts.RequireCreated {
+			return fmt.Errorf("%w: created is required", ErrMessageSignatureInvalid)
+		}
+	} else {
+		if sig.Created.After(now.Add(leeway)) {
+			return fmt.Errorf("%w: created in the future", ErrMessageSignatureInvalid)
+		}
+		if v.opts.MaxAge > 0 && now.Sub(sig.Created) > v.opts.MaxAge+leeway {
+			return ErrMessageSignatureExpired
+		}
+	}
+	if !sig.Expires.IsZero() && !now.Before(sig.Expires.Add(leeway)) {
+		return ErrMessageSignatureExpired
+	}
+	if v.opts.RequireNonce && sig.Nonce == "" {
+		return fmt.Errorf("%w: nonce is required", ErrMessageSignatureInvalid)
+	}
+	if v.opts.Nonces != nil && sig.Nonce != "" {
+		if _, ok := v.nonceExpiry(sig); !ok {
+			return fmt.Errorf("%w: a nonce requires expires, or created with MaxAge", ErrMessageSignatureInvalid)
+		}
+	}
+	return nil
+}
+
+// nonceExpiry returns how long a nonce must be remembered: until the
+// signature can no longer be accepted. It returns false if that is
+// unbounded.
+func (v *MessageSignatureVerifier) nonceExpiry(sig *MessageSignature) (time.Time, bool) {
+	leeway := max(v.opts.Leeway, 0)
+	var limits []time.Time
+	if !sig.Expires.IsZero() {
+		limits = append(limits, sig.Expires.Add(leeway))
+	}
+	if !sig.Created.IsZero() && v.opts.MaxAge > 0 {
+		limits = append(limits, sig.Created.Add(v.opts.MaxAge+leeway))
+	}
+	if len(limits) == 0 {
+		return time.Time{}, false
+	}
+	return slices.MinFunc(limits, time.Time.Compare), true
+}
+
+// signatureBase builds the signature base (RFC 9421 section 2.5).
+func (v *MessageSignatureVerifier) signatureBase(r *http.Request, input sfMember) (string, error) {
+	var b strings.Builder
+	for _, component := range input.list {
+		name := component.value.(string)
+		value, err := v.componentValue(r, name, component)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(serializeSFBareItem(name))
+		b.WriteString(serializeSFParams(component.params))
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(serializeSFInnerList(input.list, input.item.params))
+	return b.String(), nil
+}
+
+// componentValue returns the value of a covered component.
+func (v *MessageSignatureVerifier) componentValue(r *http.Request, name string, component sfItem) (string, error) {
+	if name != strings.ToLower(name) {
+		return "", fmt.Errorf("%w: component %q must be lowercase", ErrMessageSignatureMalformed, name)
+	}
+	for _, p := range component.params {
+		if p.name != "name" || name != "@query-param" {
+			return "", fmt.Errorf("%w: unsupported parameter %q on %q", ErrMessageSignatureMalformed, p.name, name)
+		}
+	}
+
+	if !strings.HasPrefix(name, "@") {
+		values := r.Header.Values(name)
+		if name == "host" && len(values) == 0 && r.Host != "" {
+			values = []string{r.Host}
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("%w: header %q is missing", ErrMessageSignatureInvalid, name)
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.TrimSpace(value)
+		}
+		return strings.Join(trimmed, ", "), nil
+	}
+
+	u := ExternalURL(r, v.opts.HostOptions)
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@target-uri":
+		return u.String(), nil
+	case "@authority":
+		return u.Host, nil
+	case "@scheme":
+		return u.Scheme, nil
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+	case "@path":
+		if path := r.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	case "@query-param":
+		param, ok := component.param("name")
+		paramName, isString := param.(string)
+		if !ok || !isString {
+			return "", fmt.Errorf("%w: @query-param needs a name", ErrMessageSignatureMalformed)
+		}
+		values := r.URL.Query()[paramName]
+		if len(values) != 1 {
+			return "", fmt.Errorf("%w: query parameter %q must occur once", ErrMessageSignatureInvalid, paramName)
+		}
+		return strings.ReplaceAll(url.QueryEscape(values[0]), "+", "%20"), nil
+	}
+	return "", fmt.Errorf("%w: unsupported component %q", ErrMessageSignatureMalformed, name)
+}
+
+// verifyMessageSignature checks a signature with the key of an algorithm.
+func verifyMessageSignature(alg string, key any, base, signature []byte) bool {
+	switch alg {
+	case SignatureAlgHMACSHA256:
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case SignatureAlgRSAPSSSHA512, SignatureAlgRSAV15SHA256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		if alg == SignatureAlgRSAV15SHA256 {
+			digest := sha256.Sum256(base)
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+		}
+		digest := sha512.Sum512(base)
+		opts := &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512}
+		return rsa.VerifyPSS(pub, crypto.SHA512, digest[:], signature, opts) == nil
+	case SignatureAlgECDSAP256, SignatureAlgECDSAP384:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		var digest []byte
+		curve, size := elliptic.P256(), 32
+		if alg == SignatureAlgECDSAP384 {
+			curve, size = elliptic.P384(), 48
+			sum := sha512.Sum384(base)
+			digest = sum[:]
+		} else {
+			sum := sha256.Sum256(base)
+			digest = sum[:]
+		}
+		if pub.Curve != curve || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	case SignatureAlgEd25519:
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, base, signature)
+	}
+	return false
+}
+
+// isMessageSignatureError reports whether err is a verification failure
+// rather than an infrastructure error.
+func isMessageSignatureError(err error) bool {
+	for _, target := range []error{
+		ErrMessageSignatureMissing,
+		ErrMessageSignatureMalformed,
+		ErrMessageSignatureInvalid,
+		ErrMessageSignatureExpired,
+		ErrMessageSignatureReplayed,
+		ErrMessageSignatureKeyNotFound,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// now returns the current time.
+func (v *MessageSignatureVerifier) now() time.Time {
+	if v.opts.Now != nil {
+		return v.opts.Now()
+	}
+	return time.Now()
+}
+
+// logger returns the configured logger.
+func (v *MessageSignatureVerifier) logger() *slog.Logger {
+	if v.opts.Logger != nil {
+		return v.opts.Logger
+	}
+	return slog.Default()
+}
+
+// messageSignatureContextKey is the context key of the verified signature.
+type messageSignatureContextKey struct{}
+
+// WithMessageSignature returns a copy of ctx carrying sig.
+func WithMessageSignature(ctx context.Context, sig *MessageSignature) context.Context {
+	return context.WithValue(ctx, messageSignatureContextKey{}, sig)
+}
+
+// MessageSignatureFromContext returns the signature stored by the message
+// signature middleware.
+func MessageSignatureFromContext(ctx context.Context) (*MessageSignature, bool) {
+	sig, ok := ctx.Value(messageSignatureContextKey{}).(*MessageSignature)
+	return sig, ok && sig != nil
+}
+
+// GetMessageSignature returns the signature stored in the request context
+// by the message signature middleware, or nil if there is none.
+func GetMessageSignature(r *http.Request) *MessageSignature {
+	if r == nil {
+		return nil
+	}
+	sig, _ := MessageSignatureFromContext(r.Context())
+	return sig
+}
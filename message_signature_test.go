@@ -0,0 +1,325 @@
+package req
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc9421Request returns the example request of RFC 9421 appendix B.2.
+func rfc9421Request() *http.Request {
+	r := httptest.NewRequest("POST", "http://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	r.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	r.Header.Set("Content-Length", "18")
+	return r
+}
+
+func TestMessageSignature_RFC9421Examples(t *testing.T) {
+	created := time.Unix(1618884473, 0)
+	secret, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	edKey, _ := base64.StdEncoding.DecodeString("JrQLj5P/89iXES9+vFgrIy29clF9CC/oPPsw3c5D0bs=")
+
+	v := NewMessageSignatureVerifier(MessageSignatureOptions{
+		Keys: SignatureKeyMap{
+			"test-shared-secret": {Key: secret, Algorithm: SignatureAlgHMACSHA256},
+			"test-key-ed25519":   {Key: ed25519.PublicKey(edKey), Algorithm: SignatureAlgEd25519},
+		},
+		Now: func() time.Time { return created.Add(time.Minute) },
+	})
+
+	tests := []struct {
+		name      string
+		input     string
+		signature string
+	}{
+		{
+			"B.2.5 HMAC",
+			`sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`,
+			`sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:`,
+		},
+		{
+			"B.2.6 Ed25519",
+			`sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`,
+			`sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rfc9421Request()
+			r.Header.Set("Signature-Input", tt.input)
+			r.Header.Set("Signature", tt.signature)
+			sig, err := v.Verify(r)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if !sig.Created.Equal(created) {
+				t.Errorf("Created = %v", sig.Created)
+			}
+
+			r.Header.Set("Content-Type", "text/plain")
+			if _, err := v.Verify(r); !errors.Is(err, ErrMessageSignatureInvalid) {
+				t.Errorf("Verify(tampered) error = %v, want ErrMessageSignatureInvalid", err)
+			}
+		})
+	}
+}
+
+// signTestMessage signs r for the given components and parameters with
+// the verifier's own signature base.
+func signTestMessage(t *testing.T, r *http.Request, label, input string, sign func(base []byte) []byte) {
+	t.Helper()
+	r.Header.Set("Signature-Input", label+"="+input)
+	members, err := parseSFDictionary(r.Header.Get("Signature-Input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewMessageSignatureVerifier(MessageSignatureOptions{})
+	base, err := v.signatureBase(r, members[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sign([]byte(base)))+":")
+}
+
+func TestMessageSignature_Algorithms(t *testing.T) {
+	rsaKey := rsaTestKey(t)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("shared-secret")
+
+	ecdsaSign := func(key *ecdsa.PrivateKey, digest []byte, size int) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return sig
+	}
+
+	tests := []struct {
+		alg  string
+		key  any
+		sign func(base []byte) []byte
+	}{
+		{SignatureAlgHMACSHA256, secret, func(base []byte) []byte {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(base)
+			return mac.Sum(nil)
+		}},
+		{SignatureAlgRSAPSSSHA512, &rsaKey.PublicKey, func(base []byte) []byte {
+			digest := sha512.Sum512(base)
+			sig, _ := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+			return sig
+		}},
+		{SignatureAlgRSAV15SHA256, &rsaKey.PublicKey, func(base []byte) []byte {
+			digest := sha256.Sum256(base)
+			sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+			return sig
+		}},
+		{SignatureAlgECDSAP256, &p256.PublicKey, func(base []byte) []byte {
+			digest := sha256.Sum256(base)
+			return ecdsaSign(p256, digest[:], 32)
+		}},
+		{SignatureAlgECDSAP384, &p384.PublicKey, func(base []byte) []byte {
+			digest := sha512.Sum384(base)
+			return ecdsaSign(p384, digest[:], 48)
+		}},
+		{SignatureAlgEd25519, edPub, func(base []byte) []byte {
+			return ed25519.Sign(edKey, base)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			v := NewMessageSignatureVerifier(MessageSignatureOptions{
+				Keys: SignatureKeyMap{"k": {Key: tt.key}},
+			})
+			r := httptest.NewRequest("GET", "http://api.example.com/items?id=7&q=a+b", nil)
+			signTestMessage(t, r, "sig1", `("@method" "@target-uri" "@query-param";name="q");keyid="k";alg="`+tt.alg+`"`, tt.sign)
+
+			sig, err := v.Verify(r)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if sig.Algorithm != tt.alg || sig.KeyID != "k" || len(sig.Components) != 3 {
+				t.Errorf("Verify() = %+v", sig)
+			}
+
+			r.URL.RawQuery = "id=7&q=other"
+			if _, err := v.Verify(r); !errors.Is(err, ErrMessageSignatureInvalid) {
+				t.Errorf("Verify(tampered) error = %v, want ErrMessageSignatureInvalid", err)
+			}
+		})
+	}
+}
+
+func TestMessageSignature_Policy(t *testing.T) {
+	secret := []byte("shared-secret")
+	hmacSign := func(base []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name  string
+		input string
+		opts  MessageSignatureOptions
+		want  error
+	}{
+		{"valid", `("@method" "@path");created=1700000000;keyid="k"`, MessageSignatureOptions{}, nil},
+		{"required component missing", `("@method");keyid="k"`, MessageSignatureOptions{RequiredComponents: []string{"@path"}}, ErrMessageSignatureInvalid},
+		{"required query param", `("@method" "@query-param";name="id");keyid="k"`, MessageSignatureOptions{RequiredComponents: []string{"@method", `"@query-param";name="id"`}}, nil},
+		{"required query param missing", `("@method" "@query-param";name="id");keyid="k"`, MessageSignatureOptions{RequiredComponents: []string{`"@query-param";name="amount"`}}, ErrMessageSignatureInvalid},
+		{"malformed required identifier", `("@method");keyid="k"`, MessageSignatureOptions{RequiredComponents: []string{`"@method`}}, ErrMessageSignatureInvalid},
+		{"too old", `("@method");created=1699999000;keyid="k"`, MessageSignatureOptions{MaxAge: time.Minute}, ErrMessageSignatureExpired},
+		{"expired", `("@method");expires=1699999900;keyid="k"`, MessageSignatureOptions{}, ErrMessageSignatureExpired},
+		{"created in future", `("@method");created=1700000600;keyid="k"`, MessageSignatureOptions{}, ErrMessageSignatureInvalid},
+		{"created required", `("@method");keyid="k"`, MessageSignatureOptions{RequireCreated: true}, ErrMessageSignatureInvalid},
+		{"nonce required", `("@method");keyid="k"`, MessageSignatureOptions{RequireNonce: true}, ErrMessageSignatureInvalid},
+		{"nonce without lifetime", `("@method");created=1700000000;keyid="k";nonce="n"`, MessageSignatureOptions{Nonces: NewMemoryNonceStore()}, ErrMessageSignatureInvalid},
+		{"nonce with expires", `("@method");expires=1700000060;keyid="k";nonce="n"`, MessageSignatureOptions{Nonces: NewMemoryNonceStore()}, nil},
+		{"nonce with max age", `("@method");created=1700000000;keyid="k";nonce="n"`, MessageSignatureOptions{Nonces: NewMemoryNonceStore(), MaxAge: time.Minute}, nil},
+		{"unknown key", `("@method");keyid="other"`, MessageSignatureOptions{}, ErrMessageSignatureKeyNotFound},
+		{"algorithm mismatch", `("@method");keyid="k";alg="ed25519"`, MessageSignatureOptions{}, ErrMessageSignatureInvalid},
+		{"missing header", `("@method" "x-missing");keyid="k"`, MessageSignatureOptions{}, ErrMessageSignatureInvalid},
+		{"unsupported component", `("@status");keyid="k"`, MessageSignatureOptions{}, ErrMessageSignatureMalformed},
+		{"unsupported parameter", `("content-type";sf);keyid="k"`, MessageSignatureOptions{}, ErrMessageSignatureMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Keys = SignatureKeyMap{"k": {Key: secret, Algorithm: SignatureAlgHMACSHA256}}
+			opts.Now = func() time.Time { return now }
+			v := NewMessageSignatureVerifier(opts)
+
+			r := httptest.NewRequest("POST", "http://api.example.com/orders?id=7", nil)
+			r.Header.Set("Signature-Input", "sig1="+tt.input)
+			members, _ := parseSFDictionary(r.Header.Get("Signature-Input"))
+			base, _ := v.signatureBase(r, members[0])
+			r.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(hmacSign([]byte(base)))+":")
+
+			if _, err := v.Verify(r); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageSignature_NonceReplay(t *testing.T) {
+	secret := []byte("shared-secret")
+	v := NewMessageSignatureVerifier(MessageSignatureOptions{
+		Keys:   SignatureKeyMap{"k": {Key: secret, Algorithm: SignatureAlgHMACSHA256}},
+		Nonces: NewMemoryNonceStore(),
+		MaxAge: time.Minute,
+	})
+	sign := func(base []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil)
+	}
+	created := time.Now().Unix()
+
+	newRequest := func(nonce string) *http.Request {
+		r := httptest.NewRequest("POST", "http://api.example.com/pay", nil)
+		signTestMessage(t, r, "sig1", `("@method" "@path");created=`+strconv.FormatInt(created, 10)+`;keyid="k";nonce="`+nonce+`"`, sign)
+		return r
+	}
+
+	if _, err := v.Verify(newRequest("n-1")); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if _, err := v.Verify(newRequest("n-1")); !errors.Is(err, ErrMessageSignatureReplayed) {
+		t.Errorf("Verify(replay) error = %v, want ErrMessageSignatureReplayed", err)
+	}
+	if _, err := v.Verify(newRequest("n-2")); err != nil {
+		t.Errorf("Verify(new nonce) error = %v", err)
+	}
+
+	// A forged request must not consume a nonce
+	forged := newRequest("n-3")
+	forged.Header.Set("Signature", "sig1=:AAAA:")
+	if _, err := v.Verify(forged); !errors.Is(err, ErrMessageSignatureInvalid) {
+		t.Errorf("Verify(forged) error = %v, want ErrMessageSignatureInvalid", err)
+	}
+	if _, err := v.Verify(newRequest("n-3")); err != nil {
+		t.Errorf("Verify(n-3) after forgery error = %v", err)
+	}
+}
+
+func TestMemoryNonceStore_Expiry(t *testing.T) {
+	store := NewMemoryNonceStore()
+	now := time.Unix(1_700_000_000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if !store.UseNonce(ctx, "k", "n", now.Add(time.Minute)) {
+		t.Fatal("UseNonce() = false for a new nonce")
+	}
+	if store.UseNonce(ctx, "k", "n", now.Add(time.Minute)) {
+		t.Error("UseNonce() = true for a reused nonce")
+	}
+	if !store.UseNonce(ctx, "other", "n", now.Add(time.Minute)) {
+		t.Error("UseNonce() = false for the same nonce of another key")
+	}
+	now = now.Add(2 * time.Minute)
+	if !store.UseNonce(ctx, "k", "n", now.Add(time.Minute)) {
+		t.Error("UseNonce() = false after expiry")
+	}
+	if len(store.nonces) != 1 || len(store.expiry) != 1 {
+		t.Errorf("store holds %d nonces and %d expiries, want the expired ones swept", len(store.nonces), len(store.expiry))
+	}
+}
+
+func TestMessageSignatureMiddleware(t *testing.T) {
+	secret := []byte("shared-secret")
+	var got *MessageSignature
+	handler := MessageSignatureMiddleware(MessageSignatureOptions{
+		Keys:   SignatureKeyMap{"k": {Key: secret, Algorithm: SignatureAlgHMACSHA256}},
+		Logger: discardLogger(),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetMessageSignature(r)
+	}))
+
+	r := httptest.NewRequest("GET", "http://api.example.com/", nil)
+	signTestMessage(t, r, "sig1", `("@method" "@authority");keyid="k"`, func(base []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil)
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || got == nil || got.KeyID != "k" {
+		t.Errorf("status = %d, signature = %+v", w.Code, got)
+	}
+
+	got = nil
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized || got != nil {
+		t.Errorf("unsigned: status = %d, signature = %+v", w.Code, got)
+	}
+}
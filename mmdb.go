@@ -0,0 +1,440 @@
+package req
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// ErrInvalidMMDB is returned (wrapped) when a MaxMind DB file is malformed.
+var ErrInvalidMMDB = errors.New("req: invalid MaxMind DB")
+
+// ErrMMDBIPv6 is returned (wrapped) when an IPv6 address is looked up in an
+// IPv4-only MaxMind DB.
+var ErrMMDBIPv6 = errors.New("req: IPv6 address in IPv4-only MaxMind DB")
+
+// mmdbMetadataMarker separates the data section from the metadata.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMaxDepth limits nesting and pointer chains in the data section.
+const mmdbMaxDepth = 64
+
+// MMDBMetadata holds the metadata of a MaxMind DB file.
+type MMDBMetadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+	Languages    []string
+	BuildEpoch   uint
+	Description  map[string]string
+}
+
+// MMDBReader reads MaxMind DB (MMDB) files, such as GeoLite2 City and ASN
+// databases, entirely in process. A reader is immutable and safe for
+// concurrent use.
+type MMDBReader struct {
+	meta      MMDBMetadata
+	tree      []byte
+	data      mmdbDecoder
+	ipv4Start uint
+}
+
+// OpenMMDB reads a MaxMind DB file from disk.
+func OpenMMDB(path string) (*MMDBReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDBReader(buf)
+}
+
+// NewMMDBReader parses a MaxMind DB held in memory.
+func NewMMDBReader(buf []byte) (*MMDBReader, error) {
+	markerAt := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if markerAt == -1 {
+		return nil, fmt.Errorf("%w: metadata marker not found", ErrInvalidMMDB)
+	}
+
+	metaDecoder := mmdbDecoder{buf: buf[markerAt+len(mmdbMetadataMarker):]}
+	raw, _, err := metaDecoder.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	metaMap, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidMMDB)
+	}
+	meta := parseMMDBMetadata(metaMap)
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidMMDB, meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidMMDB, meta.IPVersion)
+	}
+
+	treeSize := meta.RecordSize * 2 / 8 * meta.NodeCount
+	dataStart := treeSize + 16 // 16 byte data section separator
+	if dataStart > uint(markerAt) {
+		return nil, fmt.Errorf("%w: search tree exceeds file size", ErrInvalidMMDB)
+	}
+
+	reader := &MMDBReader{
+		meta: meta,
+		tree: buf[:treeSize],
+		data: mmdbDecoder{buf: buf[dataStart:markerAt]},
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if meta.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = reader.readRecord(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+
+	return reader, nil
+}
+
+// Metadata returns the database metadata.
+func (r *MMDBReader) Metadata() MMDBMetadata {
+	return r.meta
+}
+
+// Lookup returns the decoded record for ip. Maps are returned as
+// map[string]any, arrays as []any, unsigned integers as uint64 (or
+// *big.Int for uint128), signed integers as int64 and floats as float64.
+//
+// Returns:
+//   - any: the record, nil if the address is not in the database
+//   - bool: true if a record was found
+//   - error: if ip cannot be searched or the database is corrupt
+func (r *MMDBReader) Lookup(ip net.IP) (any, bool, error) {
+	key := ip.To4()
+	node := r.ipv4Start
+	if key == nil {
+		if r.meta.IPVersion == 4 {
+			return nil, false, fmt.Errorf("%w: %s", ErrMMDBIPv6, ip)
+		}
+		key = ip.To16()
+		node = 0
+	}
+	if key == nil {
+		return nil, false, fmt.Errorf("req: invalid IP address")
+	}
+
+	for i := 0; i < len(key)*8 && node < r.meta.NodeCount; i++ {
+		bit := uint(key[i/8]>>(7-uint(i%8))) & 1
+		node = r.readRecord(node, bit)
+	}
+
+	switch {
+	case node == r.meta.NodeCount:
+		return nil, false, nil
+	case node < r.meta.NodeCount:
+		return nil, false, fmt.Errorf("%w: search tree deeper than address", ErrInvalidMMDB)
+	}
+
+	offset := node - r.meta.NodeCount - 16
+	value, _, err := r.data.decode(offset, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// LookupGeo implements GeoSource for GeoIP2/GeoLite2 City, Country and ASN
+// databases. IPv6 addresses are not found in IPv4-only databases.
+func (r *MMDBReader) LookupGeo(ip net.IP) (GeoInfo, bool, error) {
+	value, found, err := r.Lookup(ip)
+	if errors.Is(err, ErrMMDBIPv6) {
+		return GeoInfo{}, false, nil
+	}
+	if err != nil || !found {
+		return GeoInfo{}, false, err
+	}
+	record, ok := value.(map[string]any)
+	if !ok {
+		return GeoInfo{}, false, fmt.Errorf("%w: record is not a map", ErrInvalidMMDB)
+	}
+	return geoInfoFromMMDB(record), true, nil
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of a node.
+func (r *MMDBReader) readRecord(node, bit uint) uint {
+	b := r.tree
+	switch r.meta.RecordSize {
+	case 24:
+		off := node*6 + bit*3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		off := node * 7
+		if bit == 0 {
+			return uint(b[off+3]&0xF0)<<20 | uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+		}
+		return uint(b[off+3]&0x0F)<<24 | uint(b[off+4])<<16 | uint(b[off+5])<<8 | uint(b[off+6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(b[off : off+4]))
+	}
+}
+
+// parseMMDBMetadata converts the decoded metadata map.
+func parseMMDBMetadata(m map[string]any) MMDBMetadata {
+	meta := MMDBMetadata{
+		NodeCount:    uint(mmdbUint(m["node_count"])),
+		RecordSize:   uint(mmdbUint(m["record_size"])),
+		IPVersion:    uint(mmdbUint(m["ip_version"])),
+		DatabaseType: mmdbString(m["database_type"]),
+		BuildEpoch:   uint(mmdbUint(m["build_epoch"])),
+		Description:  map[string]string{},
+	}
+	if langs, ok := m["languages"].([]any); ok {
+		for _, l := range langs {
+			meta.Languages = append(meta.Languages, mmdbString(l))
+		}
+	}
+	if desc, ok := m["description"].(map[string]any); ok {
+		for k, v := range desc {
+			meta.Description[k] = mmdbString(v)
+		}
+	}
+	return meta
+}
+
+// mmdbDecoder decodes the MaxMind DB data section format.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset, returning it and the offset just
+// past it.
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("%w: data nested too deeply", ErrInvalidMMDB)
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("%w: offset %d out of range", ErrInvalidMMDB, offset)
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == 1 {
+		pointer, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if typ == 0 {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(ext[0])
+		offset++
+	}
+
+	size, offset, err := d.decodeSize(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case 2: // UTF-8 string
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return string(b), offset + size, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: invalid double size %d", ErrInvalidMMDB, size)
+		}
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset + size, nil
+	case 4: // bytes
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return append([]byte(nil), b...), offset + size, nil
+	case 5, 6, 9: // uint16, uint32, uint64
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: invalid integer size %d", ErrInvalidMMDB, size)
+		}
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset + size, nil
+	case 10: // uint128
+		if size > 16 {
+			return nil, 0, fmt.Errorf("%w: invalid integer size %d", ErrInvalidMMDB, size)
+		}
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return new(big.Int).SetBytes(b), offset + size, nil
+	case 8: // int32
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: invalid integer size %d", ErrInvalidMMDB, size)
+		}
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset + size, nil
+	case 7: // map
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidMMDB)
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean, the value is stored in the size
+		if size > 1 {
+			return nil, 0, fmt.Errorf("%w: invalid boolean", ErrInvalidMMDB)
+		}
+		return size == 1, offset, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: invalid float size %d", ErrInvalidMMDB, size)
+		}
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset + size, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: unsupported data type %d", ErrInvalidMMDB, typ)
+}
+
+// decodeSize decodes the payload size encoded in the control byte.
+func (d *mmdbDecoder) decodeSize(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28 // 1, 2 or 3 extra bytes
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	var v uint
+	for _, c := range b {
+		v = v<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		return 29 + v, offset + n, nil
+	case 30:
+		return 285 + v, offset + n, nil
+	default:
+		return 65821 + v, offset + n, nil
+	}
+}
+
+// decodePointer decodes a pointer, returning its target and the offset just
+// past it.
+func (d *mmdbDecoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	ss := uint(ctrl>>3) & 0x3
+	vvv := uint(ctrl & 0x7)
+
+	b, err := d.bytes(offset, ss+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	var v uint
+	for _, c := range b {
+		v = v<<8 | uint(c)
+	}
+
+	switch ss {
+	case 0:
+		return vvv<<8 | v, offset + 1, nil
+	case 1:
+		return (vvv<<16 | v) + 2048, offset + 2, nil
+	case 2:
+		return (vvv<<24 | v) + 526336, offset + 3, nil
+	default:
+		return v, offset + 4, nil
+	}
+}
+
+// bytes returns n bytes starting at offset.
+func (d *mmdbDecoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) || offset+n < offset {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidMMDB)
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// mmdbUint returns v as uint64, or 0 if it is not an unsigned integer.
+func mmdbUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case *big.Int:
+		if n.IsUint64() {
+			return n.Uint64()
+		}
+	}
+	return 0
+}
+
+// mmdbString returns v as string, or "" if it is not a string.
+func mmdbString(v any) string {
+	s, _ := v.(string)
+	return s
+}
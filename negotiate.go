@@ -0,0 +1,470 @@
+package req
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is one element of an Accept header.
+type MediaRange struct {
+	Type    string // lowercase, "*" for "*/*"
+	Subtype string // lowercase, "*" for "type/*"
+	Params  map[string]string
+	Q       float64
+}
+
+// String returns the range as "type/subtype".
+func (m MediaRange) String() string {
+	return m.Type + "/" + m.Subtype
+}
+
+// specificity ranks "*/*" < "type/*" < "type/subtype" < with parameters.
+func (m MediaRange) specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	default:
+		return 2 + len(m.Params)
+	}
+}
+
+// QualityValue is one element of an Accept-Language, Accept-Encoding or
+// Accept-Charset header.
+type QualityValue struct {
+	Value string // lowercase
+	Q     float64
+}
+
+// ParseAccept parses an Accept header (RFC 9110 section 12.5.1).
+//
+// Business logic:
+// - elements without a valid "type/subtype" or q-value are skipped
+// - media type parameters before "q" are kept, accept extensions after it are ignored
+// - the result is ordered by q-value, then specificity ("text/html;level=1" > "text/html" > "text/*" > "*/*"), then header order
+//
+// Parameters:
+//   - header: The Accept header value
+//
+// Returns:
+//   - []MediaRange: the parsed ranges, including those with q=0
+func ParseAccept(header string) []MediaRange {
+	var ranges []MediaRange
+	for _, element := range splitHeaderList(header) {
+		parts := splitHeaderParams(element)
+		mediaType, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(parts[0])), "/")
+		if !ok || mediaType == "" || subtype == "" || (mediaType == "*" && subtype != "*") {
+			continue
+		}
+
+		m := MediaRange{Type: mediaType, Subtype: subtype, Q: 1}
+		valid := true
+		for _, param := range parts[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "q" {
+				m.Q, valid = parseQValue(value)
+				break
+			}
+			if m.Params == nil {
+				m.Params = map[string]string{}
+			}
+			m.Params[name] = unquoteHeader(strings.TrimSpace(value))
+		}
+		if valid {
+			ranges = append(ranges, m)
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Q != ranges[j].Q {
+			return ranges[i].Q > ranges[j].Q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// ParseAcceptLanguage parses an Accept-Language header (RFC 9110 section
+// 12.5.4), ordered by q-value, then number of subtags, then header order.
+func ParseAcceptLanguage(header string) []QualityValue {
+	return parseQualityValues(header, func(v string) int {
+		if v == "*" {
+			return 0
+		}
+		return 1 + strings.Count(v, "-")
+	})
+}
+
+// ParseAcceptEncoding parses an Accept-Encoding header (RFC 9110 section
+// 12.5.3), ordered by q-value, with "*" after named codings.
+func ParseAcceptEncoding(header string) []QualityValue {
+	return parseQualityValues(header, wildcardSpecificity)
+}
+
+// ParseAcceptCharset parses an Accept-Charset header (RFC 9110 section
+// 12.5.2), ordered by q-value, with "*" after named charsets.
+func ParseAcceptCharset(header string) []QualityValue {
+	return parseQualityValues(header, wildcardSpecificity)
+}
+
+// Negotiate returns the offered media type that best matches the Accept
+// header of the request, e.g. to pick JSON, HTML or CSV.
+//
+// Business logic:
+// - without an Accept header, the first offer is returned
+// - each offer gets the q-value of the most specific range matching it
+// - the offer with the highest q-value wins; ties go to the more specific range, then the earlier offer
+// - offers only matched by q=0 ranges are not acceptable
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - offers ([]string): The media types the handler can produce, in order of preference
+//
+// Returns:
+//   - string: the chosen offer, or an empty string if none is acceptable (406 Not Acceptable)
+func Negotiate(r *http.Request, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	header := headerValues(r, "Accept")
+	if header == "" {
+		return offers[0]
+	}
+	ranges := ParseAccept(header)
+
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, offer := range offers {
+		offerRange, ok := parseOfferMediaType(offer)
+		if !ok {
+			continue
+		}
+		q, specificity := mostSpecificMatch(ranges, offerRange)
+		if q == 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+	return best
+}
+
+// NegotiateLanguage returns the offered language that best matches the
+// Accept-Language header of the request, falling back along a chain such
+// as pt-BR → pt → en.
+//
+// Business logic:
+// - ranges are tried in q-value order; q=0 excludes a language
+// - a range matches an offer exactly, or an offer it is a prefix of ("pt" matches "pt-BR")
+// - otherwise the range is shortened subtag by subtag ("pt-BR" tries "pt")
+// - "*" matches the first offer not excluded
+// - if nothing matches, the first offer is returned as the default
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - offers ([]string): The supported language tags, the first being the default
+//
+// Returns:
+//   - string: the chosen offer, as written in offers
+func NegotiateLanguage(r *http.Request, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if offer, ok := negotiateLanguage(r, offers); ok {
+		return offer
+	}
+	return offers[0]
+}
+
+// negotiateLanguage is NegotiateLanguage without the default, reporting
+// whether Accept-Language matched an offer.
+func negotiateLanguage(r *http.Request, offers []string) (string, bool) {
+	ranges := ParseAcceptLanguage(headerValues(r, "Accept-Language"))
+	excluded := map[string]bool{}
+	for _, lang := range ranges {
+		if lang.Q == 0 {
+			excluded[lang.Value] = true
+		}
+	}
+	acceptable := func(offer string) bool {
+		return !excluded[strings.ToLower(offer)]
+	}
+
+	for _, lang := range ranges {
+		if lang.Q == 0 {
+			continue
+		}
+		if lang.Value == "*" {
+			for _, offer := range offers {
+				if acceptable(offer) {
+					return offer, true
+				}
+			}
+			continue
+		}
+		if offer := lookupLanguage(lang.Value, offers, acceptable); offer != "" {
+			return offer, true
+		}
+	}
+	return "", false
+}
+
+// NegotiateEncoding returns the offered content coding that best matches
+// the Accept-Encoding header of the request, e.g. "br", "gzip" or
+// "identity".
+//
+// Business logic:
+// - without an Accept-Encoding header, the first offer is returned
+// - each offer gets the q-value of its own entry, or of "*"
+// - "identity" is acceptable unless excluded by "identity;q=0" or "*;q=0"
+// - the highest q-value wins; ties go to the earlier offer
+//
+// Returns:
+//   - string: the chosen offer, or an empty string if none is acceptable
+func NegotiateEncoding(r *http.Request, offers []string) string {
+	header, ok := headerValuesOK(r, "Accept-Encoding")
+	if !ok {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	return negotiateQualityValues(ParseAcceptEncoding(header), offers, "identity")
+}
+
+// NegotiateCharset returns the offered charset that best matches the
+// Accept-Charset header of the request. Without the header, the first
+// offer is returned; otherwise it works like NegotiateEncoding.
+func NegotiateCharset(r *http.Request, offers []string) string {
+	header, ok := headerValuesOK(r, "Accept-Charset")
+	if !ok {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	return negotiateQualityValues(ParseAcceptCharset(header), offers, "")
+}
+
+// negotiateQualityValues picks the offer with the highest q-value.
+// implicit names an offer acceptable when not mentioned, like "identity".
+func negotiateQualityValues(values []QualityValue, offers []string, implicit string) string {
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, found := -1.0, false
+		wildcard := -1.0
+		for _, v := range values {
+			switch v.Value {
+			case strings.ToLower(offer):
+				if !found {
+					q, found = v.Q, true
+				}
+			case "*":
+				if wildcard < 0 {
+					wildcard = v.Q
+				}
+			}
+		}
+		switch {
+		case found:
+		case wildcard >= 0:
+			q = wildcard
+		case implicit != "" && strings.EqualFold(offer, implicit):
+			q = 0.001 // acceptable, but least preferred
+		default:
+			q = 0
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// lookupLanguage finds the offer matching a language range.
+func lookupLanguage(lang string, offers []string, acceptable func(string) bool) string {
+	for _, offer := range offers {
+		if strings.EqualFold(offer, lang) && acceptable(offer) {
+			return offer
+		}
+	}
+	for _, offer := range offers {
+		if strings.HasPrefix(strings.ToLower(offer), lang+"-") && acceptable(offer) {
+			return offer
+		}
+	}
+	for {
+		i := strings.LastIndex(lang, "-")
+		if i == -1 {
+			return ""
+		}
+		lang = lang[:i]
+		// A singleton such as "x" is removed with the subtag following it
+		if j := strings.LastIndex(lang, "-"); j != -1 && j == len(lang)-2 {
+			lang = lang[:j]
+		}
+		for _, offer := range offers {
+			if strings.EqualFold(offer, lang) && acceptable(offer) {
+				return offer
+			}
+		}
+	}
+}
+
+// mostSpecificMatch returns the q-value and specificity of the most
+// specific range matching offer.
+func mostSpecificMatch(ranges []MediaRange, offer MediaRange) (float64, int) {
+	q, specificity := 0.0, -1
+	for _, m := range ranges {
+		if s := m.specificity(); mediaRangeMatches(m, offer) && s > specificity {
+			q, specificity = m.Q, s
+		}
+	}
+	return q, specificity
+}
+
+// mediaRangeMatches reports whether an Accept range covers an offer.
+func mediaRangeMatches(m, offer MediaRange) bool {
+	if m.Type != "*" && m.Type != offer.Type {
+		return false
+	}
+	if m.Subtype != "*" && m.Subtype != offer.Subtype {
+		return false
+	}
+	for name, value := range m.Params {
+		if !strings.EqualFold(offer.Params[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOfferMediaType parses an offered media type such as
+// "text/html; charset=utf-8".
+func parseOfferMediaType(offer string) (MediaRange, bool) {
+	ranges := ParseAccept(offer)
+	if len(ranges) != 1 || ranges[0].Type == "*" || ranges[0].Subtype == "*" {
+		return MediaRange{}, false
+	}
+	return ranges[0], true
+}
+
+// parseQualityValues parses a "value;q=x" list and orders it.
+func parseQualityValues(header string, specificity func(string) int) []QualityValue {
+	var values []QualityValue
+	for _, element := range splitHeaderList(header) {
+		parts := splitHeaderParams(element)
+		value := strings.ToLower(strings.TrimSpace(parts[0]))
+		if value == "" {
+			continue
+		}
+
+		v := QualityValue{Value: value, Q: 1}
+		valid := true
+		for _, param := range parts[1:] {
+			name, q, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(name), "q") {
+				v.Q, valid = parseQValue(q)
+				break
+			}
+		}
+		if valid {
+			values = append(values, v)
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		if values[i].Q != values[j].Q {
+			return values[i].Q > values[j].Q
+		}
+		return specificity(values[i].Value) > specificity(values[j].Value)
+	})
+	return values
+}
+
+// wildcardSpecificity ranks "*" below named values.
+func wildcardSpecificity(v string) int {
+	if v == "*" {
+		return 0
+	}
+	return 1
+}
+
+// parseQValue parses a weight: "0" to "1" with up to three decimals.
+func parseQValue(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > 5 || (s[0] != '0' && s[0] != '1') {
+		return 0, false
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0, false
+	}
+	return q, true
+}
+
+// headerValues joins all values of a request header into one list.
+func headerValues(r *http.Request, name string) string {
+	value, _ := headerValuesOK(r, name)
+	return value
+}
+
+// headerValuesOK is like headerValues, reporting whether the header is present.
+func headerValuesOK(r *http.Request, name string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	values, ok := r.Header[http.CanonicalHeaderKey(name)]
+	return strings.Join(values, ","), ok
+}
+
+// splitHeaderList splits a comma separated header list, ignoring commas in
+// quoted strings and empty elements.
+func splitHeaderList(header string) []string {
+	var elements []string
+	for header != "" {
+		var element string
+		element, header = cutHeader(header, ',')
+		header = strings.TrimPrefix(header, ",")
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// splitHeaderParams splits an element into its value and ';' separated
+// parameters, ignoring semicolons in quoted strings.
+func splitHeaderParams(element string) []string {
+	var parts []string
+	for {
+		var part string
+		part, element = cutHeader(element, ';')
+		parts = append(parts, strings.TrimSpace(part))
+		if element == "" {
+			return parts
+		}
+		element = element[1:]
+	}
+}
+
+// cutHeader returns the text up to the next sep outside quotes, and the
+// rest starting at sep.
+func cutHeader(s string, sep byte) (string, string) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
@@ -0,0 +1,164 @@
+package req
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/*;q=0.3, text/html;q=0.7, text/html;level=1, text/html;level=2;q=0.4, */*;q=0.5, application/json;q=bogus, invalid, */json`)
+
+	var got []string
+	for _, m := range ranges {
+		got = append(got, m.String())
+	}
+	expected := []string{"text/html", "text/html", "*/*", "text/html", "text/*"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ParseAccept() = %v, want %v", got, expected)
+	}
+	if ranges[0].Params["level"] != "1" || ranges[0].Q != 1 {
+		t.Errorf("ParseAccept()[0] = %+v, want level=1 with q=1", ranges[0])
+	}
+	if ranges[3].Params["level"] != "2" || ranges[3].Q != 0.4 {
+		t.Errorf("ParseAccept()[3] = %+v, want level=2 with q=0.4", ranges[3])
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := ParseAcceptLanguage("en;q=0.8, *;q=0.1, pt-BR, pt;q=0.9, fr;q=1.5, de;q=0")
+	expected := []QualityValue{
+		{Value: "pt-br", Q: 1},
+		{Value: "pt", Q: 0.9},
+		{Value: "en", Q: 0.8},
+		{Value: "*", Q: 0.1},
+		{Value: "de", Q: 0},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseAcceptLanguage() = %v, want %v", got, expected)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "text/html", "text/csv"}
+
+	tests := []struct {
+		name     string
+		accept   string
+		offers   []string
+		expected string
+	}{
+		{name: "no header", accept: "", offers: offers, expected: "application/json"},
+		{name: "exact", accept: "text/csv", offers: offers, expected: "text/csv"},
+		{name: "q-values", accept: "text/html;q=0.5, text/csv;q=0.9", offers: offers, expected: "text/csv"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", offers: offers, expected: "text/html"},
+		{name: "wildcard keeps offer order", accept: "*/*", offers: offers, expected: "application/json"},
+		{name: "subtype wildcard", accept: "text/*", offers: offers, expected: "text/html"},
+		{name: "specific range overrides wildcard", accept: "text/*, text/html;q=0", offers: offers, expected: "text/csv"},
+		{name: "not acceptable", accept: "image/png", offers: offers, expected: ""},
+		{name: "excluded", accept: "*/*;q=0", offers: offers, expected: ""},
+		{name: "case insensitive", accept: "Application/JSON", offers: offers, expected: "application/json"},
+		{name: "offer with parameters", accept: "text/html;charset=utf-8", offers: []string{"text/html; charset=UTF-8"}, expected: "text/html; charset=UTF-8"},
+		{name: "parameter mismatch", accept: "text/html;level=1", offers: []string{"text/html"}, expected: ""},
+		{name: "no offers", accept: "*/*", offers: nil, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := Negotiate(r, tt.offers); got != tt.expected {
+				t.Errorf("Negotiate() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		offers   []string
+		expected string
+	}{
+		{name: "no header uses default", header: "", offers: []string{"en", "pt"}, expected: "en"},
+		{name: "exact", header: "pt-BR", offers: []string{"en", "pt", "pt-BR"}, expected: "pt-BR"},
+		{name: "fallback to language", header: "pt-BR", offers: []string{"en", "pt"}, expected: "pt"},
+		{name: "fallback to default", header: "pt-BR", offers: []string{"en", "de"}, expected: "en"},
+		{name: "range prefix of offer", header: "pt", offers: []string{"en", "pt-BR"}, expected: "pt-BR"},
+		{name: "q-values", header: "de;q=0.5, fr;q=0.8", offers: []string{"en", "de", "fr"}, expected: "fr"},
+		{name: "second choice", header: "ja, fr;q=0.8", offers: []string{"en", "fr"}, expected: "fr"},
+		{name: "case insensitive", header: "PT-br", offers: []string{"en", "pt-BR"}, expected: "pt-BR"},
+		{name: "wildcard", header: "*", offers: []string{"en", "fr"}, expected: "en"},
+		{name: "wildcard with exclusion", header: "*, en;q=0", offers: []string{"en", "fr"}, expected: "fr"},
+		{name: "singleton truncated", header: "zh-Hant-x-private", offers: []string{"en", "zh-Hant"}, expected: "zh-Hant"},
+		{name: "script fallback", header: "zh-Hant-TW", offers: []string{"en", "zh"}, expected: "zh"},
+		{name: "no offers", header: "en", offers: nil, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Accept-Language", tt.header)
+			}
+			if got := NegotiateLanguage(r, tt.offers); got != tt.expected {
+				t.Errorf("NegotiateLanguage() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	offers := []string{"br", "gzip", "identity"}
+
+	tests := []struct {
+		name     string
+		header   *string
+		expected string
+	}{
+		{name: "no header", header: nil, expected: "br"},
+		{name: "empty header", header: ptr(""), expected: "identity"},
+		{name: "preference", header: ptr("gzip, br;q=0.5"), expected: "gzip"},
+		{name: "tie keeps offer order", header: ptr("gzip, br"), expected: "br"},
+		{name: "wildcard", header: ptr("*"), expected: "br"},
+		{name: "unsupported", header: ptr("zstd"), expected: "identity"},
+		{name: "identity excluded", header: ptr("zstd, identity;q=0"), expected: ""},
+		{name: "wildcard excluded", header: ptr("zstd, *;q=0"), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != nil {
+				r.Header["Accept-Encoding"] = []string{*tt.header}
+			}
+			if got := NegotiateEncoding(r, offers); got != tt.expected {
+				t.Errorf("NegotiateEncoding() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiateCharset(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := NegotiateCharset(r, []string{"utf-8", "iso-8859-1"}); got != "utf-8" {
+		t.Errorf("NegotiateCharset() = %q, want utf-8", got)
+	}
+
+	r.Header.Set("Accept-Charset", "iso-8859-1, utf-8;q=0.7")
+	if got := NegotiateCharset(r, []string{"UTF-8", "ISO-8859-1"}); got != "ISO-8859-1" {
+		t.Errorf("NegotiateCharset() = %q, want ISO-8859-1", got)
+	}
+
+	r.Header.Set("Accept-Charset", "koi8-r")
+	if got := NegotiateCharset(r, []string{"utf-8"}); got != "" {
+		t.Errorf("NegotiateCharset() = %q, want \"\"", got)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
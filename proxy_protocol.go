@@ -0,0 +1,492 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidProxyHeader is returned (wrapped) when a PROXY protocol header
+// is malformed.
+var ErrInvalidProxyHeader = errors.New("req: invalid PROXY protocol header")
+
+// ErrMissingProxyHeader is returned when a trusted connection does not start
+// with a PROXY protocol header and ProxyProtocolOptions.RequireHeader is set.
+var ErrMissingProxyHeader = errors.New("req: missing PROXY protocol header")
+
+// DefaultProxyHeaderTimeout is the time allowed to receive the PROXY header
+// when ProxyProtocolOptions.HeaderTimeout is not set.
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// PROXY protocol v2 TLV types (see the HAProxy PROXY protocol specification).
+const (
+	ProxyTLVTypeALPN      byte = 0x01
+	ProxyTLVTypeAuthority byte = 0x02
+	ProxyTLVTypeCRC32C    byte = 0x03
+	ProxyTLVTypeNoop      byte = 0x04
+	ProxyTLVTypeUniqueID  byte = 0x05
+	ProxyTLVTypeSSL       byte = 0x20
+	ProxyTLVTypeNetNS     byte = 0x30
+	ProxyTLVTypeAWS       byte = 0xEA // AWS VPC endpoint ID
+)
+
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyV1MaxLength is the maximum length of a v1 header, including CRLF.
+const proxyV1MaxLength = 107
+
+// ProxyTLV is a type-length-value extension of a PROXY protocol v2 header.
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyHeader is a parsed PROXY protocol header.
+type ProxyHeader struct {
+	// Version is 1 for the text format and 2 for the binary format
+	Version int
+	// Local is true for v2 LOCAL commands and v1 UNKNOWN connections; the
+	// addresses are then not set and the connection's own addresses apply
+	Local bool
+	// Network is "tcp", "udp" or "unix" (empty when Local)
+	Network string
+	// SourceAddr is the address of the original client
+	SourceAddr net.Addr
+	// DestinationAddr is the address the client connected to
+	DestinationAddr net.Addr
+	// TLVs holds the v2 extensions in the order received
+	TLVs []ProxyTLV
+}
+
+// TLV returns the value of the first TLV of the given type.
+func (h *ProxyHeader) TLV(t byte) ([]byte, bool) {
+	if h == nil {
+		return nil, false
+	}
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ProxyProtocolOptions configures NewProxyProtocolListener.
+type ProxyProtocolOptions struct {
+	// TrustedSources lists the CIDRs or single IPs allowed to send PROXY
+	// headers (same format as IPOptions.TrustedProxies). Connections from other
+	// peers are passed through untouched. Empty means no peer is trusted, as
+	// any client reaching the port directly could otherwise forge its address.
+	TrustedSources []string
+	// RequireHeader makes trusted connections without a PROXY header fail.
+	// Otherwise such connections keep their original addresses.
+	RequireHeader bool
+	// HeaderTimeout limits the time spent waiting for the header.
+	// Zero means DefaultProxyHeaderTimeout.
+	HeaderTimeout time.Duration
+}
+
+// NewProxyProtocolListener wraps a listener so that accepted connections
+// report the client address carried by a PROXY protocol v1 or v2 header as
+// their RemoteAddr. Behind HAProxy or an AWS NLB this makes r.RemoteAddr,
+// and therefore GetIP and GetIPWithOptions, return the real client.
+//
+// The header is read lazily on the first Read, RemoteAddr or LocalAddr call,
+// so a slow peer does not block Accept.
+//
+// Example:
+//
+//	ln, _ := net.Listen("tcp", ":8080")
+//	ln = req.NewProxyProtocolListener(ln, req.ProxyProtocolOptions{
+//	    TrustedSources: []string{"10.0.0.0/8"},
+//	})
+//	http.Serve(ln, handler)
+func NewProxyProtocolListener(inner net.Listener, opts ProxyProtocolOptions) net.Listener {
+	return &proxyProtocolListener{
+		Listener: inner,
+		trusted:  parseCIDRs(opts.TrustedSources),
+		opts:     opts,
+	}
+}
+
+// proxyProtocolListener implements NewProxyProtocolListener.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	opts    ProxyProtocolOptions
+}
+
+// Accept waits for the next connection and wraps it if its peer is trusted.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !containsIP(l.trusted, NormalizeIP(conn.RemoteAddr().String())) {
+		return conn, nil
+	}
+	return &ProxyProtocolConn{Conn: conn, opts: l.opts}, nil
+}
+
+// ProxyProtocolConn is a connection accepted by a PROXY protocol listener.
+type ProxyProtocolConn struct {
+	net.Conn
+	opts   ProxyProtocolOptions
+	once   sync.Once
+	reader *bufio.Reader
+	header *ProxyHeader
+	err    error
+
+	mu           sync.Mutex
+	readDeadline time.Time // last read deadline set by the caller
+}
+
+// ProxyHeader returns the parsed PROXY header, reading it if necessary.
+// The header is nil when the peer did not send one.
+func (c *ProxyProtocolConn) ProxyHeader() (*ProxyHeader, error) {
+	c.once.Do(c.readHeader)
+	return c.header, c.err
+}
+
+// Read reads data following the PROXY header.
+func (c *ProxyProtocolConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header, or the
+// address of the peer if no usable header was received.
+func (c *ProxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.header != nil && !c.header.Local && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address from the PROXY header, or the
+// local address of the connection if no usable header was received.
+func (c *ProxyProtocolConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.header != nil && !c.header.Local && c.header.DestinationAddr != nil {
+		return c.header.DestinationAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *ProxyProtocolConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *ProxyProtocolConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// readHeader reads the PROXY header from the underlying connection.
+// While reading, the read deadline is the earlier of HeaderTimeout and the
+// caller's deadline; the caller's deadline is restored afterwards.
+func (c *ProxyProtocolConn) readHeader() {
+	c.reader = bufio.NewReader(c.Conn)
+
+	timeout := c.opts.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	c.mu.Lock()
+	if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+		deadline = c.readDeadline
+	}
+	err := c.Conn.SetReadDeadline(deadline)
+	c.mu.Unlock()
+	if err == nil {
+		defer func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.Conn.SetReadDeadline(c.readDeadline)
+		}()
+	}
+
+	c.header, c.err = ReadProxyHeader(c.reader)
+	if c.err == nil && c.header == nil && c.opts.RequireHeader {
+		c.err = ErrMissingProxyHeader
+	}
+}
+
+// ReadProxyHeader reads a PROXY protocol v1 or v2 header from r.
+// It returns a nil header and no error if r does not start with a PROXY
+// header, in which case no bytes are consumed.
+func ReadProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch first[0] {
+	case proxyV1Signature[0]:
+		sig, err := r.Peek(len(proxyV1Signature))
+		if err != nil || !bytes.Equal(sig, proxyV1Signature) {
+			return nil, ignoreEOF(err)
+		}
+		return readProxyHeaderV1(r)
+	case proxyV2Signature[0]:
+		sig, err := r.Peek(len(proxyV2Signature))
+		if err != nil || !bytes.Equal(sig, proxyV2Signature) {
+			return nil, ignoreEOF(err)
+		}
+		return readProxyHeaderV2(r)
+	}
+	return nil, nil
+}
+
+// readProxyHeaderV1 parses a text header such as
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readProxyHeaderV1(r *bufio.Reader) (*ProxyHeader, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProxyHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, fmt.Errorf("%w: v1 header too long", ErrInvalidProxyHeader)
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header must end with CRLF", ErrInvalidProxyHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &ProxyHeader{Version: 1, Local: true}, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: v1 header must have 6 fields", ErrInvalidProxyHeader)
+	}
+
+	var wantIPv4 bool
+	switch fields[1] {
+	case "TCP4":
+		wantIPv4 = true
+	case "TCP6":
+		wantIPv4 = false
+	default:
+		return nil, fmt.Errorf("%w: unsupported v1 protocol %q", ErrInvalidProxyHeader, fields[1])
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if srcIP == nil || dstIP == nil || (srcIP.To4() != nil) != wantIPv4 || (dstIP.To4() != nil) != wantIPv4 {
+		return nil, fmt.Errorf("%w: invalid v1 addresses", ErrInvalidProxyHeader)
+	}
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%w: invalid v1 ports", ErrInvalidProxyHeader)
+	}
+
+	return &ProxyHeader{
+		Version:         1,
+		Network:         "tcp",
+		SourceAddr:      &net.TCPAddr{IP: srcIP, Port: int(srcPort)},
+		DestinationAddr: &net.TCPAddr{IP: dstIP, Port: int(dstPort)},
+	}, nil
+}
+
+// readProxyHeaderV2 parses a binary header.
+func readProxyHeaderV2(r *bufio.Reader) (*ProxyHeader, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProxyHeader, err)
+	}
+
+	verCmd, famProto := fixed[12], fixed[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidProxyHeader, verCmd>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProxyHeader, err)
+	}
+
+	header := &ProxyHeader{Version: 2}
+	switch verCmd & 0x0f {
+	case 0x00: // LOCAL
+		header.Local = true
+	case 0x01: // PROXY
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", ErrInvalidProxyHeader, verCmd&0x0f)
+	}
+
+	addrLen := 0
+	switch famProto >> 4 {
+	case 0x0: // AF_UNSPEC
+		header.Local = true
+	case 0x1: // AF_INET
+		addrLen = 12
+	case 0x2: // AF_INET6
+		addrLen = 36
+	case 0x3: // AF_UNIX
+		addrLen = 216
+	default:
+		return nil, fmt.Errorf("%w: unsupported address family %d", ErrInvalidProxyHeader, famProto>>4)
+	}
+	if len(payload) < addrLen {
+		return nil, fmt.Errorf("%w: address block too short", ErrInvalidProxyHeader)
+	}
+
+	if !header.Local {
+		if err := parseProxyV2Addresses(header, famProto, payload[:addrLen]); err != nil {
+			return nil, err
+		}
+	}
+
+	tlvs, err := parseProxyV2TLVs(payload[addrLen:])
+	if err != nil {
+		return nil, err
+	}
+	header.TLVs = tlvs
+
+	if checksum, ok := header.TLV(ProxyTLVTypeCRC32C); ok {
+		if err := verifyProxyV2Checksum(fixed, payload, addrLen, checksum); err != nil {
+			return nil, err
+		}
+	}
+
+	return header, nil
+}
+
+// parseProxyV2Addresses fills in the source and destination addresses.
+func parseProxyV2Addresses(header *ProxyHeader, famProto byte, block []byte) error {
+	switch famProto & 0x0f {
+	case 0x1:
+		header.Network = "tcp"
+	case 0x2:
+		header.Network = "udp"
+	default:
+		if famProto>>4 != 0x3 {
+			return fmt.Errorf("%w: unsupported transport %d", ErrInvalidProxyHeader, famProto&0x0f)
+		}
+	}
+
+	var srcIP, dstIP net.IP
+	var ports []byte
+	switch famProto >> 4 {
+	case 0x1:
+		srcIP, dstIP, ports = net.IP(block[0:4]), net.IP(block[4:8]), block[8:12]
+	case 0x2:
+		srcIP, dstIP, ports = net.IP(block[0:16]), net.IP(block[16:32]), block[32:36]
+	case 0x3:
+		header.Network = "unix"
+		header.SourceAddr = &net.UnixAddr{Name: cString(block[0:108]), Net: "unix"}
+		header.DestinationAddr = &net.UnixAddr{Name: cString(block[108:216]), Net: "unix"}
+		return nil
+	}
+
+	srcPort := int(binary.BigEndian.Uint16(ports[0:2]))
+	dstPort := int(binary.BigEndian.Uint16(ports[2:4]))
+	srcIP = append(net.IP(nil), srcIP...)
+	dstIP = append(net.IP(nil), dstIP...)
+
+	if header.Network == "udp" {
+		header.SourceAddr = &net.UDPAddr{IP: srcIP, Port: srcPort}
+		header.DestinationAddr = &net.UDPAddr{IP: dstIP, Port: dstPort}
+		return nil
+	}
+	header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	header.DestinationAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return nil
+}
+
+// parseProxyV2TLVs parses the TLV vector following the address block.
+func parseProxyV2TLVs(data []byte) ([]ProxyTLV, error) {
+	var tlvs []ProxyTLV
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("%w: truncated TLV", ErrInvalidProxyHeader)
+		}
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+length {
+			return nil, fmt.Errorf("%w: truncated TLV value", ErrInvalidProxyHeader)
+		}
+		tlvs = append(tlvs, ProxyTLV{
+			Type:  data[0],
+			Value: append([]byte(nil), data[3:3+length]...),
+		})
+		data = data[3+length:]
+	}
+	return tlvs, nil
+}
+
+// verifyProxyV2Checksum checks the CRC32C TLV, which is computed over the
+// whole header with the checksum value itself set to zero.
+func verifyProxyV2Checksum(fixed, payload []byte, addrLen int, checksum []byte) error {
+	if len(checksum) != 4 {
+		return fmt.Errorf("%w: invalid CRC32C length", ErrInvalidProxyHeader)
+	}
+
+	// Locate the checksum TLV value within the payload and zero it
+	zeroed := append([]byte(nil), payload...)
+	for i := addrLen; i+3 <= len(zeroed); {
+		length := int(binary.BigEndian.Uint16(zeroed[i+1 : i+3]))
+		if zeroed[i] == ProxyTLVTypeCRC32C {
+			copy(zeroed[i+3:i+3+length], make([]byte, length))
+			break
+		}
+		i += 3 + length
+	}
+
+	table := crc32.MakeTable(crc32.Castagnoli)
+	sum := crc32.Update(crc32.Checksum(fixed, table), table, zeroed)
+	if sum != binary.BigEndian.Uint32(checksum) {
+		return fmt.Errorf("%w: CRC32C mismatch", ErrInvalidProxyHeader)
+	}
+	return nil
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+// ignoreEOF turns io.EOF into nil, since a short stream simply means no
+// PROXY header was sent.
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,268 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildProxyV2 builds a v2 PROXY header for TCP over IPv4 with optional TLVs.
+func buildProxyV2(src, dst net.IP, srcPort, dstPort uint16, tlvs []ProxyTLV, withCRC bool) []byte {
+	payload := []byte{}
+	payload = append(payload, src.To4()...)
+	payload = append(payload, dst.To4()...)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	payload = binary.BigEndian.AppendUint16(payload, dstPort)
+	for _, tlv := range tlvs {
+		payload = append(payload, tlv.Type)
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+	crcOffset := -1
+	if withCRC {
+		payload = append(payload, ProxyTLVTypeCRC32C, 0, 4)
+		crcOffset = len(payload)
+		payload = append(payload, 0, 0, 0, 0)
+	}
+
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x21, 0x11)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	header = append(header, payload...)
+
+	if withCRC {
+		sum := crc32.Checksum(header, crc32.MakeTable(crc32.Castagnoli))
+		binary.BigEndian.PutUint32(header[16+crcOffset:], sum)
+	}
+	return header
+}
+
+func TestReadProxyHeader_V1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n"))
+	header, err := ReadProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 1 || header.SourceAddr.String() != "192.0.2.1:56324" || header.DestinationAddr.String() != "198.51.100.1:443" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("unexpected remaining data %q", rest)
+	}
+}
+
+func TestReadProxyHeader_V1TCP6(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 1000 443\r\n"))
+	header, err := ReadProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.SourceAddr.String() != "[2001:db8::1]:1000" {
+		t.Fatalf("unexpected source %s", header.SourceAddr)
+	}
+}
+
+func TestReadProxyHeader_V1Unknown(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))
+	header, err := ReadProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Local || header.SourceAddr != nil {
+		t.Fatalf("expected local header, got %+v", header)
+	}
+}
+
+func TestReadProxyHeader_V1Invalid(t *testing.T) {
+	inputs := []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.1 1 2\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 70000 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 1 443\n",
+		"PROXY " + strings.Repeat("x", 200) + "\r\n",
+	}
+	for _, input := range inputs {
+		_, err := ReadProxyHeader(bufio.NewReader(strings.NewReader(input)))
+		if !errors.Is(err, ErrInvalidProxyHeader) {
+			t.Errorf("expected ErrInvalidProxyHeader for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestReadProxyHeader_V2WithTLVs(t *testing.T) {
+	raw := buildProxyV2(net.ParseIP("203.0.113.7"), net.ParseIP("10.0.0.1"), 4000, 80, []ProxyTLV{
+		{Type: ProxyTLVTypeAuthority, Value: []byte("example.com")},
+		{Type: ProxyTLVTypeAWS, Value: []byte{0x01, 'v', 'p', 'c', 'e'}},
+	}, true)
+	r := bufio.NewReader(io.MultiReader(bytes.NewReader(raw), strings.NewReader("payload")))
+
+	header, err := ReadProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 2 || header.Network != "tcp" || header.SourceAddr.String() != "203.0.113.7:4000" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+	if v, ok := header.TLV(ProxyTLVTypeAuthority); !ok || string(v) != "example.com" {
+		t.Fatalf("expected authority TLV, got %q", v)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "payload" {
+		t.Fatalf("unexpected remaining data %q", rest)
+	}
+}
+
+func TestReadProxyHeader_V2BadChecksum(t *testing.T) {
+	raw := buildProxyV2(net.ParseIP("203.0.113.7"), net.ParseIP("10.0.0.1"), 4000, 80, nil, true)
+	raw[len(raw)-1] ^= 0xff
+	_, err := ReadProxyHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if !errors.Is(err, ErrInvalidProxyHeader) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+func TestReadProxyHeader_V2Local(t *testing.T) {
+	raw := append([]byte{}, proxyV2Signature...)
+	raw = append(raw, 0x20, 0x00, 0x00, 0x00)
+	header, err := ReadProxyHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Local {
+		t.Fatalf("expected local header, got %+v", header)
+	}
+}
+
+func TestReadProxyHeader_NoHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("POST / HTTP/1.1\r\n"))
+	header, err := ReadProxyHeader(r)
+	if err != nil || header != nil {
+		t.Fatalf("expected no header, got %+v, %v", header, err)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "POST / HTTP/1.1\r\n" {
+		t.Fatalf("expected data to be untouched, got %q", rest)
+	}
+}
+
+func TestProxyProtocolListener_GetIP(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	ln := NewProxyProtocolListener(inner, ProxyProtocolOptions{TrustedSources: []string{"127.0.0.1"}})
+	defer ln.Close()
+
+	ips := make(chan string, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ips <- GetIP(r)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "PROXY TCP4 198.51.100.9 127.0.0.1 5555 80\r\nGET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if ip := <-ips; ip != "198.51.100.9" {
+		t.Fatalf("expected 198.51.100.9, got %q", ip)
+	}
+}
+
+func TestProxyProtocolListener_UntrustedPassthrough(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+	}{
+		{"other network", []string{"10.0.0.0/8"}},
+		{"no trusted sources", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Skipf("cannot listen: %v", err)
+			}
+			ln := NewProxyProtocolListener(inner, ProxyProtocolOptions{TrustedSources: tt.trusted})
+			defer ln.Close()
+
+			go func() {
+				conn, err := net.Dial("tcp", inner.Addr().String())
+				if err != nil {
+					return
+				}
+				io.WriteString(conn, "PROXY TCP4 198.51.100.9 127.0.0.1 5555 80\r\n")
+				conn.Close()
+			}()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, ok := conn.(*ProxyProtocolConn); ok {
+				t.Fatal("expected untrusted connection not to be wrapped")
+			}
+			data, _ := io.ReadAll(conn)
+			if !strings.HasPrefix(string(data), "PROXY TCP4") {
+				t.Fatalf("expected raw data, got %q", data)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolConn_RequireHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := &ProxyProtocolConn{Conn: server, opts: ProxyProtocolOptions{RequireHeader: true}}
+
+	go func() {
+		io.WriteString(client, "GET / HTTP/1.1\r\n")
+	}()
+
+	if _, err := conn.Read(make([]byte, 10)); !errors.Is(err, ErrMissingProxyHeader) {
+		t.Fatalf("expected ErrMissingProxyHeader, got %v", err)
+	}
+}
+
+func TestProxyProtocolConn_KeepsReadDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := &ProxyProtocolConn{Conn: server}
+
+	// Set before the header is read, as http.Server does for ReadHeaderTimeout
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	go io.WriteString(client, "PROXY TCP4 198.51.100.9 127.0.0.1 5555 80\r\n")
+	if addr := conn.RemoteAddr().String(); addr != "198.51.100.9:5555" {
+		t.Fatalf("expected PROXY source address, got %q", addr)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected the caller's deadline to apply, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read deadline was cleared after reading the header")
+	}
+}
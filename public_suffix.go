@@ -0,0 +1,196 @@
+package req
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// publicSuffixListData is a snapshot of https://publicsuffix.org/list/public_suffix_list.dat
+//
+//go:embed public_suffix_list.dat
+var publicSuffixListData string
+
+var (
+	defaultPublicSuffixList     atomic.Pointer[PublicSuffixList]
+	defaultPublicSuffixListOnce sync.Once
+)
+
+// PublicSuffixList holds the rules of a Public Suffix List
+// (https://publicsuffix.org), used to find the registrable part of a host
+// name such as "example.co.uk". A list is immutable and safe for
+// concurrent use.
+type PublicSuffixList struct {
+	exact     map[string]bool // "co.uk"
+	wildcard  map[string]bool // "*.ck" is stored as "ck"
+	exception map[string]bool // "!www.ck" is stored as "www.ck"
+}
+
+// ParsePublicSuffixList parses a list in the publicsuffix.org format: one
+// rule per line, "//" comments, "*." wildcard and "!" exception rules.
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	l := &PublicSuffixList{
+		exact:     map[string]bool{},
+		wildcard:  map[string]bool{},
+		exception: map[string]bool{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Rules end at the first whitespace
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := fields[0]
+
+		// Rules are stored in their ASCII form, see canonicalDomain
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			l.exception[canonicalDomain(rule[1:])] = true
+		case strings.HasPrefix(rule, "*."):
+			l.wildcard[canonicalDomain(rule[2:])] = true
+		default:
+			l.exact[canonicalDomain(rule)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadPublicSuffixList reads a list from a local file, e.g. an updated
+// copy of public_suffix_list.dat.
+func LoadPublicSuffixList(path string) (*PublicSuffixList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePublicSuffixList(f)
+}
+
+// DefaultPublicSuffixList returns the list used by the package level
+// functions: the embedded snapshot, unless replaced with SetPublicSuffixList.
+func DefaultPublicSuffixList() *PublicSuffixList {
+	defaultPublicSuffixListOnce.Do(func() {
+		if defaultPublicSuffixList.Load() != nil {
+			return
+		}
+		l, _ := ParsePublicSuffixList(strings.NewReader(publicSuffixListData))
+		defaultPublicSuffixList.CompareAndSwap(nil, l)
+	})
+	return defaultPublicSuffixList.Load()
+}
+
+// SetPublicSuffixList replaces the list used by the package level functions.
+//
+// Example:
+//
+//	psl, err := req.LoadPublicSuffixList("/var/lib/psl/public_suffix_list.dat")
+//	if err == nil {
+//	    req.SetPublicSuffixList(psl)
+//	}
+func SetPublicSuffixList(l *PublicSuffixList) {
+	if l == nil {
+		return
+	}
+	defaultPublicSuffixList.Store(l)
+}
+
+// PublicSuffix returns the effective TLD of domain, e.g. "co.uk" for
+// "www.example.co.uk". Unknown TLDs are treated as public suffixes
+// (the implicit "*" rule). Internationalized domains may be given in
+// Unicode or punycode form; results are in punycode form.
+func (l *PublicSuffixList) PublicSuffix(domain string) string {
+	labels := domainLabels(domain)
+	if len(labels) == 0 {
+		return ""
+	}
+
+	// Exception rules prevail; the suffix is the rule minus its leftmost label
+	for i := range labels {
+		if l.exception[strings.Join(labels[i:], ".")] {
+			return strings.Join(labels[i+1:], ".")
+		}
+	}
+
+	// Otherwise the longest matching rule wins
+	for i := range labels {
+		if l.exact[strings.Join(labels[i:], ".")] {
+			return strings.Join(labels[i:], ".")
+		}
+		if i+1 < len(labels) && l.wildcard[strings.Join(labels[i+1:], ".")] {
+			return strings.Join(labels[i:], ".")
+		}
+	}
+
+	return labels[len(labels)-1]
+}
+
+// RegistrableDomain returns the public suffix plus one label, e.g.
+// "example.co.uk" for "www.example.co.uk", or an empty string if domain is
+// itself a public suffix.
+func (l *PublicSuffixList) RegistrableDomain(domain string) string {
+	labels := domainLabels(domain)
+	suffix := l.PublicSuffix(domain)
+	suffixLabels := strings.Count(suffix, ".") + 1
+	if suffix == "" || len(labels) <= suffixLabels {
+		return ""
+	}
+	return strings.Join(labels[len(labels)-suffixLabels-1:], ".")
+}
+
+// SubdomainLabels returns the labels in front of the registrable domain,
+// e.g. ["a", "b"] for "a.b.example.co.uk".
+func (l *PublicSuffixList) SubdomainLabels(domain string) []string {
+	registrable := l.RegistrableDomain(domain)
+	if registrable == "" {
+		return nil
+	}
+	labels := domainLabels(domain)
+	n := len(labels) - (strings.Count(registrable, ".") + 1)
+	if n <= 0 {
+		return nil
+	}
+	return labels[:n]
+}
+
+// EffectiveTLD returns the public suffix of host using the default list,
+// e.g. "co.uk" for "www.example.co.uk".
+func EffectiveTLD(host string) string {
+	return DefaultPublicSuffixList().PublicSuffix(host)
+}
+
+// RegistrableDomain returns the registrable domain (eTLD+1) of host using
+// the default list, e.g. "example.co.uk" for "www.example.co.uk".
+func RegistrableDomain(host string) string {
+	return DefaultPublicSuffixList().RegistrableDomain(host)
+}
+
+// SubdomainLabels returns the labels of host in front of its registrable
+// domain using the default list, e.g. ["a", "b"] for "a.b.example.com".
+func SubdomainLabels(host string) []string {
+	return DefaultPublicSuffixList().SubdomainLabels(host)
+}
+
+// domainLabels splits a domain into lowercase ASCII labels, ignoring a
+// trailing dot. It returns nil for empty domains or domains with empty labels.
+func domainLabels(domain string) []string {
+	domain = canonicalDomain(domain)
+	if domain == "" {
+		return nil
+	}
+	labels := strings.Split(domain, ".")
+	for _, label := range labels {
+		if label == "" {
+			return nil
+		}
+	}
+	return labels
+}
@@ -0,0 +1,108 @@
+package req
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPublicSuffixList(t *testing.T) {
+	list, err := ParsePublicSuffixList(strings.NewReader(`
+// comment
+com
+uk
+co.uk
+*.ck
+!www.ck
+jp
+*.kobe.jp
+!city.kobe.jp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain      string
+		suffix      string
+		registrable string
+		labels      []string
+	}{
+		{domain: "example.com", suffix: "com", registrable: "example.com"},
+		{domain: "a.b.example.com", suffix: "com", registrable: "example.com", labels: []string{"a", "b"}},
+		{domain: "WWW.Example.CO.UK.", suffix: "co.uk", registrable: "example.co.uk", labels: []string{"www"}},
+		{domain: "co.uk", suffix: "co.uk", registrable: ""},
+		{domain: "example.uk", suffix: "uk", registrable: "example.uk"},
+		{domain: "foo.ck", suffix: "foo.ck", registrable: ""},
+		{domain: "bar.foo.ck", suffix: "foo.ck", registrable: "bar.foo.ck"},
+		{domain: "www.ck", suffix: "ck", registrable: "www.ck"},
+		{domain: "a.www.ck", suffix: "ck", registrable: "www.ck", labels: []string{"a"}},
+		{domain: "shop.city.kobe.jp", suffix: "kobe.jp", registrable: "city.kobe.jp", labels: []string{"shop"}},
+		{domain: "example.unknown", suffix: "unknown", registrable: "example.unknown"},
+		{domain: "localhost", suffix: "localhost", registrable: ""},
+		{domain: "", suffix: "", registrable: ""},
+		{domain: "a..com", suffix: "", registrable: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := list.PublicSuffix(tt.domain); got != tt.suffix {
+				t.Errorf("PublicSuffix() = %q, want %q", got, tt.suffix)
+			}
+			if got := list.RegistrableDomain(tt.domain); got != tt.registrable {
+				t.Errorf("RegistrableDomain() = %q, want %q", got, tt.registrable)
+			}
+			if got := list.SubdomainLabels(tt.domain); !reflect.DeepEqual(got, tt.labels) {
+				t.Errorf("SubdomainLabels() = %q, want %q", got, tt.labels)
+			}
+		})
+	}
+}
+
+func TestEmbeddedPublicSuffixList(t *testing.T) {
+	tests := []struct {
+		host        string
+		etld        string
+		registrable string
+	}{
+		{host: "www.example.co.uk", etld: "co.uk", registrable: "example.co.uk"},
+		{host: "a.b.example.com", etld: "com", registrable: "example.com"},
+		{host: "user.github.io", etld: "github.io", registrable: "user.github.io"},
+		{host: "www.ck", etld: "ck", registrable: "www.ck"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := EffectiveTLD(tt.host); got != tt.etld {
+				t.Errorf("EffectiveTLD() = %q, want %q", got, tt.etld)
+			}
+			if got := RegistrableDomain(tt.host); got != tt.registrable {
+				t.Errorf("RegistrableDomain() = %q, want %q", got, tt.registrable)
+			}
+		})
+	}
+}
+
+func TestLoadPublicSuffixList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "psl.dat")
+	writeFile(t, path, "com\nexample.com\n")
+
+	list, err := LoadPublicSuffixList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := DefaultPublicSuffixList()
+	SetPublicSuffixList(list)
+	defer SetPublicSuffixList(original)
+
+	if got := RegistrableDomain("app.example.com"); got != "app.example.com" {
+		t.Errorf("RegistrableDomain() = %q, want %q", got, "app.example.com")
+	}
+
+	if _, err := LoadPublicSuffixList(filepath.Join(t.TempDir(), "missing.dat")); !os.IsNotExist(err) {
+		t.Errorf("LoadPublicSuffixList() error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,359 @@
+package req
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm selects how MemoryRateLimitStore counts requests.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests and refills
+	// Limit tokens evenly over each Window.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow approximates a rolling window by weighting the previous
+	// fixed window's count against the current one.
+	SlidingWindow
+)
+
+// ErrInvalidRateLimit is returned by MemoryRateLimitStore.Take for a
+// non-positive limit or window.
+var ErrInvalidRateLimit = errors.New("req: rate limit and window must be positive")
+
+// DefaultRateLimitMaxKeys is the number of keys MemoryRateLimitStore keeps
+// when MaxKeys is not set.
+const DefaultRateLimitMaxKeys = 10000
+
+// Defaults applied by NewRateLimiter when Limit or Window is not positive.
+const (
+	DefaultRateLimit       = 60
+	DefaultRateLimitWindow = time.Minute
+)
+
+// DefaultRateLimitIPv6Bits is the prefix length IPv6 clients are grouped
+// by when AggregateIPv6Bits is not set. A single host is usually given a
+// whole /64, so limiting individual addresses is easily bypassed.
+const DefaultRateLimitIPv6Bits = 64
+
+// RateLimitResult is the outcome of consuming one request for a key.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // time until the quota is fully restored
+	RetryAfter time.Duration // time until the next request is allowed, zero if allowed
+}
+
+// RateLimitStore keeps rate limiting state. Implement it to plug in a
+// shared backend; it must be safe for concurrent use.
+type RateLimitStore interface {
+	// Take consumes one request for key under a limit of limit requests per window.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStoreOptions configures NewMemoryRateLimitStore.
+type MemoryRateLimitStoreOptions struct {
+	Algorithm RateLimitAlgorithm
+	// MaxKeys bounds memory use; the least recently used key is evicted
+	// first. Zero means DefaultRateLimitMaxKeys. Keys idle long enough for
+	// their quota to be fully restored are dropped before that.
+	MaxKeys int
+	// Now returns the current time; nil means time.Now
+	Now func() time.Time
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore with bounded memory.
+type MemoryRateLimitStore struct {
+	opts    MemoryRateLimitStoreOptions
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+}
+
+// rateLimitEntry is the state of one key.
+type rateLimitEntry struct {
+	key     string
+	expires time.Time // when the entry is back to its initial state
+
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	windowStart time.Time
+	previous    int
+	current     int
+}
+
+// NewMemoryRateLimitStore creates an in-memory store.
+func NewMemoryRateLimitStore(opts MemoryRateLimitStoreOptions) *MemoryRateLimitStore {
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = DefaultRateLimitMaxKeys
+	}
+	return &MemoryRateLimitStore{
+		opts:    opts,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Take implements RateLimitStore. It returns ErrInvalidRateLimit for a
+// non-positive limit or window.
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	if limit <= 0 || window <= 0 {
+		return RateLimitResult{}, ErrInvalidRateLimit
+	}
+	now := time.Now()
+	if s.opts.Now != nil {
+		now = s.opts.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entry(key, limit, now)
+	if s.opts.Algorithm == SlidingWindow {
+		// The previous window's count weighs in for one more window
+		entry.expires = now.Truncate(window).Add(2 * window)
+		return takeSlidingWindow(entry, limit, window, now), nil
+	}
+	entry.expires = now.Add(window)
+	return takeTokenBucket(entry, limit, window, now), nil
+}
+
+// Len returns the number of tracked keys.
+func (s *MemoryRateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// entry returns the state for key, creating it and evicting expired keys
+// and then the least recently used key if needed.
+func (s *MemoryRateLimitStore) entry(key string, limit int, now time.Time) *rateLimitEntry {
+	if el, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(el)
+		return el.Value.(*rateLimitEntry)
+	}
+
+	for oldest := s.lru.Back(); oldest != nil; oldest = s.lru.Back() {
+		e := oldest.Value.(*rateLimitEntry)
+		if s.lru.Len() < s.opts.MaxKeys && now.Before(e.expires) {
+			break
+		}
+		s.lru.Remove(oldest)
+		delete(s.entries, e.key)
+	}
+
+	entry := &rateLimitEntry{key: key, tokens: float64(limit), last: now}
+	s.entries[key] = s.lru.PushFront(entry)
+	return entry
+}
+
+// takeTokenBucket consumes a token from a bucket holding up to limit tokens
+// that refills at limit tokens per window.
+func takeTokenBucket(e *rateLimitEntry, limit int, window time.Duration, now time.Time) RateLimitResult {
+	rate := float64(limit) / window.Seconds() // tokens per second
+
+	if elapsed := now.Sub(e.last).Seconds(); elapsed > 0 {
+		e.tokens = math.Min(float64(limit), e.tokens+elapsed*rate)
+	}
+	e.last = now
+
+	result := RateLimitResult{Limit: limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - e.tokens) / rate)
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = secondsToDuration((float64(limit) - e.tokens) / rate)
+	return result
+}
+
+// takeSlidingWindow counts a request using the sliding window counter
+// approximation: estimate = previous * (1 - elapsed/window) + current.
+func takeSlidingWindow(e *rateLimitEntry, limit int, window time.Duration, now time.Time) RateLimitResult {
+	start := now.Truncate(window)
+	switch {
+	case e.windowStart.IsZero() || start.Sub(e.windowStart) > window:
+		e.previous, e.current = 0, 0
+	case start.Sub(e.windowStart) == window:
+		e.previous, e.current = e.current, 0
+	}
+	e.windowStart = start
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(e.previous)*weight + float64(e.current)
+
+	result := RateLimitResult{Limit: limit, Reset: window - elapsed}
+	if estimate+1 <= float64(limit) {
+		e.current++
+		result.Allowed = true
+		result.Remaining = int(math.Max(0, math.Floor(float64(limit)-estimate-1)))
+		return result
+	}
+
+	// Wait until the previous window's weight has decayed enough. If the
+	// current window alone is full, wait for its own weight to decay once
+	// it has become the previous window.
+	var retry time.Duration
+	if e.current+1 <= limit {
+		needed := 1 - float64(limit-1-e.current)/float64(e.previous)
+		retry = time.Duration(needed*float64(window)) - elapsed
+	} else {
+		needed := 1 - float64(limit-1)/float64(e.current)
+		retry = window - elapsed + time.Duration(needed*float64(window))
+	}
+	result.RetryAfter = max(retry, time.Second)
+	return result
+}
+
+// RateLimitOptions configures NewRateLimiter.
+type RateLimitOptions struct {
+	// Limit is the number of requests allowed per Window; zero means
+	// DefaultRateLimit.
+	Limit int
+	// Window is the period Limit applies to; zero means DefaultRateLimitWindow.
+	Window time.Duration
+	// IPOptions controls how the client IP is resolved (see
+	// GetIPCandidateWithOptions).
+	IPOptions IPOptions
+	// AggregateIPv4Bits groups IPv4 clients by network, e.g. 24 to limit
+	// whole /24 networks. Zero keeps full addresses.
+	AggregateIPv4Bits int
+	// AggregateIPv6Bits groups IPv6 clients by network. Zero means
+	// DefaultRateLimitIPv6Bits; use 128 to keep full addresses.
+	AggregateIPv6Bits int
+	// KeyFunc overrides the client IP as the key, e.g. to limit by API key.
+	// Returning an empty key falls back to the client IP.
+	KeyFunc func(r *http.Request) string
+	// Store keeps the counters; nil means an in-memory token bucket store.
+	Store RateLimitStore
+	// ExceededHandler responds to limited requests; nil means 429 Too Many Requests.
+	ExceededHandler http.Handler
+	// Logger receives store errors, in which case requests are let through;
+	// nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// RateLimiter limits requests per client.
+type RateLimiter struct {
+	opts RateLimitOptions
+}
+
+// NewRateLimiter creates a rate limiter. A Limit or Window that is not
+// positive is replaced by DefaultRateLimit or DefaultRateLimitWindow.
+func NewRateLimiter(opts RateLimitOptions) *RateLimiter {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultRateLimit
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultRateLimitWindow
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore(MemoryRateLimitStoreOptions{})
+	}
+	return &RateLimiter{opts: opts}
+}
+
+// RateLimitMiddleware returns middleware enforcing the configured limit. It
+// sets the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers on every response and Retry-After on limited ones.
+//
+// Example:
+//
+//	mw := req.RateLimitMiddleware(req.RateLimitOptions{
+//	    Limit:             100,
+//	    Window:            time.Minute,
+//	    AggregateIPv4Bits: 24,
+//	})
+//	http.ListenAndServe(":8080", mw(handler))
+func RateLimitMiddleware(opts RateLimitOptions) func(http.Handler) http.Handler {
+	return NewRateLimiter(opts).Middleware
+}
+
+// Key returns the rate limiting key of a request.
+func (l *RateLimiter) Key(r *http.Request) string {
+	if l.opts.KeyFunc != nil {
+		if key := l.opts.KeyFunc(r); key != "" {
+			return key
+		}
+	}
+
+	ip := GetIPCandidateWithOptions(r, l.opts.IPOptions).Value()
+	v4Bits, v6Bits := l.opts.AggregateIPv4Bits, l.opts.AggregateIPv6Bits
+	if v4Bits <= 0 {
+		v4Bits = 32
+	}
+	if v6Bits <= 0 {
+		v6Bits = DefaultRateLimitIPv6Bits
+	}
+	if network := AnonymizeIP(ip, v4Bits, v6Bits); network != "" {
+		return network
+	}
+	return ip
+}
+
+// Allow consumes one request for the request's key.
+func (l *RateLimiter) Allow(r *http.Request) (RateLimitResult, error) {
+	return l.opts.Store.Take(r.Context(), l.Key(r), l.opts.Limit, l.opts.Window)
+}
+
+// Middleware wraps next with the rate limiter.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := l.Allow(r)
+		if err != nil {
+			l.logger().Error("req: rate limit store failed", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+		h.Set("RateLimit-Policy", strconv.Itoa(l.opts.Limit)+";w="+strconv.FormatInt(ceilSeconds(l.opts.Window), 10))
+
+		if result.Allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Retry-After", strconv.FormatInt(max(ceilSeconds(result.RetryAfter), 1), 10))
+		if l.opts.ExceededHandler != nil {
+			l.opts.ExceededHandler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
+
+// logger returns the configured logger.
+func (l *RateLimiter) logger() *slog.Logger {
+	if l.opts.Logger != nil {
+		return l.opts.Logger
+	}
+	return slog.Default()
+}
+
+// secondsToDuration converts fractional seconds to a duration.
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
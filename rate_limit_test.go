@@ -0,0 +1,231 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestMemoryRateLimitStore_TokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryRateLimitStore(MemoryRateLimitStoreOptions{Now: clock.Now})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		res, _ := store.Take(ctx, "k", 3, time.Minute)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: unexpected result %+v", i, res)
+		}
+	}
+	res, _ := store.Take(ctx, "k", 3, time.Minute)
+	if res.Allowed || res.RetryAfter != 20*time.Second {
+		t.Fatalf("expected limit with 20s retry, got %+v", res)
+	}
+
+	clock.now = clock.now.Add(20 * time.Second)
+	if res, _ := store.Take(ctx, "k", 3, time.Minute); !res.Allowed {
+		t.Fatalf("expected a refilled token, got %+v", res)
+	}
+}
+
+func TestRateLimit_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		window     time.Duration
+		wantPolicy string
+	}{
+		{"zero window", 10, 0, "10;w=60"},
+		{"negative window", 10, -time.Second, "10;w=60"},
+		{"zero limit", 0, time.Second, "60;w=1"},
+		{"negative limit", -1, time.Second, "60;w=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, algorithm := range []RateLimitAlgorithm{TokenBucket, SlidingWindow} {
+				store := NewMemoryRateLimitStore(MemoryRateLimitStoreOptions{Algorithm: algorithm})
+				if _, err := store.Take(context.Background(), "k", tt.limit, tt.window); !errors.Is(err, ErrInvalidRateLimit) {
+					t.Errorf("Take() error = %v, want ErrInvalidRateLimit", err)
+				}
+			}
+
+			handler := RateLimitMiddleware(RateLimitOptions{Limit: tt.limit, Window: tt.window})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if got := w.Header().Get("RateLimit-Policy"); w.Code != http.StatusOK || got != tt.wantPolicy {
+				t.Errorf("status = %d, RateLimit-Policy = %q, want 200, %q", w.Code, got, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStore_SlidingWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryRateLimitStore(MemoryRateLimitStoreOptions{Algorithm: SlidingWindow, Now: clock.Now})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if res, _ := store.Take(ctx, "k", 4, time.Minute); !res.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v", i, res)
+		}
+	}
+	res, _ := store.Take(ctx, "k", 4, time.Minute)
+	if res.Allowed || res.RetryAfter <= 0 {
+		t.Fatalf("expected limit, got %+v", res)
+	}
+
+	// Halfway through the next window, the previous 4 requests weigh 2
+	clock.now = clock.now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if res, _ := store.Take(ctx, "k", 4, time.Minute); !res.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v", i, res)
+		}
+	}
+	if res, _ := store.Take(ctx, "k", 4, time.Minute); res.Allowed {
+		t.Fatalf("expected limit, got %+v", res)
+	}
+
+	// After two idle windows the counters are reset
+	clock.now = clock.now.Add(3 * time.Minute)
+	if res, _ := store.Take(ctx, "k", 4, time.Minute); !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("expected reset counters, got %+v", res)
+	}
+}
+
+func TestMemoryRateLimitStore_Eviction(t *testing.T) {
+	store := NewMemoryRateLimitStore(MemoryRateLimitStoreOptions{MaxKeys: 2})
+	ctx := context.Background()
+
+	store.Take(ctx, "a", 1, time.Minute)
+	store.Take(ctx, "b", 1, time.Minute)
+	store.Take(ctx, "c", 1, time.Minute)
+	if store.Len() != 2 {
+		t.Fatalf("expected 2 keys, got %d", store.Len())
+	}
+	// "a" was evicted, so it starts with a full quota again
+	if res, _ := store.Take(ctx, "a", 1, time.Minute); !res.Allowed {
+		t.Fatalf("expected evicted key to be reset, got %+v", res)
+	}
+}
+
+func TestMemoryRateLimitStore_IdleExpiry(t *testing.T) {
+	tests := []struct {
+		algorithm RateLimitAlgorithm
+		idle      time.Duration // until a key is back to its initial state
+	}{
+		{TokenBucket, time.Minute},
+		{SlidingWindow, 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+		store := NewMemoryRateLimitStore(MemoryRateLimitStoreOptions{Algorithm: tt.algorithm, Now: clock.Now})
+		ctx := context.Background()
+
+		store.Take(ctx, "a", 1, time.Minute)
+		clock.now = clock.now.Add(tt.idle - time.Second)
+		store.Take(ctx, "b", 1, time.Minute)
+		clock.now = clock.now.Add(time.Second)
+		store.Take(ctx, "c", 1, time.Minute)
+		if store.Len() != 2 {
+			t.Errorf("algorithm %d: expected the idle key to expire, got %d keys", tt.algorithm, store.Len())
+		}
+	}
+}
+
+func TestRateLimitMiddleware_Headers(t *testing.T) {
+	handler := RateLimitMiddleware(RateLimitOptions{Limit: 2, Window: time.Minute})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	do := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "203.0.113.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do()
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("unexpected first response %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Fatalf("unexpected policy header %q", w.Header().Get("RateLimit-Policy"))
+	}
+	do()
+	w = do()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("unexpected limited headers %v", w.Header())
+	}
+}
+
+func TestRateLimiter_Key(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitOptions{Limit: 1, Window: time.Second, AggregateIPv4Bits: 24, AggregateIPv6Bits: 64})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.77:1234"
+	if key := limiter.Key(r); key != "203.0.113.0" {
+		t.Fatalf("expected /24 key, got %q", key)
+	}
+	r.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:443"
+	if key := limiter.Key(r); key != "2001:db8:1:2::" {
+		t.Fatalf("expected /64 key, got %q", key)
+	}
+
+	limiter = NewRateLimiter(RateLimitOptions{Limit: 1, Window: time.Second})
+	if key := limiter.Key(r); key != "2001:db8:1:2::" {
+		t.Fatalf("expected default /64 key, got %q", key)
+	}
+	r.RemoteAddr = "203.0.113.77:1234"
+	if key := limiter.Key(r); key != "203.0.113.77" {
+		t.Fatalf("expected full IPv4 key, got %q", key)
+	}
+	limiter = NewRateLimiter(RateLimitOptions{Limit: 1, Window: time.Second, AggregateIPv6Bits: 128})
+	r.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:443"
+	if key := limiter.Key(r); key != "2001:db8:1:2:3:4:5:6" {
+		t.Fatalf("expected full IPv6 key, got %q", key)
+	}
+
+	limiter = NewRateLimiter(RateLimitOptions{
+		Limit:   1,
+		Window:  time.Second,
+		KeyFunc: func(r *http.Request) string { return r.Header.Get("X-API-Key") },
+	})
+	r.Header.Set("X-API-Key", "key-1")
+	if key := limiter.Key(r); key != "key-1" {
+		t.Fatalf("expected custom key, got %q", key)
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, int, time.Duration) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("backend down")
+}
+
+func TestRateLimitMiddleware_StoreErrorFailsOpen(t *testing.T) {
+	called := false
+	handler := RateLimitMiddleware(RateLimitOptions{Limit: 1, Window: time.Second, Store: failingRateLimitStore{}, Logger: discardLogger()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }),
+	)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !called {
+		t.Fatal("expected request to be let through")
+	}
+}
@@ -0,0 +1,69 @@
+package req
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned when a request body exceeds the read limit.
+var ErrBodyTooLarge = errors.New("req: request body too large")
+
+// DefaultMaxBodySize is the read limit used when a limit is not positive.
+const DefaultMaxBodySize = 10 << 20
+
+// GetRawBody returns the raw request body without consuming it: the body
+// is replaced with a reader over the same bytes, so GetString, GetAll and
+// the handler can still read it.
+//
+// Business logic:
+// - a missing body is returned as an empty slice
+// - at most maxBytes are read; zero or negative means DefaultMaxBodySize
+// - a larger body returns ErrBodyTooLarge and is left readable in full
+// - if the form was already parsed, the body has been consumed and is empty
+//
+// Parameters:
+//   - r (*http.Request): The HTTP request
+//   - maxBytes (int64): The size limit
+//
+// Returns:
+//   - []byte: the body
+//   - error: ErrBodyTooLarge or a read error
+func GetRawBody(r *http.Request, maxBytes int64) ([]byte, error) {
+	if r == nil || r.Body == nil || r.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodySize
+	}
+
+	original := r.Body
+	data, err := io.ReadAll(io.LimitReader(original, maxBytes+1))
+	if err != nil {
+		r.Body = replayBody{Reader: io.MultiReader(bytes.NewReader(data), original), closer: original}
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		r.Body = replayBody{Reader: io.MultiReader(bytes.NewReader(data), original), closer: original}
+		return nil, ErrBodyTooLarge
+	}
+
+	r.Body = replayBody{Reader: bytes.NewReader(data), closer: original}
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, nil
+}
+
+// replayBody replays bytes already read from a body and closes the
+// original body.
+type replayBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+// Close closes the original body.
+func (b replayBody) Close() error {
+	return b.closer.Close()
+}
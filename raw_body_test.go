@@ -0,0 +1,49 @@
+package req
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetRawBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("name=alice&role=admin"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := GetRawBody(r, 0)
+	if err != nil || string(body) != "name=alice&role=admin" {
+		t.Fatalf("GetRawBody() = %q, %v", body, err)
+	}
+	again, err := GetRawBody(r, 0)
+	if err != nil || string(again) != string(body) {
+		t.Errorf("second GetRawBody() = %q, %v", again, err)
+	}
+	if got := GetString(r, "name"); got != "alice" {
+		t.Errorf("GetString(name) after GetRawBody = %q, want alice", got)
+	}
+}
+
+func TestGetRawBody_TooLarge(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("0123456789"))
+
+	if _, err := GetRawBody(r, 4); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("GetRawBody() error = %v, want ErrBodyTooLarge", err)
+	}
+	rest, _ := io.ReadAll(r.Body)
+	if string(rest) != "0123456789" {
+		t.Errorf("body after ErrBodyTooLarge = %q, want it intact", rest)
+	}
+}
+
+func TestGetRawBody_NoBody(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	body, err := GetRawBody(r, 0)
+	if err != nil || len(body) != 0 {
+		t.Errorf("GetRawBody() = %q, %v", body, err)
+	}
+	if body, err := GetRawBody(nil, 0); err != nil || len(body) != 0 {
+		t.Errorf("GetRawBody(nil) = %q, %v", body, err)
+	}
+}
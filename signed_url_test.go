@@ -0,0 +1,100 @@
+package req
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignURL(t *testing.T) {
+	key := []byte("current-secret")
+	expiry := time.Now().Add(time.Hour)
+
+	signed, err := SignURL("https://example.com/download?file=report.pdf&tag=a&tag=b", key, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	if u.Host != "example.com" || u.Path != "/download" || query.Get("file") != "report.pdf" {
+		t.Errorf("SignURL() = %q", signed)
+	}
+	if query.Get(SignedURLExpiresParam) == "" || query.Get(SignedURLSignatureParam) == "" {
+		t.Errorf("SignURL() = %q, want expires and signature", signed)
+	}
+
+	if _, err := SignURL("/x", nil, expiry); err == nil {
+		t.Error("SignURL() with an empty key succeeded")
+	}
+	if _, err := SignURL("/x?%zz", key, expiry); err == nil {
+		t.Error("SignURL() with an invalid query succeeded")
+	}
+}
+
+func TestVerifySignedURL(t *testing.T) {
+	current := []byte("current-secret")
+	previous := []byte("previous-secret")
+	now := time.Unix(1_700_000_000, 0)
+
+	sign := func(u string, key []byte, expiry time.Time) string {
+		t.Helper()
+		signed, err := SignURL(u, key, expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	valid := sign("/download?file=report.pdf&tag=a&tag=b", current, now.Add(time.Hour))
+	parsed, _ := url.Parse(valid)
+	query := parsed.Query()
+
+	reordered := "/download?signature=" + query.Get("signature") + "&tag=b&expires=" + query.Get("expires") + "&file=report.pdf&tag=a"
+	tampered := strings.Replace(valid, "report.pdf", "secrets.txt", 1)
+	extended := strings.Replace(valid, "expires="+query.Get("expires"), "expires=9999999999", 1)
+	added := valid + "&admin=1"
+
+	tests := []struct {
+		name string
+		url  string
+		keys [][]byte
+		want error
+	}{
+		{"valid", valid, [][]byte{current}, nil},
+		{"reordered query", reordered, [][]byte{current}, nil},
+		{"rotated key", sign("/confirm?user=42", previous, now.Add(time.Hour)), [][]byte{current, previous}, nil},
+		{"retired key", sign("/confirm?user=42", previous, now.Add(time.Hour)), [][]byte{current}, ErrSignedURLInvalid},
+		{"tampered value", tampered, [][]byte{current}, ErrSignedURLInvalid},
+		{"tampered expiry", extended, [][]byte{current}, ErrSignedURLInvalid},
+		{"added parameter", added, [][]byte{current}, ErrSignedURLInvalid},
+		{"other path", strings.Replace(valid, "/download", "/admin", 1), [][]byte{current}, ErrSignedURLInvalid},
+		{"expired", sign("/download?file=a", current, now.Add(-time.Minute)), [][]byte{current}, ErrSignedURLExpired},
+		{"expires now", sign("/download?file=a", current, now), [][]byte{current}, ErrSignedURLExpired},
+		{"escaped path", sign("/files/a%2Fb", current, now.Add(time.Hour)), [][]byte{current}, nil},
+		{"unescaped path", strings.Replace(sign("/files/a%2Fb", current, now.Add(time.Hour)), "%2F", "/", 1), [][]byte{current}, ErrSignedURLInvalid},
+		{"unsigned", "/download?file=report.pdf", [][]byte{current}, ErrSignedURLMissing},
+		{"duplicate signature", valid + "&signature=x", [][]byte{current}, ErrSignedURLInvalid},
+		{"bad signature encoding", "/download?expires=1&signature=***", [][]byte{current}, ErrSignedURLInvalid},
+		{"no keys", valid, nil, ErrSignedURLInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			err := VerifySignedURLWithOptions(r, SignedURLOptions{Keys: tt.keys, Now: func() time.Time { return now }})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("VerifySignedURLWithOptions() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", sign("/download", current, time.Now().Add(time.Hour)), nil)
+	if err := VerifySignedURL(r, current); err != nil {
+		t.Errorf("VerifySignedURL() error = %v", err)
+	}
+	if err := VerifySignedURL(nil, current); !errors.Is(err, ErrSignedURLMissing) {
+		t.Errorf("VerifySignedURL(nil) error = %v, want ErrSignedURLMissing", err)
+	}
+}
@@ -0,0 +1,336 @@
+package req
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errStructuredField is returned for malformed structured field values.
+var errStructuredField = errors.New("req: malformed structured field")
+
+// sfToken is a structured field token, as opposed to a string.
+type sfToken string
+
+// sfParam is a parameter of a structured field item or inner list.
+type sfParam struct {
+	name  string
+	value any // int64, string, sfToken, bool or []byte
+}
+
+// sfItem is a structured field item (RFC 8941 section 3.3).
+type sfItem struct {
+	value  any
+	params []sfParam
+}
+
+// sfMember is a dictionary member holding an item or an inner list.
+type sfMember struct {
+	name   string
+	item   sfItem   // the item, or the inner list parameters in item.params
+	list   []sfItem // the inner list items
+	isList bool
+}
+
+// param returns a parameter value by name.
+func (it sfItem) param(name string) (any, bool) {
+	for _, p := range it.params {
+		if p.name == name {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+// parseSFDictionary parses a structured field dictionary (RFC 8941
+// section 4.2.2). Later members with the same name replace earlier ones.
+func parseSFDictionary(s string) ([]sfMember, error) {
+	p := &sfParser{s: s}
+	p.skipSP()
+	var members []sfMember
+	for !p.done() {
+		name, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		m := sfMember{name: name, item: sfItem{value: true}}
+		if p.peek() == '=' {
+			p.i++
+			if p.peek() == '(' {
+				m.list, m.item.params, err = p.innerList()
+				m.isList = true
+			} else {
+				m.item, err = p.item()
+			}
+		} else {
+			m.item.params, err = p.params()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		replaced := false
+		for i := range members {
+			if members[i].name == name {
+				members[i], replaced = m, true
+			}
+		}
+		if !replaced {
+			members = append(members, m)
+		}
+
+		p.skipOWS()
+		if p.done() {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, errStructuredField
+		}
+		p.i++
+		p.skipOWS()
+		if p.done() {
+			return nil, errStructuredField
+		}
+	}
+	return members, nil
+}
+
+// serializeSFInnerList serializes an inner list with its parameters
+// (RFC 8941 section 4.1.1.1).
+func serializeSFInnerList(list []sfItem, params []sfParam) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, it := range list {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(serializeSFBareItem(it.value))
+		b.WriteString(serializeSFParams(it.params))
+	}
+	b.WriteByte(')')
+	b.WriteString(serializeSFParams(params))
+	return b.String()
+}
+
+// serializeSFParams serializes parameters.
+func serializeSFParams(params []sfParam) string {
+	var b strings.Builder
+	for _, p := range params {
+		b.WriteByte(';')
+		b.WriteString(p.name)
+		if v, ok := p.value.(bool); ok && v {
+			continue
+		}
+		b.WriteByte('=')
+		b.WriteString(serializeSFBareItem(p.value))
+	}
+	return b.String()
+}
+
+// serializeSFBareItem serializes a bare item.
+func serializeSFBareItem(v any) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case sfToken:
+		return string(v)
+	case bool:
+		if v {
+			return "?1"
+		}
+		return "?0"
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(v) + ":"
+	}
+	return ""
+}
+
+// sfParser is a cursor over a structured field value.
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) done() bool { return p.i >= len(p.s) }
+
+func (p *sfParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) skipSP() {
+	for p.peek() == ' ' {
+		p.i++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.i++
+	}
+}
+
+// key parses a dictionary or parameter key.
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	if c := p.peek(); !(c >= 'a' && c <= 'z' || c == '*') {
+		return "", errStructuredField
+	}
+	for !p.done() {
+		c := p.peek()
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("_-.*", c) >= 0) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+// innerList parses "(item item);params".
+func (p *sfParser) innerList() ([]sfItem, []sfParam, error) {
+	p.i++ // '('
+	var items []sfItem
+	for {
+		p.skipSP()
+		if p.done() {
+			return nil, nil, errStructuredField
+		}
+		if p.peek() == ')' {
+			p.i++
+			params, err := p.params()
+			return items, params, err
+		}
+		it, err := p.item()
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, it)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return nil, nil, errStructuredField
+		}
+	}
+}
+
+// item parses a bare item with parameters.
+func (p *sfParser) item() (sfItem, error) {
+	v, err := p.bareItem()
+	if err != nil {
+		return sfItem{}, err
+	}
+	params, err := p.params()
+	return sfItem{value: v, params: params}, err
+}
+
+// params parses ";key=value" parameters.
+func (p *sfParser) params() ([]sfParam, error) {
+	var params []sfParam
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+		name, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var value any = true
+		if p.peek() == '=' {
+			p.i++
+			if value, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params = deleteSFParam(params, name)
+		params = append(params, sfParam{name: name, value: value})
+	}
+	return params, nil
+}
+
+// deleteSFParam removes an earlier parameter of the same name.
+func deleteSFParam(params []sfParam, name string) []sfParam {
+	for i, p := range params {
+		if p.name == name {
+			return append(params[:i], params[i+1:]...)
+		}
+	}
+	return params
+}
+
+// bareItem parses an integer, string, token, byte sequence or boolean.
+// Decimals are not needed by this package and are rejected.
+func (p *sfParser) bareItem() (any, error) {
+	c := p.peek()
+	switch {
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.i
+		p.i++
+		for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+			p.i++
+		}
+		if p.peek() == '.' || p.i-start > 16 {
+			return nil, errStructuredField
+		}
+		n, err := strconv.ParseInt(p.s[start:p.i], 10, 64)
+		if err != nil {
+			return nil, errStructuredField
+		}
+		return n, nil
+	case c == '"':
+		var b strings.Builder
+		for p.i++; !p.done(); p.i++ {
+			c := p.s[p.i]
+			switch {
+			case c == '\\':
+				p.i++
+				if next := p.peek(); next != '"' && next != '\\' {
+					return nil, errStructuredField
+				}
+				b.WriteByte(p.s[p.i])
+			case c == '"':
+				p.i++
+				return b.String(), nil
+			case c < 0x20 || c > 0x7e:
+				return nil, errStructuredField
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, errStructuredField
+	case c == ':':
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end == -1 {
+			return nil, errStructuredField
+		}
+		decoded, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+		if err != nil {
+			return nil, errStructuredField
+		}
+		p.i += end + 2
+		return decoded, nil
+	case c == '?':
+		p.i++
+		switch p.peek() {
+		case '0':
+			p.i++
+			return false, nil
+		case '1':
+			p.i++
+			return true, nil
+		}
+		return nil, errStructuredField
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '*':
+		start := p.i
+		for !p.done() {
+			c := p.peek()
+			if !isToken(string(c)) && c != ':' && c != '/' {
+				break
+			}
+			p.i++
+		}
+		return sfToken(p.s[start:p.i]), nil
+	}
+	return nil, errStructuredField
+}
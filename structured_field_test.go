@@ -0,0 +1,49 @@
+package req
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseSFDictionary(t *testing.T) {
+	members, err := parseSFDictionary(`sig1=("@method" "@query-param";name="id");created=1618884473;keyid="k\"1", sig2=:AQID:, flag, sha-256=:YWJj:;x=?0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 4 {
+		t.Fatalf("len(members) = %d, want 4", len(members))
+	}
+
+	sig1 := members[0]
+	if !sig1.isList || len(sig1.list) != 2 || sig1.list[1].params[0].value != "id" {
+		t.Errorf("sig1 = %+v", sig1)
+	}
+	if got := serializeSFInnerList(sig1.list, sig1.item.params); got != `("@method" "@query-param";name="id");created=1618884473;keyid="k\"1"` {
+		t.Errorf("serializeSFInnerList() = %s", got)
+	}
+	if b, ok := members[1].item.value.([]byte); !ok || !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Errorf("sig2 = %+v", members[1].item)
+	}
+	if members[2].item.value != true {
+		t.Errorf("flag = %+v", members[2].item)
+	}
+	if v, _ := members[3].item.param("x"); v != false {
+		t.Errorf("sha-256;x = %v", v)
+	}
+}
+
+func TestParseSFDictionary_Invalid(t *testing.T) {
+	for _, s := range []string{
+		`Sig=:AA==:`,
+		`sig=("a" "b"`,
+		`sig="unterminated`,
+		`sig=:not base64:`,
+		`sig=1.5`,
+		`a=1,`,
+		`a=1 b=2`,
+	} {
+		if _, err := parseSFDictionary(s); err == nil {
+			t.Errorf("parseSFDictionary(%q) error = nil", s)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package req
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// DefaultReservedTenants are the names rejected as tenants when
+// TenantResolverOptions.Reserved is nil.
+var DefaultReservedTenants = []string{"www", "api", "admin"}
+
+// TenantStrategy finds the tenant of a request. It returns an empty string
+// if the request carries no tenant; errors are reserved for failures such
+// as an unavailable lookup backend.
+type TenantStrategy interface {
+	ResolveTenant(r *http.Request) (string, error)
+}
+
+// TenantStrategyFunc adapts a function to a TenantStrategy.
+type TenantStrategyFunc func(r *http.Request) (string, error)
+
+// ResolveTenant implements TenantStrategy.
+func (f TenantStrategyFunc) ResolveTenant(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// TenantDomainLookup maps custom domains to tenants, e.g. from a database.
+// Implementations must be safe for concurrent use.
+type TenantDomainLookup interface {
+	// LookupTenant returns the tenant owning host, or an empty string if
+	// the host is unknown. host is normalized with NormalizeHost.
+	LookupTenant(ctx context.Context, host string) (string, error)
+}
+
+// TenantDomainMap is a static TenantDomainLookup from lowercase host to tenant.
+type TenantDomainMap map[string]string
+
+// LookupTenant implements TenantDomainLookup.
+func (m TenantDomainMap) LookupTenant(_ context.Context, host string) (string, error) {
+	return m[NormalizeHost(host)], nil
+}
+
+// TenantFromSubdomain resolves "{tenant}.{baseDomain}", e.g. "acme" for
+// "acme.app.com" with the base domain "app.com". Hosts outside the base
+// domain or with more than one label in front of it carry no tenant. An
+// empty baseDomain uses GetSubdomainWithOptions instead.
+func TenantFromSubdomain(baseDomain string, opts HostOptions) TenantStrategy {
+	baseDomain = canonicalDomain(strings.TrimPrefix(strings.TrimSpace(baseDomain), "."))
+	return TenantStrategyFunc(func(r *http.Request) (string, error) {
+		if baseDomain == "" {
+			return GetSubdomainWithOptions(r, opts), nil
+		}
+
+		host := GetHostWithOptions(r, opts)
+		if !strings.HasSuffix(host, "."+baseDomain) {
+			return "", nil
+		}
+		label := strings.TrimSuffix(host, "."+baseDomain)
+		if strings.Contains(label, ".") {
+			return "", nil
+		}
+		return label, nil
+	})
+}
+
+// TenantFromCustomDomain resolves the tenant owning the request host.
+func TenantFromCustomDomain(lookup TenantDomainLookup, opts HostOptions) TenantStrategy {
+	return TenantStrategyFunc(func(r *http.Request) (string, error) {
+		host := GetHostWithOptions(r, opts)
+		if host == "" || IsIPHost(host) {
+			return "", nil
+		}
+		return lookup.LookupTenant(r.Context(), host)
+	})
+}
+
+// TenantFromHeader resolves the tenant from a request header such as
+// "X-Tenant". The value is lowercased.
+func TenantFromHeader(name string) TenantStrategy {
+	return TenantStrategyFunc(func(r *http.Request) (string, error) {
+		return strings.ToLower(strings.TrimSpace(r.Header.Get(name))), nil
+	})
+}
+
+// TenantFromPathPrefix resolves the path segment following prefix, e.g.
+// "acme" for "/t/acme/orders" with the prefix "/t/". The value is lowercased.
+func TenantFromPathPrefix(prefix string) TenantStrategy {
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	return TenantStrategyFunc(func(r *http.Request) (string, error) {
+		if r.URL == nil {
+			return "", nil
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			return "", nil
+		}
+		tenant, _, _ := strings.Cut(rest, "/")
+		return strings.ToLower(tenant), nil
+	})
+}
+
+// TenantResolverOptions configures NewTenantResolver.
+type TenantResolverOptions struct {
+	// Strategies are tried in order; the first valid tenant wins. Put
+	// TenantFromCustomDomain before TenantFromSubdomain without a base domain,
+	// so custom domains are not mistaken for subdomains.
+	Strategies []TenantStrategy
+	// Reserved names are never accepted as tenants, so "www.app.com" falls
+	// through to the next strategy. Nil means DefaultReservedTenants.
+	Reserved []string
+	// Required makes the middleware reject requests without a tenant.
+	Required bool
+	// NotFoundHandler responds to requests without a tenant when Required
+	// is set; nil means 404 Not Found.
+	NotFoundHandler http.Handler
+	// Logger receives strategy errors, in which case the middleware responds
+	// with 500 Internal Server Error; nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// TenantResolver finds the tenant of a request using ordered strategies.
+type TenantResolver struct {
+	opts     TenantResolverOptions
+	reserved map[string]bool
+}
+
+// NewTenantResolver creates a tenant resolver.
+//
+// Example:
+//
+//	resolver := req.NewTenantResolver(req.TenantResolverOptions{
+//	    Strategies: []req.TenantStrategy{
+//	        req.TenantFromCustomDomain(domains, req.HostOptions{}),
+//	        req.TenantFromSubdomain("app.com", req.HostOptions{}),
+//	        req.TenantFromHeader("X-Tenant"),
+//	        req.TenantFromPathPrefix("/t/"),
+//	    },
+//	    Required: true,
+//	})
+//	http.ListenAndServe(":8080", resolver.Middleware(handler))
+func NewTenantResolver(opts TenantResolverOptions) *TenantResolver {
+	reserved := opts.Reserved
+	if reserved == nil {
+		reserved = DefaultReservedTenants
+	}
+	t := &TenantResolver{opts: opts, reserved: map[string]bool{}}
+	for _, name := range reserved {
+		t.reserved[strings.ToLower(name)] = true
+	}
+	return t
+}
+
+// TenantMiddleware returns middleware that stores the tenant of each
+// request in its context, see GetTenant.
+func TenantMiddleware(opts TenantResolverOptions) func(http.Handler) http.Handler {
+	return NewTenantResolver(opts).Middleware
+}
+
+// Resolve returns the tenant of the request, or an empty string if no
+// strategy finds a valid one.
+//
+// Business logic:
+// - strategies are tried in order
+// - empty, reserved and malformed names are skipped
+// - a strategy error stops the resolution and is returned
+func (t *TenantResolver) Resolve(r *http.Request) (string, error) {
+	for _, strategy := range t.opts.Strategies {
+		tenant, err := strategy.ResolveTenant(r)
+		if err != nil {
+			return "", err
+		}
+		if tenant == "" || t.reserved[strings.ToLower(tenant)] || !isTenantName(tenant) {
+			continue
+		}
+		return tenant, nil
+	}
+	return "", nil
+}
+
+// Middleware wraps next with the resolver.
+func (t *TenantResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := t.Resolve(r)
+		if err != nil {
+			t.logger().Error("req: tenant resolution failed", "error", err, "host", r.Host)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if tenant == "" {
+			if !t.opts.Required {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if t.opts.NotFoundHandler != nil {
+				t.opts.NotFoundHandler.ServeHTTP(w, r)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+// logger returns the configured logger.
+func (t *TenantResolver) logger() *slog.Logger {
+	if t.opts.Logger != nil {
+		return t.opts.Logger
+	}
+	return slog.Default()
+}
+
+// tenantContextKey is the context key of the resolved tenant.
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored by the tenant middleware.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// GetTenant returns the tenant stored in the request context by the tenant
+// middleware, or an empty string if there is none.
+func GetTenant(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	tenant, _ := TenantFromContext(r.Context())
+	return tenant
+}
+
+// isTenantName reports whether s is 1-63 letters, digits, '-' or '_', so
+// header and path values cannot smuggle separators into tenant IDs.
+func isTenantName(s string) bool {
+	if len(s) == 0 || len(s) > 63 {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantResolver_Resolve(t *testing.T) {
+	resolver := NewTenantResolver(TenantResolverOptions{
+		Strategies: []TenantStrategy{
+			TenantFromCustomDomain(TenantDomainMap{"shop.acme-store.com": "acme"}, HostOptions{}),
+			TenantFromSubdomain("app.com", HostOptions{}),
+			TenantFromHeader("X-Tenant"),
+			TenantFromPathPrefix("/t/"),
+		},
+	})
+
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		header   string
+		expected string
+	}{
+		{name: "subdomain", host: "globex.app.com", path: "/", expected: "globex"},
+		{name: "subdomain with port", host: "globex.app.com:8443", path: "/", expected: "globex"},
+		{name: "custom domain", host: "Shop.Acme-Store.com", path: "/", expected: "acme"},
+		{name: "reserved subdomain falls through", host: "www.app.com", path: "/", header: "initech", expected: "initech"},
+		{name: "nested subdomain ignored", host: "a.globex.app.com", path: "/", expected: ""},
+		{name: "base domain only", host: "app.com", path: "/", expected: ""},
+		{name: "header", host: "app.com", path: "/", header: " Initech ", expected: "initech"},
+		{name: "malformed header skipped", host: "app.com", path: "/t/umbrella/", header: "../etc", expected: "umbrella"},
+		{name: "reserved header skipped", host: "app.com", path: "/", header: "admin", expected: ""},
+		{name: "path prefix", host: "app.com", path: "/t/Umbrella/orders", expected: "umbrella"},
+		{name: "path prefix without trailing slash", host: "app.com", path: "/t/umbrella", expected: "umbrella"},
+		{name: "other path", host: "app.com", path: "/tenants/umbrella", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				r.Header.Set("X-Tenant", tt.header)
+			}
+
+			tenant, err := resolver.Resolve(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tenant != tt.expected {
+				t.Errorf("Resolve() = %q, want %q", tenant, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTenantFromSubdomain_PublicSuffix(t *testing.T) {
+	strategy := TenantFromSubdomain("", HostOptions{})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "acme.example.co.uk"
+	tenant, err := strategy.ResolveTenant(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "acme" {
+		t.Errorf("ResolveTenant() = %q, want %q", tenant, "acme")
+	}
+}
+
+func TestTenantResolver_CustomReserved(t *testing.T) {
+	resolver := NewTenantResolver(TenantResolverOptions{
+		Strategies: []TenantStrategy{TenantFromHeader("X-Tenant")},
+		Reserved:   []string{"Billing"},
+	})
+
+	for value, expected := range map[string]string{"www": "www", "billing": ""} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", value)
+		if tenant, _ := resolver.Resolve(r); tenant != expected {
+			t.Errorf("Resolve(%q) = %q, want %q", value, tenant, expected)
+		}
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	lookupErr := errors.New("database down")
+	failing := TenantStrategyFunc(func(r *http.Request) (string, error) {
+		if r.Header.Get("X-Fail") != "" {
+			return "", lookupErr
+		}
+		return "", nil
+	})
+
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = GetTenant(r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		opts     TenantResolverOptions
+		tenant   string
+		fail     bool
+		status   int
+		expected string
+	}{
+		{
+			name:     "tenant in context",
+			opts:     TenantResolverOptions{Strategies: []TenantStrategy{TenantFromHeader("X-Tenant")}},
+			tenant:   "acme",
+			status:   http.StatusNoContent,
+			expected: "acme",
+		},
+		{
+			name:   "optional tenant missing",
+			opts:   TenantResolverOptions{Strategies: []TenantStrategy{TenantFromHeader("X-Tenant")}},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "required tenant missing",
+			opts:   TenantResolverOptions{Strategies: []TenantStrategy{TenantFromHeader("X-Tenant")}, Required: true},
+			status: http.StatusNotFound,
+		},
+		{
+			name: "custom not found handler",
+			opts: TenantResolverOptions{
+				Strategies: []TenantStrategy{TenantFromHeader("X-Tenant")},
+				Required:   true,
+				NotFoundHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusMisdirectedRequest)
+				}),
+			},
+			status: http.StatusMisdirectedRequest,
+		},
+		{
+			name:   "strategy error",
+			opts:   TenantResolverOptions{Strategies: []TenantStrategy{failing, TenantFromHeader("X-Tenant")}, Logger: discardLogger()},
+			tenant: "acme",
+			fail:   true,
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.tenant != "" {
+				r.Header.Set("X-Tenant", tt.tenant)
+			}
+			if tt.fail {
+				r.Header.Set("X-Fail", "1")
+			}
+
+			w := httptest.NewRecorder()
+			TenantMiddleware(tt.opts)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if seen != tt.expected {
+				t.Errorf("GetTenant() = %q, want %q", seen, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTenantFromContext(t *testing.T) {
+	if _, ok := TenantFromContext(context.Background()); ok {
+		t.Error("TenantFromContext() ok = true for empty context")
+	}
+	tenant, ok := TenantFromContext(WithTenant(context.Background(), "acme"))
+	if !ok || tenant != "acme" {
+		t.Errorf("TenantFromContext() = %q, %v, want %q, true", tenant, ok, "acme")
+	}
+	if got := GetTenant(nil); got != "" {
+		t.Errorf("GetTenant(nil) = %q, want \"\"", got)
+	}
+}
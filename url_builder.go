@@ -0,0 +1,251 @@
+package req
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// URLBuilder modifies the query string of the current request URL, e.g.
+// for pagination and filter links. Parameters keep their original order
+// and the bracket notations read by GetArray and GetMap ("tag[]",
+// "tag[0]", "filter[status]"). Methods modify the builder in place and
+// return it for chaining.
+type URLBuilder struct {
+	r        *http.Request
+	opts     HostOptions
+	path     string // escaped
+	params   []urlParam
+	fragment string
+}
+
+// urlParam is a single decoded query parameter.
+type urlParam struct {
+	key   string
+	value string
+}
+
+// URLWith starts a URL builder from the URL of the given request.
+//
+// Example:
+//
+//	next := req.URLWith(r).Set("page", 2).Del("cursor").Add("tag", "x").String()
+//	// "/products?page=2&tag[]=a&tag[]=x" for "/products?page=1&cursor=abc&tag[]=a"
+func URLWith(r *http.Request) *URLBuilder {
+	b := &URLBuilder{r: r, path: "/"}
+	if r == nil || r.URL == nil {
+		return b
+	}
+	if path := r.URL.EscapedPath(); path != "" {
+		b.path = path
+	}
+	b.params = parseOrderedQuery(r.URL.RawQuery)
+	return b
+}
+
+// WithHostOptions sets the proxy trust configuration used by Absolute and URL.
+func (b *URLBuilder) WithHostOptions(opts HostOptions) *URLBuilder {
+	b.opts = opts
+	return b
+}
+
+// Path replaces the path, e.g. to link to another page with the current
+// filters. The path is escaped as needed.
+func (b *URLBuilder) Path(path string) *URLBuilder {
+	u := url.URL{Path: path}
+	b.path = u.EscapedPath()
+	if !strings.HasPrefix(b.path, "/") {
+		b.path = "/" + b.path
+	}
+	return b
+}
+
+// Fragment sets the fragment, without the leading '#'.
+func (b *URLBuilder) Fragment(fragment string) *URLBuilder {
+	b.fragment = fragment
+	return b
+}
+
+// Set replaces all values of key with value, keeping the position and
+// notation of its first occurrence. Map entries of key ("filter[status]"
+// for "filter") are removed. A missing key is appended.
+func (b *URLBuilder) Set(key string, value any) *URLBuilder {
+	found := false
+	kept := b.params[:0]
+	for _, p := range b.params {
+		notation, ok := paramNotation(p.key, key)
+		if !ok {
+			kept = append(kept, p)
+			continue
+		}
+		if !found && notation != "map" {
+			found = true
+			p.key = key + notationSuffix(notation, 0)
+			p.value = cast.ToString(value)
+			kept = append(kept, p)
+		}
+	}
+	b.params = kept
+	if !found {
+		b.params = append(b.params, urlParam{key: key, value: cast.ToString(value)})
+	}
+	return b
+}
+
+// Add appends a value to key, using the notation key already has: "tag"
+// repeats the key, "tag[]" appends "tag[]" and "tag[0]" continues the
+// numbering.
+func (b *URLBuilder) Add(key string, value any) *URLBuilder {
+	suffix := ""
+	next := 0
+	for _, p := range b.params {
+		notation, ok := paramNotation(p.key, key)
+		if !ok || notation == "map" {
+			continue
+		}
+		switch notation {
+		case "array":
+			suffix = "[]"
+		case "numbered":
+			index, _ := strconv.Atoi(p.key[len(key)+1 : len(p.key)-1])
+			next = max(next, index+1)
+			suffix = notationSuffix(notation, next)
+		}
+	}
+	b.params = append(b.params, urlParam{key: key + suffix, value: cast.ToString(value)})
+	return b
+}
+
+// Del removes key in every notation, including map entries such as
+// "filter[status]" for the key "filter".
+func (b *URLBuilder) Del(key string) *URLBuilder {
+	kept := b.params[:0]
+	for _, p := range b.params {
+		if _, ok := paramNotation(p.key, key); !ok {
+			kept = append(kept, p)
+		}
+	}
+	b.params = kept
+	return b
+}
+
+// Clear removes all query parameters.
+func (b *URLBuilder) Clear() *URLBuilder {
+	b.params = nil
+	return b
+}
+
+// Query returns the encoded query string, without the leading '?'.
+// Brackets in keys are left unescaped for readability.
+func (b *URLBuilder) Query() string {
+	var sb strings.Builder
+	for i, p := range b.params {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		key := url.QueryEscape(p.key)
+		key = strings.NewReplacer("%5B", "[", "%5D", "]").Replace(key)
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(p.value))
+	}
+	return sb.String()
+}
+
+// String returns the relative URL: path, query and fragment.
+func (b *URLBuilder) String() string {
+	return b.relative().String()
+}
+
+// Absolute returns the absolute URL, with scheme and host taken from
+// ExternalURL.
+func (b *URLBuilder) Absolute() string {
+	return b.URL().String()
+}
+
+// URL returns the absolute URL.
+func (b *URLBuilder) URL() *url.URL {
+	u := b.relative()
+	if b.r == nil {
+		return u
+	}
+
+	scheme, host, prefix := externalOrigin(b.r, b.opts)
+	u.Scheme, u.Host = scheme, host
+	if prefix != "" {
+		// Keep a trusted X-Forwarded-Prefix
+		rawPath := prefix + u.EscapedPath()
+		u.Path, _ = url.PathUnescape(rawPath)
+		u.RawPath = ""
+		if u.EscapedPath() != rawPath {
+			u.RawPath = rawPath
+		}
+	}
+	return u
+}
+
+// relative builds the relative URL.
+func (b *URLBuilder) relative() *url.URL {
+	u := &url.URL{RawQuery: b.Query(), Fragment: b.fragment}
+	u.Path, _ = url.PathUnescape(b.path)
+	if u.EscapedPath() != b.path {
+		u.RawPath = b.path
+	}
+	return u
+}
+
+// parseOrderedQuery decodes a query string keeping the parameter order.
+// Malformed pairs are skipped, like url.ParseQuery does.
+func parseOrderedQuery(query string) []urlParam {
+	var params []urlParam
+	for query != "" {
+		var pair string
+		pair, query, _ = strings.Cut(query, "&")
+		if pair == "" || strings.Contains(pair, ";") {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err1 := url.QueryUnescape(rawKey)
+		value, err2 := url.QueryUnescape(rawValue)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		params = append(params, urlParam{key: key, value: value})
+	}
+	return params
+}
+
+// paramNotation reports whether param is key in one of the notations read
+// by GetArray and GetMap: "plain" (key), "array" (key[]), "numbered"
+// (key[0]) or "map" (key[name]).
+func paramNotation(param, key string) (string, bool) {
+	if param == key {
+		return "plain", true
+	}
+	inner, ok := strings.CutPrefix(param, key+"[")
+	if !ok || !strings.HasSuffix(inner, "]") {
+		return "", false
+	}
+	inner = strings.TrimSuffix(inner, "]")
+	if inner == "" {
+		return "array", true
+	}
+	if _, err := strconv.Atoi(inner); err == nil {
+		return "numbered", true
+	}
+	return "map", true
+}
+
+// notationSuffix returns the key suffix of a notation.
+func notationSuffix(notation string, index int) string {
+	switch notation {
+	case "array":
+		return "[]"
+	case "numbered":
+		return "[" + strconv.Itoa(index) + "]"
+	}
+	return ""
+}
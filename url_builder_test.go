@@ -0,0 +1,140 @@
+package req
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		build    func(b *URLBuilder) *URLBuilder
+		expected string
+	}{
+		{
+			name:   "set, del and add",
+			target: "/products?page=1&cursor=abc&tag[]=a",
+			build: func(b *URLBuilder) *URLBuilder {
+				return b.Set("page", 2).Del("cursor").Add("tag", "x")
+			},
+			expected: "/products?page=2&tag[]=a&tag[]=x",
+		},
+		{
+			name:     "unchanged query keeps order",
+			target:   "/search?z=1&a=2&m=3",
+			build:    func(b *URLBuilder) *URLBuilder { return b },
+			expected: "/search?z=1&a=2&m=3",
+		},
+		{
+			name:     "set keeps position and removes duplicates",
+			target:   "/?a=1&sort=name&b=2&sort=date",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Set("sort", "price") },
+			expected: "/?a=1&sort=price&b=2",
+		},
+		{
+			name:     "set appends missing key",
+			target:   "/?a=1",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Set("page", 3) },
+			expected: "/?a=1&page=3",
+		},
+		{
+			name:     "add repeats plain key",
+			target:   "/?tag=a",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Add("tag", "b") },
+			expected: "/?tag=a&tag=b",
+		},
+		{
+			name:     "add continues numbered notation",
+			target:   "/?ids[0]=4&ids[1]=7",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Add("ids", 9) },
+			expected: "/?ids[0]=4&ids[1]=7&ids[2]=9",
+		},
+		{
+			name:     "set keeps array notation",
+			target:   "/?tag[]=a&tag[]=b",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Set("tag", "c") },
+			expected: "/?tag[]=c",
+		},
+		{
+			name:     "map entries",
+			target:   "/?filter[status]=open&filter[owner]=me&q=x",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Set("filter[status]", "closed") },
+			expected: "/?filter[status]=closed&filter[owner]=me&q=x",
+		},
+		{
+			name:     "del removes map entries",
+			target:   "/?filter[status]=open&filter[owner]=me&q=x",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Del("filter") },
+			expected: "/?q=x",
+		},
+		{
+			name:     "del keeps keys with the same prefix",
+			target:   "/?tag=a&tags=b&tag[]=c",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Del("tag") },
+			expected: "/?tags=b",
+		},
+		{
+			name:     "values are escaped",
+			target:   "/?q=a+b",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Set("q", "c&d=é").Add("x y", "1") },
+			expected: "/?q=c%26d%3D%C3%A9&x+y=1",
+		},
+		{
+			name:     "clear, path and fragment",
+			target:   "/a?b=1",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Clear().Path("/other page").Fragment("top") },
+			expected: "/other%20page#top",
+		},
+		{
+			name:     "escaped path preserved",
+			target:   "/files/a%2Fb?x=1",
+			build:    func(b *URLBuilder) *URLBuilder { return b.Del("x") },
+			expected: "/files/a%2Fb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if got := tt.build(URLWith(r)).String(); got != tt.expected {
+				t.Errorf("String() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestURLBuilder_ReadBack(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?tag[]=a", nil)
+	next := URLWith(r).Add("tag", "b").Set("filter[status]", "open").String()
+
+	r2 := httptest.NewRequest("GET", next, nil)
+	if got := GetArray(r2, "tag", nil); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("GetArray() = %q, want [a b]", got)
+	}
+	if got := GetMap(r2, "filter"); got["status"] != "open" {
+		t.Errorf("GetMap() = %v, want status=open", got)
+	}
+}
+
+func TestURLBuilder_Absolute(t *testing.T) {
+	r := httptest.NewRequest("GET", "/orders?page=1", nil)
+	r.Host = "backend:8080"
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "shop.example.com")
+	r.Header.Set("X-Forwarded-Prefix", "/store")
+
+	if got := URLWith(r).Set("page", 2).Absolute(); got != "http://backend:8080/orders?page=2" {
+		t.Errorf("Absolute() = %q", got)
+	}
+
+	got := URLWith(r).WithHostOptions(HostOptions{TrustedProxies: []string{"10.0.0.0/8"}}).Set("page", 2).Absolute()
+	if got != "https://shop.example.com/store/orders?page=2" {
+		t.Errorf("Absolute() = %q", got)
+	}
+
+	if got := URLWith(nil).Set("a", 1).String(); got != "/?a=1" {
+		t.Errorf("String() = %q", got)
+	}
+}
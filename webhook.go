@@ -0,0 +1,357 @@
+package req
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook verification errors.
+var (
+	ErrWebhookSignatureMissing = errors.New("req: webhook signature missing")
+	ErrWebhookSignatureInvalid = errors.New("req: webhook signature invalid")
+	ErrWebhookTimestamp        = errors.New("req: webhook timestamp outside the tolerance")
+)
+
+// DefaultWebhookTolerance is the accepted age of signed webhook timestamps
+// when WebhookOptions.Tolerance is zero.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// Webhook signature encodings of HMACWebhookOptions.
+const (
+	WebhookEncodingHex    = "hex"
+	WebhookEncodingBase64 = "base64"
+)
+
+// WebhookVerifier verifies the signature of a webhook request.
+type WebhookVerifier interface {
+	// VerifyWebhook returns nil if the request is authentic. The body
+	// stays readable for the handler.
+	VerifyWebhook(r *http.Request) error
+}
+
+// WebhookVerifierFunc adapts a function to a WebhookVerifier.
+type WebhookVerifierFunc func(r *http.Request) error
+
+// VerifyWebhook implements WebhookVerifier.
+func (f WebhookVerifierFunc) VerifyWebhook(r *http.Request) error {
+	return f(r)
+}
+
+// WebhookOptions configures the provider verifiers.
+type WebhookOptions struct {
+	// Secret is the signing secret (the auth token for Twilio). Verifiers
+	// built with an empty secret reject every request.
+	Secret string
+	// Tolerance is the accepted difference between a signed timestamp and
+	// now; zero means DefaultWebhookTolerance.
+	Tolerance time.Duration
+	// MaxBodySize limits the body read for verification; zero means
+	// DefaultMaxBodySize.
+	MaxBodySize int64
+	// HostOptions controls how the public URL signed by Twilio is rebuilt.
+	HostOptions HostOptions
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+}
+
+// HMACWebhookOptions configures HMACWebhook for custom providers.
+type HMACWebhookOptions struct {
+	WebhookOptions
+	// Header holds the signature.
+	Header string
+	// Prefix is stripped from the header value, e.g. "sha256=".
+	Prefix string
+	// Hash is the HMAC hash; nil means SHA-256.
+	Hash func() hash.Hash
+	// Encoding of the signature, WebhookEncodingHex (default) or WebhookEncodingBase64.
+	Encoding string
+	// TimestampHeader, if set, holds a Unix timestamp that must be within
+	// the tolerance.
+	TimestampHeader string
+	// SignedPayload builds the signed bytes; nil means the body, or
+	// "timestamp.body" when TimestampHeader is set.
+	SignedPayload func(timestamp string, body []byte) []byte
+}
+
+// HMACWebhook returns a verifier for providers that send an HMAC of the
+// body, optionally with a timestamp, in a header.
+//
+// Example:
+//
+//	verifier := req.HMACWebhook(req.HMACWebhookOptions{
+//	    WebhookOptions:  req.WebhookOptions{Secret: secret},
+//	    Header:          "X-Signature",
+//	    TimestampHeader: "X-Timestamp",
+//	})
+func HMACWebhook(opts HMACWebhookOptions) WebhookVerifier {
+	if opts.Secret == "" {
+		return emptySecretWebhook
+	}
+	return WebhookVerifierFunc(func(r *http.Request) error {
+		value := strings.TrimSpace(r.Header.Get(opts.Header))
+		if value == "" {
+			return ErrWebhookSignatureMissing
+		}
+		signature, ok := strings.CutPrefix(value, opts.Prefix)
+		if !ok {
+			return fmt.Errorf("%w: missing %q prefix", ErrWebhookSignatureInvalid, opts.Prefix)
+		}
+
+		timestamp := ""
+		if opts.TimestampHeader != "" {
+			timestamp = r.Header.Get(opts.TimestampHeader)
+			if err := checkWebhookTimestamp(timestamp, opts.WebhookOptions); err != nil {
+				return err
+			}
+		}
+
+		body, err := GetRawBody(r, opts.MaxBodySize)
+		if err != nil {
+			return err
+		}
+		payload := body
+		switch {
+		case opts.SignedPayload != nil:
+			payload = opts.SignedPayload(timestamp, body)
+		case opts.TimestampHeader != "":
+			payload = append([]byte(timestamp+"."), body...)
+		}
+
+		mac := webhookHMAC(opts.Hash, opts.Secret, payload)
+		if !equalEncodedMAC(mac, signature, opts.Encoding) {
+			return ErrWebhookSignatureInvalid
+		}
+		return nil
+	})
+}
+
+// GitHubWebhook verifies the X-Hub-Signature-256 header of GitHub webhooks.
+func GitHubWebhook(opts WebhookOptions) WebhookVerifier {
+	return HMACWebhook(HMACWebhookOptions{
+		WebhookOptions: opts,
+		Header:         "X-Hub-Signature-256",
+		Prefix:         "sha256=",
+	})
+}
+
+// ShopifyWebhook verifies the X-Shopify-Hmac-Sha256 header of Shopify
+// webhooks.
+func ShopifyWebhook(opts WebhookOptions) WebhookVerifier {
+	return HMACWebhook(HMACWebhookOptions{
+		WebhookOptions: opts,
+		Header:         "X-Shopify-Hmac-Sha256",
+		Encoding:       WebhookEncodingBase64,
+	})
+}
+
+// SlackWebhook verifies the v0 X-Slack-Signature header of Slack requests,
+// signed over "v0:timestamp:body" with X-Slack-Request-Timestamp.
+func SlackWebhook(opts WebhookOptions) WebhookVerifier {
+	return HMACWebhook(HMACWebhookOptions{
+		WebhookOptions:  opts,
+		Header:          "X-Slack-Signature",
+		Prefix:          "v0=",
+		TimestampHeader: "X-Slack-Request-Timestamp",
+		SignedPayload: func(timestamp string, body []byte) []byte {
+			return append([]byte("v0:"+timestamp+":"), body...)
+		},
+	})
+}
+
+// StripeWebhook verifies the Stripe-Signature header of Stripe webhooks.
+//
+// Business logic:
+// - the header holds "t=timestamp" and one or more "v1=signature" elements
+// - the timestamp must be within the tolerance
+// - any v1 signature of "timestamp.body" may match, so secrets can be rolled
+func StripeWebhook(opts WebhookOptions) WebhookVerifier {
+	if opts.Secret == "" {
+		return emptySecretWebhook
+	}
+	return WebhookVerifierFunc(func(r *http.Request) error {
+		header := r.Header.Get("Stripe-Signature")
+		if header == "" {
+			return ErrWebhookSignatureMissing
+		}
+
+		timestamp := ""
+		var signatures []string
+		for _, element := range strings.Split(header, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(element), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signatures = append(signatures, value)
+			}
+		}
+		if len(signatures) == 0 {
+			return ErrWebhookSignatureMissing
+		}
+		if err := checkWebhookTimestamp(timestamp, opts); err != nil {
+			return err
+		}
+
+		body, err := GetRawBody(r, opts.MaxBodySize)
+		if err != nil {
+			return err
+		}
+		mac := webhookHMAC(nil, opts.Secret, append([]byte(timestamp+"."), body...))
+		for _, signature := range signatures {
+			if equalEncodedMAC(mac, signature, WebhookEncodingHex) {
+				return nil
+			}
+		}
+		return ErrWebhookSignatureInvalid
+	})
+}
+
+// TwilioWebhook verifies the X-Twilio-Signature header of Twilio requests.
+//
+// Business logic:
+// - the signed URL is the public request URL, rebuilt with ExternalURL
+// - form posts are signed over the URL followed by the sorted parameter names and values
+// - JSON posts carry a bodySHA256 query parameter, which must match the body, and are signed over the URL only
+func TwilioWebhook(opts WebhookOptions) WebhookVerifier {
+	if opts.Secret == "" {
+		return emptySecretWebhook
+	}
+	return WebhookVerifierFunc(func(r *http.Request) error {
+		signature := r.Header.Get("X-Twilio-Signature")
+		if signature == "" {
+			return ErrWebhookSignatureMissing
+		}
+
+		body, err := GetRawBody(r, opts.MaxBodySize)
+		if err != nil {
+			return err
+		}
+		u := ExternalURL(r, opts.HostOptions)
+		payload := u.String()
+
+		if bodyHash := u.Query().Get("bodySHA256"); bodyHash != "" {
+			sum := sha256.Sum256(body)
+			if !hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(bodyHash))) {
+				return fmt.Errorf("%w: bodySHA256 mismatch", ErrWebhookSignatureInvalid)
+			}
+		} else if r.Method == http.MethodPost {
+			form, err := url.ParseQuery(string(body))
+			if err != nil {
+				return fmt.Errorf("%w: malformed form body", ErrWebhookSignatureInvalid)
+			}
+			names := make([]string, 0, len(form))
+			for name := range form {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			var b strings.Builder
+			b.WriteString(payload)
+			for _, name := range names {
+				values := slices.Clone(form[name])
+				slices.Sort(values)
+				for _, value := range values {
+					b.WriteString(name + value)
+				}
+			}
+			payload = b.String()
+		}
+
+		mac := webhookHMAC(sha1.New, opts.Secret, []byte(payload))
+		if !equalEncodedMAC(mac, signature, WebhookEncodingBase64) {
+			return ErrWebhookSignatureInvalid
+		}
+		return nil
+	})
+}
+
+// WebhookMiddleware returns middleware that rejects requests failing
+// verification with 401 Unauthorized, or 413 Request Entity Too Large for
+// oversized bodies. A nil logger means slog.Default().
+//
+// Example:
+//
+//	mw := req.WebhookMiddleware(req.GitHubWebhook(req.WebhookOptions{Secret: secret}), nil)
+//	mux.Handle("/hooks/github", mw(handler))
+func WebhookMiddleware(verifier WebhookVerifier, logger *slog.Logger) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := verifier.VerifyWebhook(r)
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r)
+			case errors.Is(err, ErrBodyTooLarge):
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			default:
+				logger.Warn("req: webhook verification failed", "error", err, "path", r.URL.Path)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// emptySecretWebhook rejects every request of a verifier built without
+// a secret, as an HMAC with an empty key can be computed by anyone.
+var emptySecretWebhook = WebhookVerifierFunc(func(*http.Request) error {
+	return fmt.Errorf("%w: empty secret", ErrWebhookSignatureInvalid)
+})
+
+// checkWebhookTimestamp checks a Unix timestamp against the tolerance.
+func checkWebhookTimestamp(timestamp string, opts WebhookOptions) error {
+	if timestamp == "" {
+		return ErrWebhookSignatureMissing
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrWebhookTimestamp)
+	}
+	now := time.Now()
+	if opts.Now != nil {
+		now = opts.Now()
+	}
+	tolerance := opts.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrWebhookTimestamp
+	}
+	return nil
+}
+
+// webhookHMAC computes an HMAC; a nil hash means SHA-256.
+func webhookHMAC(h func() hash.Hash, secret string, payload []byte) []byte {
+	if h == nil {
+		h = sha256.New
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// equalEncodedMAC compares a MAC with an encoded signature in constant time.
+func equalEncodedMAC(mac []byte, signature, encoding string) bool {
+	var decoded []byte
+	var err error
+	if encoding == WebhookEncodingBase64 {
+		decoded, err = base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	} else {
+		decoded, err = hex.DecodeString(strings.TrimSpace(signature))
+	}
+	return err == nil && hmac.Equal(mac, decoded)
+}
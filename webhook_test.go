@@ -0,0 +1,278 @@
+package req
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hmacHex(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	verifier := GitHubWebhook(WebhookOptions{Secret: "It's a Secret to Everybody"})
+
+	tests := []struct {
+		name      string
+		signature string
+		want      error
+	}{
+		// Example from the GitHub documentation
+		{"valid", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", nil},
+		{"wrong", "sha256=" + strings.Repeat("0", 64), ErrWebhookSignatureInvalid},
+		{"no prefix", "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", ErrWebhookSignatureInvalid},
+		{"missing", "", ErrWebhookSignatureMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/hooks/github", strings.NewReader("Hello, World!"))
+			if tt.signature != "" {
+				r.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			if err := verifier.VerifyWebhook(r); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyWebhook() error = %v, want %v", err, tt.want)
+			}
+			body, _ := io.ReadAll(r.Body)
+			if tt.want == nil && string(body) != "Hello, World!" {
+				t.Errorf("body after verification = %q", body)
+			}
+		})
+	}
+}
+
+func TestSlackWebhook(t *testing.T) {
+	// Example from the Slack documentation
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	sent := time.Unix(1531420618, 0)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want error
+	}{
+		{"valid", sent.Add(time.Minute), nil},
+		{"replayed", sent.Add(10 * time.Minute), ErrWebhookTimestamp},
+		{"future", sent.Add(-10 * time.Minute), ErrWebhookTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := SlackWebhook(WebhookOptions{
+				Secret: "8f742231b10e8888abcd99yyyzzz85a5",
+				Now:    func() time.Time { return tt.now },
+			})
+			r := httptest.NewRequest("POST", "/slack", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("X-Slack-Request-Timestamp", "1531420618")
+			r.Header.Set("X-Slack-Signature", "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503")
+
+			if err := verifier.VerifyWebhook(r); !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyWebhook() error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && GetString(r, "user_name") != "roadrunner" {
+				t.Errorf("GetString(user_name) = %q after verification", GetString(r, "user_name"))
+			}
+		})
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := `{"id":"evt_1"}`
+	valid := hmacHex("whsec_test", ts+"."+body)
+
+	tests := []struct {
+		name   string
+		header string
+		want   error
+	}{
+		{"valid", "t=" + ts + ",v1=" + valid, nil},
+		{"rolled secret", "t=" + ts + ",v1=" + hmacHex("whsec_old", ts+"."+body) + ",v1=" + valid, nil},
+		{"wrong", "t=" + ts + ",v1=" + hmacHex("other", ts+"."+body), ErrWebhookSignatureInvalid},
+		{"v0 only", "t=" + ts + ",v0=" + valid, ErrWebhookSignatureMissing},
+		{"no timestamp", "v1=" + valid, ErrWebhookSignatureMissing},
+		{"old timestamp", "t=1600000000,v1=" + hmacHex("whsec_test", "1600000000."+body), ErrWebhookTimestamp},
+		{"missing", "", ErrWebhookSignatureMissing},
+	}
+
+	verifier := StripeWebhook(WebhookOptions{Secret: "whsec_test", Now: func() time.Time { return now }})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/stripe", strings.NewReader(body))
+			if tt.header != "" {
+				r.Header.Set("Stripe-Signature", tt.header)
+			}
+			if err := verifier.VerifyWebhook(r); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyWebhook() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestShopifyWebhook(t *testing.T) {
+	body := `{"id":1}`
+	mac := hmac.New(sha256.New, []byte("shpss_secret"))
+	mac.Write([]byte(body))
+	valid := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	verifier := ShopifyWebhook(WebhookOptions{Secret: "shpss_secret"})
+	for signature, want := range map[string]error{valid: nil, "bm9wZQ==": ErrWebhookSignatureInvalid, "!!": ErrWebhookSignatureInvalid} {
+		r := httptest.NewRequest("POST", "/shopify", strings.NewReader(body))
+		r.Header.Set("X-Shopify-Hmac-Sha256", signature)
+		if err := verifier.VerifyWebhook(r); !errors.Is(err, want) {
+			t.Errorf("VerifyWebhook(%q) error = %v, want %v", signature, err, want)
+		}
+	}
+}
+
+func TestTwilioWebhook(t *testing.T) {
+	verifier := TwilioWebhook(WebhookOptions{Secret: "12345"})
+
+	// Example from the Twilio documentation
+	form := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	r := httptest.NewRequest("POST", "https://mycompany.com/myapp.php?foo=1&bar=2", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Twilio-Signature", "0/KCTR6DLpKmkAf8muzZqo1nDgQ=")
+	if err := verifier.VerifyWebhook(r); err != nil {
+		t.Errorf("VerifyWebhook(form) error = %v", err)
+	}
+	if GetString(r, "Digits") != "1234" {
+		t.Errorf("GetString(Digits) = %q after verification", GetString(r, "Digits"))
+	}
+
+	r = httptest.NewRequest("POST", "https://mycompany.com/myapp.php?foo=1&bar=2", strings.NewReader(form.Encode()))
+	r.Header.Set("X-Twilio-Signature", "0/KCTR6DLpKmkAf8muzZqo1nDgQ=")
+	r.Host = "evil.example.com"
+	if err := verifier.VerifyWebhook(r); !errors.Is(err, ErrWebhookSignatureInvalid) {
+		t.Errorf("VerifyWebhook(other host) error = %v, want ErrWebhookSignatureInvalid", err)
+	}
+}
+
+func TestTwilioWebhook_JSONBody(t *testing.T) {
+	body := `{"event":"call"}`
+	sum := sha256.Sum256([]byte(body))
+	target := "https://mycompany.com/hook?bodySHA256=" + hex.EncodeToString(sum[:])
+
+	mac := hmac.New(sha1.New, []byte("12345"))
+	mac.Write([]byte(target))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	verifier := TwilioWebhook(WebhookOptions{Secret: "12345"})
+	for sent, want := range map[string]error{body: nil, `{"event":"forged"}`: ErrWebhookSignatureInvalid} {
+		r := httptest.NewRequest("POST", target, strings.NewReader(sent))
+		r.Header.Set("X-Twilio-Signature", signature)
+		if err := verifier.VerifyWebhook(r); !errors.Is(err, want) {
+			t.Errorf("VerifyWebhook(%s) error = %v, want %v", sent, err, want)
+		}
+	}
+}
+
+func TestHMACWebhook_Custom(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	verifier := HMACWebhook(HMACWebhookOptions{
+		WebhookOptions:  WebhookOptions{Secret: "s3cret", Now: func() time.Time { return now }, Tolerance: time.Minute},
+		Header:          "X-Signature",
+		TimestampHeader: "X-Timestamp",
+	})
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	r.Header.Set("X-Timestamp", "1700000030")
+	r.Header.Set("X-Signature", hmacHex("s3cret", "1700000030.payload"))
+	if err := verifier.VerifyWebhook(r); err != nil {
+		t.Errorf("VerifyWebhook() error = %v", err)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	r.Header.Set("X-Timestamp", "1700000090")
+	r.Header.Set("X-Signature", hmacHex("s3cret", "1700000090.payload"))
+	if err := verifier.VerifyWebhook(r); !errors.Is(err, ErrWebhookTimestamp) {
+		t.Errorf("VerifyWebhook(late) error = %v, want ErrWebhookTimestamp", err)
+	}
+}
+
+func TestWebhook_EmptySecret(t *testing.T) {
+	body := "Hello, World!"
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	forged := hmacHex("", body)
+
+	tests := []struct {
+		name     string
+		verifier WebhookVerifier
+		headers  map[string]string
+	}{
+		{"github", GitHubWebhook(WebhookOptions{}), map[string]string{"X-Hub-Signature-256": "sha256=" + forged}},
+		{"shopify", ShopifyWebhook(WebhookOptions{}), map[string]string{"X-Shopify-Hmac-Sha256": "x"}},
+		{"slack", SlackWebhook(WebhookOptions{}), map[string]string{"X-Slack-Signature": "v0=" + hmacHex("", "v0:"+ts+":"+body), "X-Slack-Request-Timestamp": ts}},
+		{"stripe", StripeWebhook(WebhookOptions{}), map[string]string{"Stripe-Signature": "t=" + ts + ",v1=" + hmacHex("", ts+"."+body)}},
+		{"twilio", TwilioWebhook(WebhookOptions{}), map[string]string{"X-Twilio-Signature": "x"}},
+		{"custom", HMACWebhook(HMACWebhookOptions{Header: "X-Signature"}), map[string]string{"X-Signature": forged}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if err := tt.verifier.VerifyWebhook(r); !errors.Is(err, ErrWebhookSignatureInvalid) {
+				t.Errorf("VerifyWebhook() error = %v, want ErrWebhookSignatureInvalid", err)
+			}
+		})
+	}
+}
+
+func TestWebhookMiddleware(t *testing.T) {
+	verifier := GitHubWebhook(WebhookOptions{Secret: "It's a Secret to Everybody", MaxBodySize: 32})
+	handler := WebhookMiddleware(verifier, discardLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		want      int
+	}{
+		{"valid", "Hello, World!", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", http.StatusOK},
+		{"invalid", "Hello, World?", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", http.StatusUnauthorized},
+		{"too large", strings.Repeat("x", 64), "sha256=00", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("X-Hub-Signature-256", tt.signature)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("handler body = %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}